@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// aclXattr holds the POSIX access ACL of a file.
+const aclXattr = "system.posix_acl_access"
+
+// preserveACL gives dst the POSIX ACL of src.
+func preserveACL(src, dst string) error {
+	acl, err := getXattr(src, aclXattr)
+	if err != nil {
+		if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+			// Only the permission bits apply, which are copied already.
+			return nil
+		}
+		return err
+	}
+	return setXattr(dst, aclXattr, acl)
+}
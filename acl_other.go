@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+var errPreserveACLUnsupported = errors.New("preserving ACLs is not supported on this platform")
+
+func preserveACL(src, dst string) error {
+	return errPreserveACLUnsupported
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// Actions of -action, carried out on the matched files instead of renaming
+// them.
+const (
+	ACTION_CHOWN      string = "chown"
+	ACTION_SYNC_TIMES string = "sync-times"
+)
+
+// SKIP_NO_COUNTERPART is the reason of files of -action sync-times without a
+// file at their new path.
+const SKIP_NO_COUNTERPART string = "no_counterpart"
+
+// actionFlags returns the flags of cfg which only make sense when files are
+// renamed, copied or moved, and so can not be used with its -action.
+func actionFlags(cfg config) []string {
+	flags := map[string]bool{
+		"tt":                cfg.options.transmissionType != "",
+		"remember-original": cfg.options.rememberOriginal != "",
+		"staging":           cfg.options.staging != "",
+		"fix-symlinks":      cfg.options.fixSymlinks != "",
+		"stream":            cfg.withStream,
+		"atomic":            cfg.withAtomic,
+		"timeout":           cfg.timeout > 0,
+		"op-timeout":        cfg.opTimeout > 0,
+		"plan-in":           cfg.planIn != "",
+		"plan-out":          cfg.planOut != "",
+		"changed-since":     cfg.changedSince != "",
+		"strict":            cfg.withStrict,
+		"backup":            cfg.backupDir != "",
+		"backup-suffix":     cfg.backupSuffix != "",
+	}
+	// sync-times pairs files by their new names, chown needs none.
+	if cfg.action == ACTION_CHOWN {
+		maps.Copy(flags, map[string]bool{
+			"replace":       cfg.options.replace != "",
+			"count":         cfg.options.count > 0,
+			"occurrence":    cfg.options.occurrence != "",
+			"output":        cfg.options.output != "",
+			"template":      cfg.options.template != "",
+			"by-date":       cfg.options.byDate != "",
+			"dict":          cfg.options.dict != "",
+			"swap":          cfg.options.swap != "",
+			"reverse-stem":  cfg.options.withReverseStem,
+			"prefix":        cfg.options.prefix != "",
+			"suffix":        cfg.options.suffix != "",
+			"number":        cfg.options.withNumber,
+			"redact":        cfg.options.redact != "",
+			"allow-chars":   cfg.options.allowChars != "",
+			"sanitize":      cfg.options.withSanitize,
+			"ascii":         cfg.options.withASCII,
+			"normalize":     cfg.options.normalize != "",
+			"remap-capture": cfg.remapCapture != 0,
+			"assert":        cfg.options.assert != "",
+		})
+	}
+	var given []string
+	for name, set := range flags {
+		if set {
+			given = append(given, "-"+name)
+		}
+	}
+	slices.Sort(given)
+	return given
+}
+
+// chown changes the owner of the files selected by the filters of cfg,
+// instead of renaming them.
+func chown(cfg config, pattern *regexp.Regexp) {
+	uid, gid, err := lookupOwner(cfg.owner)
+	if err != nil {
+		fmt.Println("lookup owner:", err)
+		os.Exit(1)
+	}
+	paths, skipped, err := omitter.Select(cfg.planOptions(pattern), ignoredNames...)
+	if err != nil {
+		fmt.Println("walk dir:", err)
+		os.Exit(2)
+	}
+	// Files keep their names, so they have no new paths.
+	files := make(map[string]string, len(paths))
+	for _, path := range paths {
+		files[path] = ""
+	}
+	runAction(cfg, files, skipped, func(path, _ string) error {
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// syncTimes pairs every matched file with the existing file at its new path,
+// and copies the modification time of the former to the latter, or the other
+// way around with -from-pair.
+func syncTimes(cfg config, pattern *regexp.Regexp) {
+	opts := cfg.planOptions(pattern)
+	opts.Counterparts = true
+	p, err := omitter.NewPlan(opts, ignoredNames...)
+	if err != nil {
+		fmt.Println("walk dir:", err)
+		os.Exit(2)
+	}
+	for _, path := range slices.Sorted(maps.Keys(p.Pairs)) {
+		_, err := os.Stat(p.Pairs[path])
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			delete(p.Pairs, path)
+			p.Skipped = append(p.Skipped, omitter.SkippedFile{Path: path, Reason: SKIP_NO_COUNTERPART})
+		case err != nil:
+			fmt.Println("find counterpart:", err)
+			os.Exit(2)
+		}
+	}
+	runAction(cfg, p.Pairs, p.Skipped, func(oldName, newName string) error {
+		src, dst := oldName, newName
+		if cfg.withFromPair {
+			src, dst = newName, oldName
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		// The zero access time is left unchanged.
+		return os.Chtimes(dst, time.Time{}, info.ModTime())
+	})
+}
+
+// runAction carries out the -action of cfg with op for every file of files,
+// which maps them to their counterparts, if any. Failures do not stop the
+// run, and are reported at its end.
+func runAction(cfg config, files map[string]string, skipped []omitter.SkippedFile,
+	op func(oldName, newName string) error,
+) {
+	if cfg.skipReport != "" {
+		if err := writeSkipReport(cfg.skipReport, skipped); err != nil {
+			fmt.Println("write skip report:", err)
+			os.Exit(2)
+		}
+	}
+	if len(files) == 0 {
+		if cfg.format == FORMAT_JSON {
+			printReport(planReport(files, cfg.action), cfg.tags)
+		} else {
+			fmt.Println("No files matched, nothing to do.")
+		}
+		os.Exit(exitNothingToDo)
+	}
+	paths := slices.Sorted(maps.Keys(files))
+	if cfg.withDryRun {
+		if cfg.format == FORMAT_JSON {
+			printReport(planReport(files, cfg.action), cfg.tags)
+			return
+		}
+		fmt.Printf("Found %d file(s) to %s!\n", len(files), cfg.action)
+		if cfg.withVerbose {
+			for _, path := range paths {
+				if files[path] == "" {
+					fmt.Println(path)
+				} else {
+					fmt.Printf("%s -> %s\n", path, files[path])
+				}
+			}
+		}
+		return
+	}
+	if cfg.withInteractive {
+		question := fmt.Sprintf("Found %d file(s) to %s. Proceed?(y/n) ", len(files), cfg.action)
+		if !omitter.Confirm(cfg.prompter, question) {
+			fmt.Println("Aborted.")
+			return
+		}
+	}
+
+	done := make(doneRecorder, len(files))
+	var errs []error
+	for _, path := range paths {
+		if err := op(path, files[path]); err != nil {
+			errs = append(errs, &omitter.FileError{Old: path, New: files[path], Err: err})
+			continue
+		}
+		done[path] = true
+	}
+	err := errors.Join(errs...)
+	if cfg.format == FORMAT_JSON {
+		printReport(resultReport(files, cfg.action, done, err, false), cfg.tags)
+		if err != nil {
+			os.Exit(2)
+		}
+		return
+	}
+	for _, err := range errs {
+		fmt.Printf("%s: %v\n", cfg.action, err)
+	}
+	if err != nil {
+		fmt.Printf("%d of %d file(s) were %s.\n", len(done), len(files), pastTense[cfg.action])
+		os.Exit(2)
+	}
+	if cfg.withVerbose {
+		fmt.Printf("%d file(s) were %s.\n", len(done), pastTense[cfg.action])
+	}
+}
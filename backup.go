@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// overwrittenFiles returns the existing files which carrying out pairs with
+// action would overwrite, sorted: the new paths which exist, unless their
+// file is renamed or moved away first.
+func overwrittenFiles(pairs map[string]string, action string) []string {
+	var paths []string
+	for _, newName := range slices.Sorted(maps.Values(pairs)) {
+		if _, vacated := pairs[newName]; vacated && action != omitter.COPY {
+			continue
+		}
+		if info, err := os.Lstat(newName); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, newName)
+		}
+	}
+	return slices.Compact(paths)
+}
+
+// backupPath returns where the file at path is backed up: under dir, at its
+// path relative to root, or relative to its volume if it is outside of root,
+// or next to it with suffix if dir is empty. Existing backups are kept, and
+// the new one numbered after them.
+func backupPath(path, root, dir, suffix string) (string, error) {
+	backup := path + suffix
+	if dir != "" {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			rel = strings.TrimLeft(strings.TrimPrefix(path, filepath.VolumeName(path)), `/\`)
+		}
+		backup = filepath.Join(dir, rel)
+	}
+	for i := 0; ; i++ {
+		candidate := backup
+		if i > 0 {
+			candidate = fmt.Sprintf("%s.%d", backup, i)
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		} else if err != nil {
+			return "", fmt.Errorf("check backup %q: %w", candidate, err)
+		}
+	}
+}
+
+// backupFiles copies paths to their backups, and returns the backup of every
+// path.
+func backupFiles(paths []string, root, dir, suffix string) (map[string]string, error) {
+	backups := make(map[string]string, len(paths))
+	for _, path := range paths {
+		backup, err := backupPath(path, root, dir, suffix)
+		if err != nil {
+			return backups, err
+		}
+		if err = os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+			return backups, fmt.Errorf("create backup dir: %w", err)
+		}
+		if err = omitter.CopyFile(path, backup); err != nil {
+			return backups, fmt.Errorf("back up %q: %w", path, err)
+		}
+		backups[path] = backup
+	}
+	return backups, nil
+}
+
+// backupOverwritten backs up the files which carrying out pairs would
+// overwrite, if -backup or -backup-suffix is set, and reports them in
+// verbose mode.
+func backupOverwritten(cfg config, pairs map[string]string, actionName string) error {
+	if cfg.backupDir == "" && cfg.backupSuffix == "" {
+		return nil
+	}
+	backups, err := backupFiles(overwrittenFiles(pairs, actionName), cfg.options.path, cfg.backupDir, cfg.backupSuffix)
+	if err != nil {
+		return err
+	}
+	if cfg.withVerbose {
+		for _, path := range slices.Sorted(maps.Keys(backups)) {
+			fmt.Printf("Backed up %s to %s\n", path, backups[path])
+		}
+	}
+	return nil
+}
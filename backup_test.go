@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// TestBackupFiles verifies that only the files a run would overwrite are
+// backed up, and that earlier backups are kept.
+func TestBackupFiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := createTempFile(t, dir, "a_x.txt", "new a")
+	taken := createTempFile(t, dir, filepath.Join("sub", "a.txt"), "old a")
+	b := createTempFile(t, dir, "b_x.txt", "new b")
+	c := createTempFile(t, dir, "c.txt", "c")
+	pairs := map[string]string{a: taken, b: c, c: filepath.Join(dir, "d.txt")}
+
+	if got := overwrittenFiles(pairs, omitter.RENAME); !slices.Equal(got, []string{taken}) {
+		t.Errorf("expected only %s to be overwritten, got %v", taken, got)
+	}
+	if got := overwrittenFiles(pairs, omitter.COPY); !slices.Equal(got, []string{c, taken}) {
+		t.Errorf("expected %s and %s to be overwritten by copies, got %v", c, taken, got)
+	}
+
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	for _, want := range []string{"a.txt", "a.txt.1"} {
+		backups, err := backupFiles([]string{taken}, dir, backupDir, "")
+		if err != nil {
+			t.Fatalf("backup error: %v", err)
+		}
+		if backups[taken] != filepath.Join(backupDir, "sub", want) {
+			t.Errorf("expected the backup at %s, got %s", want, backups[taken])
+		}
+		if b, err := os.ReadFile(backups[taken]); err != nil || string(b) != "old a" {
+			t.Errorf("expected the content of %s to be backed up, error: %v", taken, err)
+		}
+	}
+
+	backups, err := backupFiles([]string{taken}, dir, "", ".bak")
+	if err != nil {
+		t.Fatalf("backup error: %v", err)
+	}
+	if backups[taken] != taken+".bak" {
+		t.Errorf("expected the backup next to %s, got %s", taken, backups[taken])
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Keys of the config file listing the named profiles and pipelines.
+const (
+	profilesKey  = "profiles"
+	pipelinesKey = "pipelines"
+)
+
+// confirmKey is the key of profiles which asks for confirmation of a dry run
+// before the profile is applied as a stage of a pipeline.
+const confirmKey = "confirm"
+
+// configFile holds flag values read from a config file: the defaults of every
+// run, the named profiles selected with -profile, and the pipelines of
+// -pipeline, which apply profiles one after the other as their stages.
+//
+// The file is a subset of YAML, with flag names as keys and scalar values:
+//
+//	v: true
+//	conflict-suffix: " (%d)"
+//	profiles:
+//	  photos:
+//	    type: images
+//	    template: "{date}_{counter:3}{ext}"
+//	    confirm: true
+//	pipelines:
+//	  tidy: sanitize, photos
+type configFile struct {
+	defaults  map[string]string
+	profiles  map[string]map[string]string
+	pipelines map[string][]string
+}
+
+// defaultConfigPath is the config file read when -config is not given, such
+// as ~/.config/omitter/config.yaml on Linux.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "omitter", "config.yaml")
+}
+
+func loadConfigFile(path string) (configFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return configFile{}, err
+	}
+	defer f.Close()
+	c, err := parseConfig(f)
+	if err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func parseConfig(r io.Reader) (configFile, error) {
+	c := configFile{
+		defaults:  make(map[string]string),
+		profiles:  make(map[string]map[string]string),
+		pipelines: make(map[string][]string),
+	}
+	var section string
+	var profile map[string]string
+	entryIndent := -1
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return c, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		indent := len(line) - len(trimmed)
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return c, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key = strings.TrimSpace(key)
+		value, err := configValue(value)
+		if err != nil {
+			return c, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		switch {
+		case indent == 0 && (key == profilesKey || key == pipelinesKey):
+			if value != "" {
+				return c, fmt.Errorf("line %d: %s holds %s, not a value", n, key, key)
+			}
+			section, profile, entryIndent = key, nil, -1
+		case indent == 0:
+			section = ""
+			c.defaults[key] = value
+		case section == pipelinesKey:
+			if entryIndent < 0 {
+				entryIndent = indent
+			}
+			if indent != entryIndent {
+				return c, fmt.Errorf("line %d: unexpected indent", n)
+			}
+			if _, ok := c.pipelines[key]; ok {
+				return c, fmt.Errorf("line %d: duplicate pipeline %q", n, key)
+			}
+			stages := splitList(value)
+			if len(stages) == 0 {
+				return c, fmt.Errorf("line %d: pipeline %q has no stages", n, key)
+			}
+			c.pipelines[key] = stages
+		case section != profilesKey:
+			return c, fmt.Errorf("line %d: unexpected indent", n)
+		case entryIndent < 0 || indent == entryIndent:
+			if value != "" {
+				return c, fmt.Errorf("line %d: profile %q holds flags, not a value", n, key)
+			}
+			if _, ok := c.profiles[key]; ok {
+				return c, fmt.Errorf("line %d: duplicate profile %q", n, key)
+			}
+			entryIndent = indent
+			profile = make(map[string]string)
+			c.profiles[key] = profile
+		case indent > entryIndent:
+			profile[key] = value
+		default:
+			return c, fmt.Errorf("line %d: unexpected indent", n)
+		}
+	}
+	return c, s.Err()
+}
+
+// configValue parses a scalar value, which is taken literally unless it is
+// quoted. Comments start with " #" outside of quotes.
+func configValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndexByte(s, '"')
+		if end == 0 || !isComment(s[end+1:]) {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndexByte(s, '\'')
+		if end == 0 || !isComment(s[end+1:]) {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return strings.ReplaceAll(s[1:end], "''", "'"), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// applyConfig sets the flags of fs which were not given on the command line
+// to their values in the config file at path, or the default one if path is
+// empty. The values of profile, if set, take precedence over the defaults.
+func applyConfig(fs *flag.FlagSet, path, profile string) error {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	c, err := loadConfigFile(path)
+	if err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c = configFile{}
+	}
+	values := c.defaults
+	if profile != "" {
+		p, ok := c.profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile: %q", profile)
+		}
+		values = make(map[string]string, len(c.defaults)+len(p))
+		maps.Copy(values, c.defaults)
+		maps.Copy(values, p)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for name, value := range values {
+		switch {
+		case name == "config" || name == "profile" || name == "pipeline":
+			return fmt.Errorf("%s can not be set in a config file", name)
+		case name == confirmKey:
+			// It only concerns pipelines.
+			continue
+		case fs.Lookup(name) == nil:
+			return fmt.Errorf("unknown flag in config: %q", name)
+		case given[name]:
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for flag -%s: %w", value, name, err)
+		}
+	}
+	return nil
+}
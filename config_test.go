@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestParseConfig verifies that defaults and profiles are read, and invalid
+// files refused.
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig(strings.NewReader(`# comment
+v: true
+conflict-suffix: " (%d)" # trailing comment
+window: 22:00-06:00
+profiles:
+  photos:
+    type: images
+    template: '{date}_{counter:3}{ext}'
+  music:
+    type: audio
+    confirm: true
+pipelines:
+  tidy: photos, music
+`))
+	if err != nil {
+		t.Fatalf("parse config error: %v", err)
+	}
+	if c.defaults["v"] != "true" || c.defaults["conflict-suffix"] != " (%d)" ||
+		c.defaults["window"] != "22:00-06:00" {
+		t.Errorf("unexpected defaults: %v", c.defaults)
+	}
+	if len(c.profiles) != 2 || c.profiles["photos"]["template"] != "{date}_{counter:3}{ext}" ||
+		c.profiles["music"]["type"] != "audio" {
+		t.Errorf("unexpected profiles: %v", c.profiles)
+	}
+	if stages := c.pipelines["tidy"]; !slices.Equal(stages, []string{"photos", "music"}) {
+		t.Errorf("unexpected pipeline stages: %v", stages)
+	}
+
+	for _, invalid := range []string{
+		"v true\n",
+		"  v: true\n",
+		"profiles: x\n",
+		"profiles:\n  a:\n    v: true\n  a:\n    v: false\n",
+		"s: \"unterminated\n",
+		"pipelines:\n  tidy:\n",
+		"pipelines:\n  tidy: a\n    b: c\n",
+	} {
+		if _, err := parseConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+// TestApplyConfig verifies that profiles override defaults, and flags given
+// on the command line override both.
+func TestApplyConfig(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := createTempFile(t, tempDir, "config.yaml", `s: one
+replace: two
+profiles:
+  p:
+    replace: three
+    v: true
+`)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s := fs.String("s", "", "")
+	replace := fs.String("replace", "", "")
+	v := fs.Bool("v", false, "")
+	if err = fs.Parse([]string{"-s", "given"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = applyConfig(fs, path, "p"); err != nil {
+		t.Fatalf("apply config error: %v", err)
+	}
+	if *s != "given" || *replace != "three" || !*v {
+		t.Errorf("unexpected values: s=%q replace=%q v=%v", *s, *replace, *v)
+	}
+	if err = applyConfig(fs, path, "missing"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+	if err = applyConfig(flag.NewFlagSet("test", flag.ContinueOnError), path, ""); err == nil {
+		t.Error("expected an error for unknown flags")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// conformanceKey identifies the options a plan is built from, so cached
+// verdicts are only reused by runs which would compute the same names. Times,
+// prompts, random sources and contexts, which vary from run to run, are left
+// out; patterns, templates and assertions are keyed by their text.
+func conformanceKey(opts omitter.Options) string {
+	abs, err := filepath.Abs(opts.Path)
+	if err != nil {
+		abs = opts.Path
+	}
+	key := opts
+	key.Path = abs
+	key.Pattern, key.Redact, key.AllowedChars = nil, nil, nil
+	key.Template, key.Location, key.Number = nil, nil, nil
+	key.Substitutions, key.Assert = nil, nil
+	key.AskConflict, key.Prompter, key.Clock, key.Context = nil, nil, nil, nil
+	key.Rand = nil
+	key.ConflictSuffix.Time = time.Time{}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%+v|%v|%v|%v|%v|%v|%t", key,
+		opts.Pattern, opts.Redact, opts.AllowedChars, opts.Template, opts.Location,
+		opts.AskConflict != nil)
+	if opts.Number != nil {
+		fmt.Fprintf(h, "|%+v", *opts.Number)
+	}
+	for _, s := range opts.Substitutions {
+		fmt.Fprintf(h, "|s%q|%v|%q|%d|%d", s.Str, s.Pattern, s.Replace, s.Occurrence, s.Count)
+	}
+	for _, a := range opts.Assert {
+		fmt.Fprintf(h, "|a%q", a.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func conformanceCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "omitter", "conformance.json"), nil
+}
+
+// loadConformanceCache maps cache keys to the modification times, in unix
+// nanoseconds, of every dir of a tree which was found to conform.
+func loadConformanceCache() (map[string]map[string]int64, error) {
+	cache := make(map[string]map[string]int64)
+	path, err := conformanceCachePath()
+	if err != nil {
+		return cache, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return cache, err
+	}
+	if err = json.Unmarshal(b, &cache); err != nil {
+		return make(map[string]map[string]int64), err
+	}
+	return cache, nil
+}
+
+// conformsCached reports whether a tree was found to conform before and none
+// of its dirs was modified since. Any rename, creation or deletion of a file
+// or dir changes the modification time of its parent.
+func conformsCached(key string) bool {
+	cache, err := loadConformanceCache()
+	if err != nil {
+		return false
+	}
+	dirs, ok := cache[key]
+	if !ok || len(dirs) == 0 {
+		return false
+	}
+	for dir, mtime := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || info.ModTime().UnixNano() != mtime {
+			return false
+		}
+	}
+	return true
+}
+
+func cacheConformance(key, root string) error {
+	dirs := make(map[string]int64)
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case !file.IsDir():
+				return nil
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			dirs[path] = info.ModTime().UnixNano()
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	cache, _ := loadConformanceCache()
+	cache[key] = dirs
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	path, err := conformanceCachePath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	CTL_PAUSE  string = "pause"
+	CTL_RESUME string = "resume"
+	CTL_STATUS string = "status"
+	CTL_STOP   string = "stop"
+)
+
+// errStopped is returned by the actions when a stop was requested through
+// the control socket.
+var errStopped = errors.New("stopped by control request")
+
+// controller lets another process pause, resume or stop a running execution.
+// A nil controller never pauses nor stops.
+type controller struct {
+	mu      sync.Mutex
+	resumed *sync.Cond
+	paused  bool
+	stopped bool
+	done    int
+	total   int
+}
+
+func newController(total int) *controller {
+	c := &controller{total: total}
+	c.resumed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Checkpoint blocks while the execution is paused, and returns errStopped
+// once a stop was requested.
+func (c *controller) Checkpoint() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.stopped {
+		c.resumed.Wait()
+	}
+	if c.stopped {
+		return errStopped
+	}
+	return nil
+}
+
+// Advance records a processed file.
+func (c *controller) Advance() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.done++
+	c.mu.Unlock()
+}
+
+// handle applies a control command and returns the reply to it.
+func (c *controller) handle(cmd string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch cmd {
+	case CTL_PAUSE:
+		c.paused = true
+	case CTL_RESUME:
+		c.paused = false
+		c.resumed.Broadcast()
+	case CTL_STOP:
+		c.stopped = true
+		c.resumed.Broadcast()
+	case CTL_STATUS:
+	default:
+		return fmt.Sprintf("unknown command: %q", cmd)
+	}
+
+	state := "running"
+	switch {
+	case c.stopped:
+		state = "stopping"
+	case c.paused:
+		state = "paused"
+	}
+	if c.total == 0 {
+		// Streamed runs do not know their total.
+		return fmt.Sprintf("%s, %d file(s) processed", state, c.done)
+	}
+	return fmt.Sprintf("%s, %d/%d file(s) processed", state, c.done, c.total)
+}
+
+// serve answers control commands on the unix socket at path, one command per
+// connection, until the returned close function is called.
+func (c *controller) serve(path string) (func() error, error) {
+	// A socket left behind by an execution which exited abruptly is stale,
+	// as nothing answers on it anymore.
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %q is in use", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on control socket: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil && line == "" {
+					return
+				}
+				fmt.Fprintln(conn, c.handle(strings.TrimSpace(line)))
+			}()
+		}
+	}()
+	return l.Close, nil
+}
+
+// sendControl sends cmd to the execution listening on the socket at path and
+// returns its reply.
+func sendControl(path, cmd string) (string, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return "", fmt.Errorf("connect to control socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err = fmt.Fprintln(conn, cmd); err != nil {
+		return "", fmt.Errorf("send command: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("read reply: %w", err)
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+func ctl(args []string) {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := flags.String("socket", "", "control socket of the running execution")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: omitter ctl -socket PATH pause|resume|status|stop")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *socket == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	reply, err := sendControl(*socket, flags.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	fmt.Println(reply)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestControllerPauseResume verifies that a paused execution waits until resumed.
+func TestControllerPauseResume(t *testing.T) {
+	c := newController(2)
+	c.handle(CTL_PAUSE)
+
+	passed := make(chan error)
+	go func() { passed <- c.Checkpoint() }()
+	select {
+	case <-passed:
+		t.Fatal("expected checkpoint to block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.handle(CTL_RESUME)
+	select {
+	case err := <-passed:
+		if err != nil {
+			t.Errorf("expected checkpoint to pass after resume, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected checkpoint to pass after resume")
+	}
+
+	c.Advance()
+	if status := c.handle(CTL_STATUS); status != "running, 1/2 file(s) processed" {
+		t.Errorf("unexpected status: %q", status)
+	}
+
+	c.handle(CTL_STOP)
+	if err := c.Checkpoint(); !errors.Is(err, errStopped) {
+		t.Errorf("expected errStopped, got: %v", err)
+	}
+
+	var nilController *controller
+	if err := nilController.Checkpoint(); err != nil {
+		t.Errorf("expected nil controller to never stop, got: %v", err)
+	}
+}
+
+// TestControlSocket verifies sending commands over the control socket.
+func TestControlSocket(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	socket := filepath.Join(tempDir, "omitter.sock")
+
+	c := newController(3)
+	closeControl, err := c.serve(socket)
+	if err != nil {
+		t.Fatalf("serve error: %v", err)
+	}
+	defer closeControl()
+
+	reply, err := sendControl(socket, CTL_PAUSE)
+	if err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if !strings.HasPrefix(reply, "paused") {
+		t.Errorf("expected paused reply, got %q", reply)
+	}
+
+	reply, err = sendControl(socket, "jump")
+	if err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if !strings.HasPrefix(reply, "unknown command") {
+		t.Errorf("expected unknown command reply, got %q", reply)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the bytes available to the current user on the
+// filesystem holding path.
+func freeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("statfs %q: %w", path, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
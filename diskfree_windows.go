@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the bytes available to the current user on the volume
+// holding path.
+func freeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, fmt.Errorf("convert path %q: %w", path, err)
+	}
+	var available uint64
+	if err = windows.GetDiskFreeSpaceEx(p, &available, nil, nil); err != nil {
+		return 0, fmt.Errorf("get free space of %q: %w", path, err)
+	}
+	return available, nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// execute carries out pairs as set in cfg, exiting if it fails. It returns
+// the timer of the operations, if they are timed.
+func execute(cfg config, pairs map[string]string, actionName string) *opTimer {
+	var err error
+	if err = backupOverwritten(cfg, pairs, actionName); err != nil {
+		fmt.Println("back up:", err)
+		os.Exit(2)
+	}
+	trashed, err := trashOverwritten(cfg, pairs, actionName)
+	if err != nil {
+		fmt.Println("move to trash:", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptible(cfg.deadline)
+	defer stop()
+	opts, timer, rec, closeControl := execOptions(cfg, actionName, len(pairs))
+	defer closeControl()
+	opts.Context = ctx
+	saveJournal := func() {
+		if err := rec.save(); err != nil {
+			fmt.Println("save journal:", err)
+		}
+	}
+	var done doneRecorder
+	if cfg.format == FORMAT_JSON {
+		done = make(doneRecorder, len(pairs))
+		opts.After = omitter.ChainAfter(opts.After, done.record)
+	}
+	if cfg.options.staging != "" {
+		start := time.Now()
+		n, err := omitter.Stage(cfg.options.path, cfg.options.staging, pairs, opts.After)
+		saveJournal()
+		if cfg.format == FORMAT_JSON {
+			printReport(resultReport(pairs, actionName, done, err, false), cfg.tags)
+		}
+		if err != nil {
+			if cfg.format != FORMAT_JSON {
+				fmt.Println("Staging:", err)
+			}
+			os.Exit(2)
+		}
+		if cfg.withVerbose {
+			fmt.Printf("Renamed %d file(s) through staging in %s.\n", n, time.Since(start))
+		}
+	} else {
+		res, err := omitter.Plan{Pairs: pairs}.Apply(actionName, opts)
+		if err != nil && cfg.withAtomic {
+			if cfg.format != FORMAT_JSON {
+				printRunError(actionName, err)
+			}
+			n, rbErr := rec.rollback()
+			saveJournal()
+			// Files are only restored from the trash once the files of the
+			// run are out of their way.
+			var restoreErr error
+			if rbErr == nil {
+				restoreErr = restoreTrashed(trashed)
+			}
+			if cfg.format == FORMAT_JSON {
+				printReport(resultReport(pairs, actionName, done, err, rbErr == nil), cfg.tags)
+				if restoreErr != nil {
+					os.Exit(2)
+				}
+				os.Exit(exitCode(err))
+			}
+			if rbErr != nil {
+				fmt.Println("Rollback:", rbErr)
+				fmt.Printf("%d of %d file(s) were rolled back, undo the rest with -undo.\n", n, res.Count)
+				os.Exit(2)
+			}
+			if restoreErr != nil {
+				fmt.Printf("%d file(s) were rolled back.\n", n)
+				fmt.Println("Restore from trash:", restoreErr)
+				os.Exit(2)
+			}
+			fmt.Printf("%d file(s) were rolled back.\n", n)
+			os.Exit(exitCode(err))
+		}
+		saveJournal()
+		if cfg.format == FORMAT_JSON {
+			printReport(resultReport(pairs, actionName, done, err, false), cfg.tags)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		}
+		if err != nil {
+			printRunError(actionName, err)
+			fmt.Printf("%d file(s) were %s.\n", res.Count, pastTense[actionName])
+			os.Exit(exitCode(err))
+		}
+		if cfg.withVerbose {
+			fmt.Printf("%d file(s) were %s in %s.\n", res.Count, pastTense[actionName], res.Elapsed)
+		}
+	}
+	return timer
+}
+
+// finish reports the slowest operations of the run and fixes the symlinks to
+// the renamed files, as set in cfg.
+func finish(cfg config, pairs map[string]string, actionName string, timer *opTimer) {
+	if timer != nil && cfg.withVerbose && cfg.slowest > 0 {
+		slowest := timer.slowest(cfg.slowest)
+		if len(slowest) > 0 {
+			fmt.Printf("Slowest %d operation(s):\n", len(slowest))
+			for _, op := range slowest {
+				fmt.Printf("  %s: %s\n", op.oldName, op.elapsed)
+			}
+		}
+	}
+
+	if cfg.options.fixSymlinks != "" && actionName != omitter.COPY {
+		fixed, err := fixSymlinks(cfg.options.fixSymlinks, pairs)
+		if err != nil {
+			fmt.Println("Fixing symlinks:", err)
+			fmt.Printf("%d symlink(s) were fixed.\n", fixed)
+			os.Exit(2)
+		}
+		if cfg.withVerbose {
+			fmt.Printf("Fixed %d symlink(s).\n", fixed)
+		}
+	}
+}
+
+// opTiming is the latency of a single file operation.
+type opTiming struct {
+	oldName string
+	elapsed time.Duration
+}
+
+// opTimer records the latency of every file operation, and warns about the
+// ones taking longer than warnAfter, if set.
+type opTimer struct {
+	warnAfter time.Duration
+	ops       []opTiming
+}
+
+func (t *opTimer) record(oldName, _ string, elapsed time.Duration) error {
+	t.ops = append(t.ops, opTiming{oldName: oldName, elapsed: elapsed})
+	if t.warnAfter > 0 && elapsed > t.warnAfter {
+		fmt.Printf("\nWarning: %s took %s\n", oldName, elapsed)
+	}
+	return nil
+}
+
+// slowest returns the n slowest recorded operations, slowest first.
+func (t *opTimer) slowest(n int) []opTiming {
+	ops := slices.Clone(t.ops)
+	slices.SortFunc(ops, func(a, b opTiming) int {
+		return cmp.Compare(b.elapsed, a.elapsed)
+	})
+	return ops[:min(n, len(ops))]
+}
+
+// stream plans and carries out the run one file at a time, without holding
+// the plan in memory.
+func stream(cfg config, pattern *regexp.Regexp) {
+	actionName := getActionName(cfg.options.output, cfg.options.transmissionType)
+	ctx, stop := interruptible(cfg.deadline)
+	defer stop()
+	planOpts := cfg.planOptions(pattern)
+	planOpts.Context = ctx
+	pairs := omitter.Stream(planOpts, ignoredNames...)
+	if cfg.withDryRun {
+		var n int
+		for p, err := range pairs {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				printRunError("walk dir", err)
+				os.Exit(exitCode(err))
+			}
+			if err != nil {
+				fmt.Println("walk dir:", err)
+				os.Exit(exitCode(err))
+			}
+			n++
+			if cfg.withVerbose {
+				fmt.Printf("%s -> %s\n", p.Old, p.New)
+			}
+		}
+		if n == 0 {
+			fmt.Println("Already conforms, nothing to do.")
+			os.Exit(exitNothingToDo)
+		}
+		fmt.Printf("Found %d file(s) to %s!\n", n, actionName)
+		return
+	}
+
+	opts, _, rec, closeControl := execOptions(cfg, actionName, 0)
+	defer closeControl()
+	opts.Context = ctx
+	res, err := omitter.ApplyStream(actionName, pairs, opts)
+	if err != nil && cfg.withAtomic {
+		printRunError(actionName, err)
+		n, rbErr := rec.rollback()
+		if err := rec.save(); err != nil {
+			fmt.Println("save journal:", err)
+		}
+		if rbErr != nil {
+			fmt.Println("Rollback:", rbErr)
+			fmt.Printf("%d of %d file(s) were rolled back, undo the rest with -undo.\n", n, res.Count)
+			os.Exit(2)
+		}
+		fmt.Printf("%d file(s) were rolled back.\n", n)
+		os.Exit(exitCode(err))
+	}
+	if err := rec.save(); err != nil {
+		fmt.Println("save journal:", err)
+	}
+	if err != nil {
+		printRunError(actionName, err)
+		fmt.Printf("%d file(s) were %s.\n", res.Count, pastTense[actionName])
+		os.Exit(exitCode(err))
+	}
+	if res.Count == 0 {
+		fmt.Println("Already conforms, nothing to do.")
+		os.Exit(exitNothingToDo)
+	}
+	if cfg.withVerbose {
+		fmt.Printf("%d file(s) were %s in %s.\n", res.Count, pastTense[actionName], res.Elapsed)
+	}
+}
+
+// interruptible returns a context which is done once the process is
+// interrupted, or asked to stop by the Windows service manager, or at
+// deadline if it is set, and the function restoring the default handling of
+// interrupts, which terminate it.
+func interruptible(deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(serviceContext, os.Interrupt, syscall.SIGTERM)
+	if deadline.IsZero() {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// printRunError prints err of a run of actionName, or that it was
+// interrupted or timed out.
+func printRunError(actionName string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Println("Interrupted.")
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Println("Timed out.")
+		return
+	}
+	fmt.Printf("%s: %v\n", actionName, err)
+}
+
+// exitCode returns the exit code of a run which failed with err, by the kind
+// of the error.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, omitter.ErrConflict):
+		return exitConflict
+	case errors.Is(err, omitter.ErrInvalidName):
+		return exitInvalidName
+	case errors.Is(err, omitter.ErrSkipped):
+		return exitSkipped
+	case errors.Is(err, omitter.ErrCrossDevice):
+		return exitCrossDevice
+	case errors.Is(err, omitter.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	}
+	return 2
+}
+
+// execOptions returns the options executing total files with actionName,
+// along with the timer and the journal recorder hooked into them, and the
+// function closing the control socket.
+func execOptions(cfg config, actionName string, total int) (omitter.ExecOptions, *opTimer, *journalRecorder, func() error) {
+	after, err := rememberOriginal(cfg.options.rememberOriginal)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var timer *opTimer
+	if cfg.withVerbose || cfg.warnSlowerThan > 0 {
+		timer = &opTimer{warnAfter: cfg.warnSlowerThan}
+		after = omitter.ChainAfter(after, timer.record)
+	}
+
+	rec := newJournalRecorder(cfg.options.path, actionName)
+	rec.run.Tags, rec.key = cfg.tags, cfg.journalKey
+	rec.path = cfg.journalPath()
+	after = omitter.ChainAfter(after, rec.record)
+
+	opts := omitter.ExecOptions{
+		After: after, Chunks: cfg.copyChunks, Order: cfg.order, Workers: cfg.workers,
+		HideProgress: cfg.format == FORMAT_JSON, Rand: cfg.random,
+	}
+	if cfg.window != "" {
+		opts.Window, err = omitter.ParseWindow(cfg.window)
+		if err != nil {
+			fmt.Println("parse window:", err)
+			os.Exit(1)
+		}
+	}
+	closeControl := func() error { return nil }
+	if cfg.controlSocket != "" {
+		control := newController(total)
+		closeControl, err = control.serve(cfg.controlSocket)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		opts.Control = control
+	}
+	opts.CopyMetadata, err = copyMetadata(actionName, cfg.preserve, cfg.withRestorecon)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	opts.KeepTimes = slices.Contains(splitList(cfg.preserve), PRESERVE_TIMES)
+	opts.OpTimeout, opts.OnTimeout, opts.Stalled = cfg.opTimeout, cfg.onTimeout, rec.stall
+	opts.MaxOpenFiles, opts.MaxMemory = cfg.maxOpenFiles, cfg.memoryLimit
+	return opts, timer, rec, closeControl
+}
+
+// copyMetadata returns the function carrying the metadata of files over to
+// their copies, according to action and the comma separated preserve list. It
+// returns nil if there is nothing to carry over.
+func copyMetadata(action, preserve string, withRestorecon bool) (func(src, dst string) error, error) {
+	var funcs []func(src, dst string) error
+	if action == omitter.MOVE {
+		if withRestorecon {
+			funcs = append(funcs, restorecon)
+		} else {
+			funcs = append(funcs, preserveSELinux)
+		}
+	}
+	for _, m := range strings.Split(preserve, ",") {
+		switch strings.TrimSpace(m) {
+		case "":
+		case PRESERVE_ACL:
+			funcs = append(funcs, preserveACL)
+		case PRESERVE_OWNER:
+			funcs = append(funcs, preserveOwner)
+		case PRESERVE_TIMES:
+			// The engine keeps them, after the others.
+		default:
+			return nil, fmt.Errorf("unknown preserve mode: %q", m)
+		}
+	}
+	if len(funcs) == 0 {
+		return nil, nil
+	}
+	return func(src, dst string) error {
+		for _, f := range funcs {
+			if err := f(src, dst); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// fixSymlinks walks root and points every symlink targeting an old path of
+// pairs to its new path. Relative links stay relative.
+func fixSymlinks(root string, pairs map[string]string) (uint, error) {
+	renamed := make(map[string]string, len(pairs))
+	for oldName, newName := range pairs {
+		oldAbs, err := filepath.Abs(oldName)
+		if err != nil {
+			return 0, fmt.Errorf("resolve absolute path: %w", err)
+		}
+		newAbs, err := filepath.Abs(newName)
+		if err != nil {
+			return 0, fmt.Errorf("resolve absolute path: %w", err)
+		}
+		renamed[oldAbs] = newAbs
+	}
+
+	var fixed uint
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case file.Type()&fs.ModeSymlink == 0:
+				return nil
+			}
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("read link %q: %w", path, err)
+			}
+			linkDir, err := filepath.Abs(filepath.Dir(path))
+			if err != nil {
+				return fmt.Errorf("resolve absolute path: %w", err)
+			}
+			target := link
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(linkDir, target)
+			}
+			newTarget, ok := renamed[filepath.Clean(target)]
+			if !ok {
+				return nil
+			}
+			if !filepath.IsAbs(link) {
+				newTarget, err = filepath.Rel(linkDir, newTarget)
+				if err != nil {
+					return fmt.Errorf("relative target of %q: %w", path, err)
+				}
+			}
+
+			tmp := path + ".omitter-tmp"
+			if err = os.Symlink(newTarget, tmp); err != nil {
+				return fmt.Errorf("create link %q: %w", tmp, err)
+			}
+			if err = os.Rename(tmp, path); err != nil {
+				os.Remove(tmp)
+				return fmt.Errorf("replace link %q: %w", path, err)
+			}
+			fixed++
+			return nil
+		})
+	return fixed, err
+}
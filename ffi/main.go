@@ -0,0 +1,97 @@
+//go:build cgo
+
+// Command ffi is the engine of omitter built as a C shared library, so
+// programs in other languages can plan renames with the same outcome as the
+// command without running it. Functions take and return JSON in C strings,
+// and returned strings are freed with OmitterFree.
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"unsafe"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// journalName is the journal of the command, which is never renamed.
+const journalName = ".omitter-journal.json"
+
+// pair is a file of a plan and its new path.
+type pair struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// response is what the functions return, as JSON. Only the fields of the
+// function are set.
+type response struct {
+	Proposals []omitter.Proposal    `json:"proposals,omitempty"`
+	Pairs     []pair                `json:"pairs,omitempty"`
+	Skipped   []omitter.SkippedFile `json:"skipped,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+func main() {}
+
+// OmitterPropose returns the proposals of omitter.ProposeNames for a JSON
+// array of names, under rules keyed by the flags of the command.
+//
+//export OmitterPropose
+func OmitterPropose(names, rules *C.char) *C.char {
+	var list []string
+	if err := json.Unmarshal([]byte(C.GoString(names)), &list); err != nil {
+		return encode(response{Error: err.Error()})
+	}
+	opts, err := omitter.ParseRules([]byte(C.GoString(rules)))
+	if err != nil {
+		return encode(response{Error: err.Error()})
+	}
+	proposals, err := omitter.ProposeNames(list, opts)
+	if err != nil {
+		return encode(response{Error: err.Error()})
+	}
+	return encode(response{Proposals: proposals})
+}
+
+// OmitterPlan walks the dir at path, and returns the pairs of files to be
+// renamed under rules keyed by the flags of the command, along with the
+// skipped files. Nothing is renamed.
+//
+//export OmitterPlan
+func OmitterPlan(path, rules *C.char) *C.char {
+	opts, err := omitter.ParseRules([]byte(C.GoString(rules)))
+	if err != nil {
+		return encode(response{Error: err.Error()})
+	}
+	opts.Path = C.GoString(path)
+	plan, err := omitter.NewPlan(opts, journalName)
+	if err != nil {
+		return encode(response{Error: err.Error()})
+	}
+	r := response{Skipped: plan.Skipped}
+	for _, oldName := range slices.Sorted(maps.Keys(plan.Pairs)) {
+		r.Pairs = append(r.Pairs, pair{Old: oldName, New: plan.Pairs[oldName]})
+	}
+	return encode(r)
+}
+
+// OmitterFree frees a string returned by the other functions.
+//
+//export OmitterFree
+func OmitterFree(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// encode returns r as a C string, which the caller frees.
+func encode(r response) *C.char {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return C.CString(`{"error":"encode response"}`)
+	}
+	return C.CString(string(b))
+}
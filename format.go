@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// Output formats of -format.
+const (
+	FORMAT_TEXT string = "text"
+	FORMAT_JSON string = "json"
+)
+
+// Statuses of files in JSON reports.
+const (
+	STATUS_PLANNED     string = "planned"
+	STATUS_DONE        string = "done"
+	STATUS_FAILED      string = "failed"
+	STATUS_PENDING     string = "pending"
+	STATUS_ROLLED_BACK string = "rolled_back"
+)
+
+// jsonReport is the outcome of a run in -format json.
+type jsonReport struct {
+	// Tags are the key=value pairs of -tag.
+	Tags  map[string]string `json:"tags,omitempty"`
+	Files []jsonFile        `json:"files"`
+	// Error is the error which stopped the run, if any.
+	Error string `json:"error,omitempty"`
+}
+
+type jsonFile struct {
+	Old    string `json:"old"`
+	New    string `json:"new,omitempty"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// doneRecorder is an AfterFunc collecting the files which were processed.
+type doneRecorder map[string]bool
+
+func (d doneRecorder) record(oldName, _ string, _ time.Duration) error {
+	d[oldName] = true
+	return nil
+}
+
+// planReport reports every file of pairs as planned.
+func planReport(pairs map[string]string, action string) jsonReport {
+	r := jsonReport{Files: []jsonFile{}}
+	for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+		r.Files = append(r.Files, jsonFile{
+			Old: oldName, New: pairs[oldName], Action: action, Status: STATUS_PLANNED,
+		})
+	}
+	return r
+}
+
+// resultReport reports the files of pairs as done, failed with the
+// omitter.FileError of err about them, or pending. Done files are reported
+// as rolled back instead if rolledBack is set.
+func resultReport(pairs map[string]string, action string, done doneRecorder,
+	err error, rolledBack bool,
+) jsonReport {
+	failed := make(map[string]string)
+	for _, fe := range fileErrors(err) {
+		failed[fe.Old] = fe.Err.Error()
+	}
+
+	r := planReport(pairs, action)
+	for i, f := range r.Files {
+		switch {
+		case done[f.Old] && rolledBack:
+			r.Files[i].Status = STATUS_ROLLED_BACK
+		case done[f.Old]:
+			r.Files[i].Status = STATUS_DONE
+		case failed[f.Old] != "":
+			r.Files[i].Status = STATUS_FAILED
+			r.Files[i].Error = failed[f.Old]
+		default:
+			r.Files[i].Status = STATUS_PENDING
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// fileErrors returns the errors about single files within err, which may
+// join several.
+func fileErrors(err error) []*omitter.FileError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []*omitter.FileError
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, fileErrors(err)...)
+		}
+		return errs
+	}
+	var fe *omitter.FileError
+	if errors.As(err, &fe) {
+		return []*omitter.FileError{fe}
+	}
+	return nil
+}
+
+func writeReport(w io.Writer, r jsonReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// formatTags writes tags as " (key=value, ...)", sorted by key, to follow
+// what they are about, or returns an empty string if there are none.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
+
+// printReport writes r, tagged with tags, to stdout, or exits if it can not.
+func printReport(r jsonReport, tags map[string]string) {
+	r.Tags = tags
+	if err := writeReport(os.Stdout, r); err != nil {
+		fmt.Println("write report:", err)
+		os.Exit(2)
+	}
+}
+
+// textOnlyFlags returns the flags of cfg which print or prompt in text, and
+// so can not be used with -format json.
+func textOnlyFlags(cfg config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"v":                       cfg.withVerbose,
+		"i":                       cfg.withInteractive,
+		"confirm-each":            cfg.withConfirmEach,
+		"tui":                     cfg.withTUI,
+		"scan-summary":            cfg.withScanSummary,
+		"estimate":                cfg.withEstimate,
+		"summary-dirs":            cfg.withSummaryDirs,
+		"group-by-capture":        cfg.groupByCapture != 0,
+		"remap-capture":           cfg.remapCapture != 0,
+		"check-hardlinks":         cfg.options.checkHardlinks != "",
+		"warn-slower-than":        cfg.warnSlowerThan > 0,
+		"on-conflict prompt":      cfg.options.onConflict == omitter.CONFLICT_PROMPT,
+		"on-conflict ask-per-dir": cfg.options.onConflict == omitter.CONFLICT_ASK_PER_DIR,
+	} {
+		if set {
+			flags = append(flags, "-"+name)
+		}
+	}
+	slices.Sort(flags)
+	return flags
+}
@@ -2,9 +2,10 @@ module github.com/hossein1376/omitter
 
 go 1.24.0
 
-require github.com/pooulad/ravan v0.0.4
-
 require (
-	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/pooulad/ravan v0.0.4
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
+	golang.org/x/text v0.25.0
 )
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileID is not available on this platform, so hard links are never found.
+func fileID(info fs.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioWhoProcess = 1
+)
+
+// setIOPriority sets the ionice class of every thread of the process. Threads
+// started later inherit it from the thread creating them.
+func setIOPriority(priority string) error {
+	var prio uintptr
+	switch priority {
+	case IO_PRIORITY_IDLE:
+		prio = ioprioClassIdle << ioprioClassShift
+	case IO_PRIORITY_LOW:
+		prio = ioprioClassBE<<ioprioClassShift | 7
+	case IO_PRIORITY_NORMAL:
+		prio = ioprioClassBE<<ioprioClassShift | 4
+	default:
+		return fmt.Errorf("unknown io priority: %q", priority)
+	}
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("list threads: %w", err)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		_, _, errno := unix.Syscall(
+			unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), prio,
+		)
+		if errno != 0 && errno != unix.ESRCH {
+			return fmt.Errorf("set io priority: %w", errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import "fmt"
+
+func setIOPriority(priority string) error {
+	if priority == IO_PRIORITY_NORMAL {
+		return nil
+	}
+	return fmt.Errorf("io priority %q is not supported on this platform", priority)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// setIOPriority puts the process in background processing mode, which lowers
+// its IO and memory priority, for the idle and low priorities.
+func setIOPriority(priority string) error {
+	switch priority {
+	case IO_PRIORITY_NORMAL:
+		return nil
+	case IO_PRIORITY_IDLE, IO_PRIORITY_LOW:
+	default:
+		return fmt.Errorf("unknown io priority: %q", priority)
+	}
+
+	process, err := windows.GetCurrentProcess()
+	if err != nil {
+		return fmt.Errorf("get current process: %w", err)
+	}
+	if err = windows.SetPriorityClass(process, windows.PROCESS_MODE_BACKGROUND_BEGIN); err != nil {
+		return fmt.Errorf("set background mode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"cmp"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// journalName is the file in the walked dir, or in -journal-dir, which
+// records the runs.
+const journalName = ".omitter-journal.json"
+
+// lockSuffix is appended to the path of a journal for its lock file.
+const lockSuffix = ".lock"
+
+const (
+	// journalLockTimeout is how long a run waits for another one to release
+	// the lock of a journal, which undos hold while files are restored.
+	journalLockTimeout = 2 * time.Minute
+	// staleLockAge is the age of the locks left over by runs which crashed,
+	// which are broken.
+	staleLockAge = 30 * time.Minute
+)
+
+// journal records the file operations of past runs, most recent last.
+type journal struct {
+	Runs []journalRun `json:"runs"`
+}
+
+type journalRun struct {
+	// ID tells runs apart, to undo a given one of a shared journal.
+	ID     string    `json:"id,omitempty"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Root is the absolute path dir of the run, and User and Host who ran
+	// it where, as several share a journal with -journal-dir.
+	Root string `json:"root,omitempty"`
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+	// Tags are the key=value pairs of -tag, such as the ticket of the
+	// change.
+	Tags    map[string]string `json:"tags,omitempty"`
+	Entries []journalEntry    `json:"entries"`
+	// Stalled are the operations which timed out, and may have completed
+	// after the run.
+	Stalled []journalEntry `json:"stalled,omitempty"`
+	// Signature is the Ed25519 signature of the run by -sign-key, chained
+	// to the one of the run before it, in base64.
+	Signature string `json:"signature,omitempty"`
+}
+
+type journalEntry struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// journalRecorder collects the operations of the current run.
+type journalRecorder struct {
+	mu   sync.Mutex
+	path string
+	run  journalRun
+	// key, if set, signs the run when it is saved.
+	key ed25519.PrivateKey
+}
+
+// newJournalRecorder returns a recorder of a run in root, saved to the
+// journal in root.
+func newJournalRecorder(root, action string) *journalRecorder {
+	now := time.Now()
+	run := journalRun{ID: newRunID(now), Time: now, Action: action, User: currentUser()}
+	run.Root, _ = filepath.Abs(root)
+	run.Host, _ = os.Hostname()
+	return &journalRecorder{path: filepath.Join(root, journalName), run: run}
+}
+
+// newRunID returns an ID for a run started at now: its time, followed by
+// random hex digits to tell apart runs started at once.
+func newRunID(now time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return now.Format("20060102-150405-") + hex.EncodeToString(b)
+}
+
+// currentUser returns the name of the user running omitter, or an empty
+// string if it is unknown.
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// lockJournal takes the lock of the journal at path, waiting for other runs
+// holding it, and returns the function releasing it. The lock is a file
+// created exclusively next to the journal, which works on network shares as
+// well, and names its holder.
+func lockJournal(path string) (func(), error) {
+	lock := path + lockSuffix
+	host, _ := os.Hostname()
+	deadline := time.Now().Add(journalLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%s@%s pid %d\n", currentUser(), host, os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lock journal: %w", err)
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder, _ := os.ReadFile(lock)
+			return nil, fmt.Errorf("journal %q is locked by %s", path, strings.TrimSpace(string(holder)))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// record is an AfterFunc adding an operation to the run.
+func (r *journalRecorder) record(oldName, newName string, _ time.Duration) error {
+	oldAbs, err := filepath.Abs(oldName)
+	if err != nil {
+		return fmt.Errorf("resolve absolute path: %w", err)
+	}
+	newAbs, err := filepath.Abs(newName)
+	if err != nil {
+		return fmt.Errorf("resolve absolute path: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Entries = append(r.run.Entries, journalEntry{Old: oldAbs, New: newAbs})
+	return nil
+}
+
+// stall adds an operation which timed out to the run.
+func (r *journalRecorder) stall(oldName, newName string) {
+	oldAbs, _ := filepath.Abs(oldName)
+	newAbs, _ := filepath.Abs(newName)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Stalled = append(r.run.Stalled, journalEntry{Old: oldAbs, New: newAbs})
+}
+
+// rollback reverses the operations recorded so far, which are then no longer
+// saved. On failure, the operations are kept to be saved and undone later.
+func (r *journalRecorder) rollback() (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pairs, err := r.run.reversePairs()
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.run.reverse(pairs)
+	if err != nil {
+		// Only keep what is left to undo.
+		var left []journalEntry
+		for _, e := range r.run.Entries {
+			if _, err := os.Lstat(e.New); err == nil {
+				left = append(left, e)
+			}
+		}
+		r.run.Entries = left
+		return n, err
+	}
+	r.run.Entries = nil
+	return n, nil
+}
+
+// save appends the run to the journal, unless nothing was done.
+func (r *journalRecorder) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.run.Entries) == 0 && len(r.run.Stalled) == 0 {
+		return nil
+	}
+	unlock, err := lockJournal(r.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	j, err := loadJournal(r.path)
+	if err != nil {
+		return err
+	}
+	run := r.run
+	if r.key != nil {
+		var prev string
+		if len(j.Runs) > 0 {
+			prev = j.Runs[len(j.Runs)-1].Signature
+		}
+		if run.Signature, err = signRun(run, prev, r.key); err != nil {
+			return err
+		}
+	}
+	j.Runs = append(j.Runs, run)
+	return writeJournal(r.path, j)
+}
+
+func loadJournal(path string) (journal, error) {
+	var j journal
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return j, fmt.Errorf("read journal: %w", err)
+	}
+	if err = json.Unmarshal(b, &j); err != nil {
+		return j, fmt.Errorf("unmarshal journal: %w", err)
+	}
+	return j, nil
+}
+
+// writeJournal replaces the journal at path, or removes it if it is empty.
+func writeJournal(path string, j journal) error {
+	if len(j.Runs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove journal: %w", err)
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal journal: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace journal: %w", err)
+	}
+	return nil
+}
+
+// findRun returns the index in j of the run of id, or if empty, of the
+// latest run in root.
+func (j journal) findRun(root, id string) (int, error) {
+	if id != "" {
+		i := slices.IndexFunc(j.Runs, func(run journalRun) bool {
+			return run.ID == id
+		})
+		if i < 0 {
+			return 0, fmt.Errorf("no run %q in the journal", id)
+		}
+		return i, nil
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return 0, err
+	}
+	// Runs journaled before runs had a root are of the dir of the journal.
+	for i := len(j.Runs) - 1; i >= 0; i-- {
+		if j.Runs[i].Root == "" || j.Runs[i].Root == abs {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no run to undo in %q", root)
+}
+
+// undoPlan returns the run of id in the journal at path, or the latest run
+// in root if id is empty, along with the pairs reversing it.
+func undoPlan(path, root, id string) (journalRun, map[string]string, error) {
+	j, err := loadJournal(path)
+	if err != nil {
+		return journalRun{}, nil, err
+	}
+	i, err := j.findRun(root, id)
+	if err != nil {
+		return journalRun{}, nil, err
+	}
+	run := j.Runs[i]
+	pairs, err := run.reversePairs()
+	return run, pairs, err
+}
+
+// reversePairs returns the pairs reversing the run, including the stalled
+// renames and moves which have completed since. It fails if a file of the
+// run is missing, or if reversing it would overwrite a file.
+func (run journalRun) reversePairs() (map[string]string, error) {
+	entries := slices.Clone(run.Entries)
+	for _, e := range run.Stalled {
+		_, newErr := os.Lstat(e.New)
+		_, oldErr := os.Lstat(e.Old)
+		if run.Action != omitter.COPY && newErr == nil && os.IsNotExist(oldErr) {
+			entries = append(entries, e)
+		}
+	}
+	pairs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		pairs[e.New] = e.Old
+	}
+	for _, e := range entries {
+		if _, err := os.Lstat(e.New); err != nil {
+			return nil, fmt.Errorf("%q is missing: %w", e.New, err)
+		}
+		if run.Action == omitter.COPY {
+			continue
+		}
+		// The old name may still be taken by a file renamed away later in
+		// the undo, as happens with chains.
+		if _, err := os.Lstat(e.Old); err == nil {
+			if _, ok := pairs[e.Old]; !ok {
+				return nil, fmt.Errorf("%q already exists", e.Old)
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// reverse applies the pairs reversing the run. Copies are removed, renames
+// and moves are reversed.
+func (run journalRun) reverse(pairs map[string]string) (uint, error) {
+	switch run.Action {
+	case omitter.COPY:
+		var n uint
+		for copied := range pairs {
+			if err := os.Remove(copied); err != nil {
+				return n, fmt.Errorf("remove %q: %w", copied, err)
+			}
+			n++
+		}
+		return n, nil
+	case omitter.MOVE:
+		return omitter.Move(pairs, omitter.ExecOptions{})
+	default:
+		return omitter.Rename(pairs, omitter.ExecOptions{})
+	}
+}
+
+// undoRun reverses the run of id in the journal at path, or the latest run
+// in root if id is empty, and drops it from the journal. The journal stays
+// locked meanwhile, so no other operator undoes the same run. Signed runs
+// followed by others are kept, as dropping them would break the chain of
+// signatures.
+func undoRun(path, root, id string) (uint, error) {
+	unlock, err := lockJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	j, err := loadJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	i, err := j.findRun(root, id)
+	if err != nil {
+		return 0, err
+	}
+	run := j.Runs[i]
+	if run.Signature != "" && i < len(j.Runs)-1 {
+		return 0, fmt.Errorf("run %q is signed and followed by other runs, undoing it would break the chain of signatures", run.ID)
+	}
+	pairs, err := run.reversePairs()
+	if err != nil {
+		return 0, err
+	}
+	n, err := run.reverse(pairs)
+	if err != nil {
+		return n, err
+	}
+	j.Runs = slices.Delete(j.Runs, i, i+1)
+	return n, writeJournal(path, j)
+}
+
+// isJournal reports whether path is a journal or its lock.
+func isJournal(path string) bool {
+	name := filepath.Base(path)
+	return name == journalName || name == journalName+lockSuffix
+}
+
+// journalPath returns the path of the journal of cfg: in -journal-dir if
+// set, or in the path dir.
+func (cfg config) journalPath() string {
+	return filepath.Join(cmp.Or(cfg.journalDir, cfg.options.path), journalName)
+}
+
+func undo(cfg config) {
+	if cfg.withDryRun {
+		run, pairs, err := undoPlan(cfg.journalPath(), cfg.options.path, cfg.undoRun)
+		if err != nil {
+			fmt.Println("Undo:", err)
+			os.Exit(2)
+		}
+		fmt.Printf("Found %d file(s) to undo the %s of %s%s!\n",
+			len(pairs), run.Action, runLabel(run), formatTags(run.Tags))
+		if cfg.withVerbose {
+			for k, v := range pairs {
+				fmt.Printf("%s -> %s\n", k, v)
+			}
+		}
+		return
+	}
+
+	start := time.Now()
+	n, err := undoRun(cfg.journalPath(), cfg.options.path, cfg.undoRun)
+	if err != nil {
+		fmt.Println("Undo:", err)
+		fmt.Printf("%d file(s) were restored.\n", n)
+		os.Exit(2)
+	}
+	if cfg.withVerbose {
+		fmt.Printf("Restored %d file(s) in %s.\n", n, time.Since(start))
+	}
+}
+
+// runLabel describes run for operators telling runs apart: its time, and who
+// ran it where, along with its ID.
+func runLabel(run journalRun) string {
+	label := run.Time.Format(time.DateTime)
+	if run.User != "" || run.Host != "" {
+		label += " by " + run.User + "@" + run.Host
+	}
+	if run.ID != "" {
+		label += " [" + run.ID + "]"
+	}
+	return label
+}
+
+// journalCommand runs the journal subcommand named by the first of args.
+func journalCommand(args []string) {
+	switch {
+	case len(args) > 0 && args[0] == "list":
+		journalList(args[1:])
+	case len(args) > 0 && args[0] == "verify":
+		journalVerify(args[1:])
+	default:
+		fmt.Println("usage: omitter journal list|verify -p DIR")
+		os.Exit(1)
+	}
+}
+
+// journalList lists the latest runs of a journal, most recent first, with
+// the IDs -undo-run takes, so operators sharing a journal can tell their runs
+// apart.
+func journalList(args []string) {
+	flags := flag.NewFlagSet("journal list", flag.ExitOnError)
+	dir := flags.String("p", "", "dir whose journal is listed, the path dir of the runs or their -journal-dir")
+	root := flags.String("root", "", "only list the runs in this path dir")
+	limit := flags.Int("n", 20, "number of runs listed, 0 for all")
+	flags.Parse(args)
+	if *dir == "" || *limit < 0 || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	var rootAbs string
+	if *root != "" {
+		var err error
+		if rootAbs, err = filepath.Abs(*root); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	j, err := loadJournal(filepath.Join(*dir, journalName))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	listed := 0
+	for _, run := range slices.Backward(j.Runs) {
+		if rootAbs != "" && run.Root != rootAbs {
+			continue
+		}
+		if *limit > 0 && listed == *limit {
+			break
+		}
+		listed++
+		fmt.Printf("%s: %s of %d file(s) in %s%s\n",
+			runLabel(run), run.Action, len(run.Entries), cmp.Or(run.Root, *dir), formatTags(run.Tags))
+	}
+	if listed == 0 {
+		fmt.Println("No run in the journal.")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// TestJournalUndo verifies that a journaled rename, along with its tags, is
+// recorded, and reversed by undo.
+func TestJournalUndo(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testjournal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file1 := createTempFile(t, tempDir, "a.md", "first")
+	file2 := createTempFile(t, tempDir, "aa.md", "second")
+	pairs := map[string]string{
+		file1: file2,
+		file2: filepath.Join(tempDir, "aaaa.md"),
+	}
+
+	rec := newJournalRecorder(tempDir, omitter.RENAME)
+	rec.run.Tags = map[string]string{"ticket": "OPS-1234"}
+	if _, err = omitter.Rename(pairs, omitter.ExecOptions{After: rec.record}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if err = rec.save(); err != nil {
+		t.Fatalf("save journal error: %v", err)
+	}
+	run, _, err := undoPlan(filepath.Join(tempDir, journalName), tempDir, "")
+	if err != nil || run.Tags["ticket"] != "OPS-1234" {
+		t.Errorf("expected the run to be tagged, got %v (%v)", run.Tags, err)
+	}
+
+	n, err := undoRun(filepath.Join(tempDir, journalName), tempDir, "")
+	if err != nil {
+		t.Fatalf("undo error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 files restored, got %d", n)
+	}
+	for path, content := range map[string]string{file1: "first", file2: "second"} {
+		b, err := os.ReadFile(path)
+		if err != nil || string(b) != content {
+			t.Errorf("expected %s to hold %q, got %q (%v)", path, content, b, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, journalName)); !os.IsNotExist(err) {
+		t.Error("expected the emptied journal to be removed")
+	}
+	if _, err = undoRun(filepath.Join(tempDir, journalName), tempDir, ""); err == nil {
+		t.Error("expected an error without a run to undo")
+	}
+}
+
+// TestJournalUndoConflict verifies that undo refuses to overwrite files.
+func TestJournalUndoConflict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testjournal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(tempDir, "example_.txt")
+
+	rec := newJournalRecorder(tempDir, omitter.RENAME)
+	if _, err = omitter.Rename(map[string]string{originalFile: newPath}, omitter.ExecOptions{After: rec.record}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if err = rec.save(); err != nil {
+		t.Fatalf("save journal error: %v", err)
+	}
+
+	// A new file took the old name in the meantime.
+	createTempFile(t, tempDir, "example_target.txt", "newer")
+	if _, err = undoRun(filepath.Join(tempDir, journalName), tempDir, ""); err == nil {
+		t.Fatal("expected an error for a taken old name")
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected %s to be left alone, error: %v", newPath, err)
+	}
+}
+
+// TestJournalRollback verifies that rollback reverses the operations done
+// before a failure, and leaves nothing to save.
+func TestJournalRollback(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testjournal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file1 := createTempFile(t, tempDir, "a.md", "first")
+	file2 := createTempFile(t, tempDir, "b.md", "second")
+	pairs := map[string]string{
+		file1: filepath.Join(tempDir, "c.md"),
+		// The target dir is missing.
+		file2: filepath.Join(tempDir, "missing", "b.md"),
+	}
+
+	rec := newJournalRecorder(tempDir, omitter.RENAME)
+	n, err := omitter.Rename(pairs, omitter.ExecOptions{After: rec.record})
+	if err == nil {
+		t.Fatal("expected a rename error")
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 file renamed before the error, got %d", n)
+	}
+	if n, err = rec.rollback(); err != nil {
+		t.Fatalf("rollback error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 file rolled back, got %d", n)
+	}
+	for _, path := range []string{file1, file2} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist, error: %v", path, err)
+		}
+	}
+	if err = rec.save(); err != nil {
+		t.Fatalf("save journal error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, journalName)); !os.IsNotExist(err) {
+		t.Error("expected no journal after a rollback")
+	}
+}
+
+// TestJournalStalled verifies that stalled renames are undone only if they
+// completed after the run.
+func TestJournalStalled(t *testing.T) {
+	tempDir := t.TempDir()
+	done := createTempFile(t, tempDir, "b.txt", "done")
+	pending := createTempFile(t, tempDir, "c.txt", "pending")
+	run := journalRun{Action: omitter.RENAME, Stalled: []journalEntry{
+		{Old: filepath.Join(tempDir, "a.txt"), New: done},
+		{Old: pending, New: filepath.Join(tempDir, "d.txt")},
+	}}
+	pairs, err := run.reversePairs()
+	if err != nil {
+		t.Fatalf("reverse error: %v", err)
+	}
+	if len(pairs) != 1 || pairs[done] != filepath.Join(tempDir, "a.txt") {
+		t.Errorf("expected only %s to be reversed, got %v", done, pairs)
+	}
+}
+
+// TestJournalSign verifies that signed runs verify once saved, and that
+// altering or dropping a run shows.
+func TestJournalSign(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempDir := t.TempDir()
+	for _, name := range []string{"a_x.txt", "b_x.txt", "c_x.txt"} {
+		file := createTempFile(t, tempDir, name, "dummy")
+		rec := newJournalRecorder(tempDir, omitter.RENAME)
+		rec.key = key
+		pairs := map[string]string{file: strings.Replace(file, "_x", "", 1)}
+		if _, err = omitter.Rename(pairs, omitter.ExecOptions{After: rec.record}); err != nil {
+			t.Fatalf("rename error: %v", err)
+		}
+		if err = rec.save(); err != nil {
+			t.Fatalf("save journal error: %v", err)
+		}
+	}
+	path := filepath.Join(tempDir, journalName)
+	j, err := loadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := verifyRuns(j, pub); len(problems) > 0 {
+		t.Fatalf("expected the journal to verify, got %v", problems)
+	}
+
+	altered := j
+	altered.Runs = slices.Clone(j.Runs)
+	altered.Runs[1].Entries = []journalEntry{{Old: "/etc/passwd", New: "/tmp/passwd"}}
+	if problems := verifyRuns(altered, pub); len(problems) != 1 || problems[1] == "" {
+		t.Errorf("expected the altered run to fail, got %v", problems)
+	}
+	dropped := journal{Runs: []journalRun{j.Runs[0], j.Runs[2]}}
+	if problems := verifyRuns(dropped, pub); len(problems) != 1 || problems[1] == "" {
+		t.Errorf("expected the run after the dropped one to fail, got %v", problems)
+	}
+	unsigned := journal{Runs: append(slices.Clone(j.Runs), journalRun{Action: omitter.RENAME})}
+	if problems := verifyRuns(unsigned, pub); len(problems) != 1 || problems[3] != "not signed" {
+		t.Errorf("expected the unsigned run to fail, got %v", problems)
+	}
+}
+
+// TestSharedJournal verifies that runs of several dirs share a journal, that
+// undo picks the latest run of its dir or the run of an ID, and that the
+// journal is locked against concurrent runs.
+func TestSharedJournal(t *testing.T) {
+	journalDir := t.TempDir()
+	path := filepath.Join(journalDir, journalName)
+	var ids []string
+	var files []string
+	for _, root := range []string{t.TempDir(), t.TempDir(), t.TempDir()} {
+		file := createTempFile(t, root, "a_x.txt", "dummy")
+		rec := newJournalRecorder(root, omitter.RENAME)
+		rec.path = path
+		pairs := map[string]string{file: filepath.Join(root, "a.txt")}
+		if _, err := omitter.Rename(pairs, omitter.ExecOptions{After: rec.record}); err != nil {
+			t.Fatalf("rename error: %v", err)
+		}
+		if err := rec.save(); err != nil {
+			t.Fatalf("save journal error: %v", err)
+		}
+		ids, files = append(ids, rec.run.ID), append(files, file)
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("expected runs to get distinct IDs, got %s twice", ids[0])
+	}
+
+	run, _, err := undoPlan(path, filepath.Dir(files[1]), "")
+	if err != nil || run.ID != ids[1] {
+		t.Errorf("expected the run in %s, got %s (%v)", filepath.Dir(files[1]), run.ID, err)
+	}
+	if _, err = undoRun(path, "", ids[0]); err != nil {
+		t.Fatalf("undo error: %v", err)
+	}
+	if _, err = os.Stat(files[0]); err != nil {
+		t.Errorf("expected %s to be restored: %v", files[0], err)
+	}
+	j, err := loadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Runs) != 2 || j.Runs[0].ID != ids[1] || j.Runs[1].ID != ids[2] {
+		t.Errorf("expected only the undone run to be dropped, got %+v", j.Runs)
+	}
+
+	unlock, err := lockJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		unlock()
+	}()
+	unlock, err = lockJournal(path)
+	if err != nil {
+		t.Fatalf("expected the lock to be taken once released, got %v", err)
+	}
+	unlock()
+
+	// Locks left over by crashed runs are broken.
+	lock := path + lockSuffix
+	if err = os.WriteFile(lock, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err = os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if unlock, err = lockJournal(path); err != nil {
+		t.Fatalf("expected the stale lock to be broken, got %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// signRun signs run with key, chained to the signature of the run before it,
+// prev, so runs can be neither altered, reordered nor dropped from the middle
+// of the journal without it showing.
+func signRun(run journalRun, prev string, key ed25519.PrivateKey) (string, error) {
+	msg, err := signedMessage(run, prev)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)), nil
+}
+
+// signedMessage returns what the signature of run covers: the signature of
+// the run before it, followed by the JSON of run without its own signature.
+func signedMessage(run journalRun, prev string) ([]byte, error) {
+	run.Signature = ""
+	b, err := json.Marshal(run)
+	if err != nil {
+		return nil, fmt.Errorf("marshal run: %w", err)
+	}
+	return append([]byte(prev+"\n"), b...), nil
+}
+
+// verifyRuns checks the signatures of the runs of j with key, and returns
+// what is wrong with every run, by its index, for the ones failing.
+func verifyRuns(j journal, key ed25519.PublicKey) map[int]string {
+	problems := make(map[int]string)
+	prev := ""
+	for i, run := range j.Runs {
+		sig, err := base64.StdEncoding.DecodeString(run.Signature)
+		switch {
+		case run.Signature == "":
+			problems[i] = "not signed"
+		case err != nil:
+			problems[i] = "malformed signature"
+		default:
+			msg, err := signedMessage(run, prev)
+			if err != nil {
+				problems[i] = err.Error()
+			} else if !ed25519.Verify(key, msg, sig) {
+				problems[i] = "signature does not match, the run or the one before it was altered"
+			}
+		}
+		prev = run.Signature
+	}
+	return problems
+}
+
+// loadVerifyingKey reads an Ed25519 public key from a PKIX PEM file, as
+// written by openssl pkey -pubout.
+func loadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %q", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// journalVerify checks that every run of the journal of a dir was signed by
+// -sign-key, and that none was altered, reordered or dropped since, save
+// for the latest ones. It exits with 2 if any run fails.
+func journalVerify(args []string) {
+	flags := flag.NewFlagSet("journal verify", flag.ExitOnError)
+	root := flags.String("p", "", "dir whose journal is verified, the path dir of the runs or their -journal-dir")
+	keyPath := flags.String("key", "", "Ed25519 public key of -sign-key, a PKIX PEM file")
+	withVerbose := flags.Bool("v", false, "list the verified runs as well, not only the failed ones")
+	flags.Parse(args)
+	if *root == "" || *keyPath == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	key, err := loadVerifyingKey(*keyPath)
+	if err != nil {
+		fmt.Println("load key:", err)
+		os.Exit(1)
+	}
+	j, err := loadJournal(filepath.Join(*root, journalName))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if len(j.Runs) == 0 {
+		fmt.Printf("no journal in %q\n", *root)
+		os.Exit(2)
+	}
+
+	problems := verifyRuns(j, key)
+	for i, run := range j.Runs {
+		switch {
+		case problems[i] != "":
+			fmt.Printf("FAIL run %d, %s of %s: %s\n", i+1, run.Action, run.Time.Format(time.DateTime), problems[i])
+		case *withVerbose:
+			fmt.Printf("ok   run %d, %s of %s%s\n", i+1, run.Action, run.Time.Format(time.DateTime), formatTags(run.Tags))
+		}
+	}
+	fmt.Printf("%d of %d run(s) verified.\n", len(j.Runs)-len(problems), len(j.Runs))
+	if len(problems) > 0 {
+		os.Exit(2)
+	}
+}
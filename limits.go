@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the binary multiples of byte sizes, by their suffix.
+var sizeUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+	"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+}
+
+// parseSize parses a byte size such as 512M or 2GiB, where units are binary
+// multiples.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	digits := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if digits < 0 {
+		digits = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[digits:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+	n, err := strconv.ParseInt(s[:digits], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("size %q is too big", s)
+	}
+	return n * unit, nil
+}
+
+// applyLimits makes the runtime collect garbage more often as the memory
+// of the process nears -max-memory, and keeps the goroutines computing names,
+// which may read files, within -max-open-files.
+func applyLimits(cfg *config) {
+	if cfg.memoryLimit > 0 {
+		debug.SetMemoryLimit(cfg.memoryLimit)
+	}
+	if cfg.maxOpenFiles > 0 {
+		workers := cfg.transformWorkers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		cfg.transformWorkers = min(workers, cfg.maxOpenFiles)
+	}
+}
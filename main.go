@@ -1,24 +1,89 @@
 package main
 
 import (
-	"bufio"
-	"flag"
+	"crypto/ed25519"
 	"fmt"
 	"io"
-	"io/fs"
+	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strings"
 	"time"
 
-	"github.com/pooulad/ravan"
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// pastTense describes the files an action was carried out on.
+var pastTense = map[string]string{
+	omitter.RENAME:    "renamed",
+	omitter.COPY:      "copied",
+	omitter.MOVE:      "moved",
+	ACTION_CHOWN:      "chowned",
+	ACTION_SYNC_TIMES: "synced",
+}
+
+// Reasons of files being skipped by the CLI, besides the ones of the engine.
+const (
+	SKIP_OPEN_FILE   string = "open_file"
+	SKIP_TARGET_KEPT string = "target_kept"
+	SKIP_PROTECTED   string = "protected"
+	SKIP_NOT_CHANGED string = "not_changed"
+)
+
+// Policies of -protected, for files with attributes which forbid renaming.
+const (
+	PROTECTED_FAIL string = "fail"
+	PROTECTED_SKIP string = "skip"
+)
+
+// Exit codes, besides 1 for usage errors and 2 for other failures.
+const (
+	// exitNothingToDo is the exit code of runs where every name already
+	// conforms.
+	exitNothingToDo = 3
+	exitConflict    = 4
+	exitInvalidName = 5
+	exitSkipped     = 6
+	exitCrossDevice = 7
+	exitTimeout     = 8
+)
+
+const (
+	REMEMBER_XATTR   string = "xattr"
+	REMEMBER_SIDECAR string = "sidecar"
+)
+
+// Times of -by-date.
+const (
+	BY_DATE_MTIME string = "mtime"
+	BY_DATE_CTIME string = "ctime"
+)
+
+// byDateLayout is the date prefixed by -by-date.
+const byDateLayout = "20060102"
+
+// Modes of -preserve, the metadata carried over to copies besides the
+// permissions, which they always keep.
+const (
+	PRESERVE_ACL   string = "acl"
+	PRESERVE_TIMES string = "times"
+	PRESERVE_OWNER string = "owner"
 )
 
 const (
-	RENAME string = "rename"
-	COPY   string = "copy"
-	MOVE   string = "move"
+	// originalXattr is the extended attribute holding the pre-rename name.
+	originalXattr string = "user.omitter.original"
+	// sidecarExt is appended to a renamed file's path to get its sidecar.
+	sidecarExt string = ".orig"
+)
+
+// ignoredNames are the files of the command itself, which are never renamed:
+// the journal and the sidecars of remembered names.
+var ignoredNames = []string{journalName, journalName + lockSuffix, "*" + sidecarExt}
+
+const (
+	IO_PRIORITY_IDLE   string = "idle"
+	IO_PRIORITY_LOW    string = "low"
+	IO_PRIORITY_NORMAL string = "normal"
 )
 
 type fileOptions struct {
@@ -26,333 +91,213 @@ type fileOptions struct {
 	str              string
 	fileType         string
 	replace          string
+	occurrence       string
+	count            int
 	output           string
 	transmissionType string
+	allowChars       string
+	allowFallback    string
+	withASCII        bool
+	normalize        string
+	withSanitize     bool
+	sanitizeChar     string
+	redact           string
+	dict             string
+	swap             string
+	withReverseStem  bool
+	prefix           string
+	suffix           string
+	withNumber       bool
+	numberStart      int
+	numberStep       int
+	numberFormat     string
+	numberSort       string
+	rememberOriginal string
+	staging          string
+	fixSymlinks      string
+	checkHardlinks   string
+	typeGroup        string
+	include          string
+	exclude          string
+	anchorDir        string
+	maxDepth         int
+	expectPerDir     string
+	conflictSuffix   string
+	suffixPlacement  string
+	onConflict       string
+	template         string
+	byDate           string
+	timezone         string
+	assert           string
 }
+
 type config struct {
-	options         fileOptions
-	withVerbose     bool
-	withDryRun      bool
-	withInteractive bool
-	withRegex       bool
-	help            bool
+	options          fileOptions
+	withVerbose      bool
+	withDryRun       bool
+	withInteractive  bool
+	withRegex        bool
+	help             bool
+	allowedChars     *regexp.Regexp
+	redactPattern    *regexp.Regexp
+	occurrence       int
+	searches         []string
+	replaces         []string
+	substitutions    []omitter.Substitution
+	expressions      []omitter.Substitution
+	template         *omitter.Template
+	assertions       []omitter.Assertion
+	dict             map[string]string
+	location         *time.Location
+	withSniff        bool
+	withIncludeTemp  bool
+	withConfirmEach  bool
+	withTUI          bool
+	withWatch        bool
+	watchDelay       time.Duration
+	digest           string
+	digestTarget     *url.URL
+	digestEvery      time.Duration
+	watchEvents      string
+	withConformCache bool
+	warnSlowerThan   time.Duration
+	slowest          int
+	copyChunks       int
+	ioPriority       string
+	transformWorkers int
+	maxOpenFiles     int
+	maxMemory        string
+	memoryLimit      int64
+	workers          int
+	withScanSummary  bool
+	withEstimate     bool
+	withSummaryDirs  bool
+	groupByCapture   int
+	remapCapture     int
+	remap            map[string]string
+	withSkipOpen     bool
+	withStrict       bool
+	backupDir        string
+	backupSuffix     string
+	withNoTrash      bool
+	withRestorecon   bool
+	preserve         string
+	withAtomic       bool
+	timeout          time.Duration
+	opTimeout        time.Duration
+	onTimeout        string
+	deadline         time.Time
+	withStream       bool
+	changedSince     string
+	planOut          string
+	planIn           string
+	planFilter       planFilter
+	action           string
+	owner            string
+	withFromPair     bool
+	configPath       string
+	profile          string
+	pipeline         string
+	format           string
+	protected        string
+	order            string
+	window           string
+	controlSocket    string
+	skipReport       string
+	tags             map[string]string
+	signKey          string
+	journalKey       ed25519.PrivateKey
+	runUser          string
+	runGroup         string
+	withSandbox      bool
+	withUndo         bool
+	undoRun          string
+	journalDir       string
+	seed             string
+	// random is the source of the randomness of the run, seeded with seed
+	// if set, crypto/rand otherwise.
+	random io.Reader
+	// prompter asks every question of the run, on the terminal unless
+	// injected.
+	prompter omitter.Prompter
 }
 
 func main() {
-	cfg := parseFlags()
-	if cfg.options.path == "" || cfg.options.str == "" || cfg.help {
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	var pattern *regexp.Regexp
-	var err error
-	if cfg.withRegex {
-		pattern, err = regexp.Compile(cfg.options.str)
-		if err != nil {
-			fmt.Println("compile pattern:", err)
-			os.Exit(1)
-		}
-	}
-	pairs, err := walker(cfg, pattern)
-	if err != nil {
-		fmt.Println("walk dir:", err)
-		os.Exit(2)
-	}
-
-	actionName := getActionName(cfg.options.output, cfg.options.transmissionType)
-
-	if cfg.withDryRun {
-		fmt.Printf("Found %d file(s) to %s!\n", len(pairs), actionName)
-		if cfg.withVerbose {
-			for k, v := range pairs {
-				fmt.Printf("%s -> %s\n", k, v)
-			}
-		}
-		return
-	}
-	if cfg.withInteractive {
-		fmt.Printf("Found %d file(s) to %s. Proceed?(y/n) ", len(pairs), actionName)
-		if !canProceed() {
-			fmt.Println("Aborted.")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore-names":
+			restoreNames(os.Args[2:])
+			return
+		case "sync-names":
+			syncNames(os.Args[2:])
+			return
+		case "ctl":
+			ctl(os.Args[2:])
+			return
+		case "selftest":
+			selftest(os.Args[2:])
+			return
+		case "verify":
+			verify(os.Args[2:])
+			return
+		case "plan":
+			planCommand(os.Args[2:])
+			return
+		case "journal":
+			journalCommand(os.Args[2:])
+			return
+		case "service":
+			serviceCommand(os.Args[2:])
 			return
 		}
 	}
 
-	start := time.Now()
-	var n uint
-	if cfg.options.output != "" {
-		tt := getTransmissionType(cfg.options.transmissionType)
-		var n uint
-		var err error
-		var message, vMessage string
-		if tt == COPY {
-			n, err = copyAction(pairs)
-			message = fmt.Sprintf("%d file(s) were copied.", n)
-			vMessage = fmt.Sprintf("Copied %d file(s)", n)
-
-		} else {
-			n, err = moveAction(pairs)
-			message = fmt.Sprintf("%d file(s) were moved.", n)
-			vMessage = fmt.Sprintf("Moved %d file(s)", n)
-		}
-		if err != nil {
-			fmt.Printf("%s: %t", tt, err)
-			fmt.Println(message)
-			os.Exit(2)
-		}
-		if cfg.withVerbose {
-			fmt.Printf("%s in %s.\n", vMessage, time.Since(start))
-		}
-	} else {
-		n, err = renameAction(pairs)
-		if err != nil {
-			fmt.Println("Renaming:", err)
-			fmt.Printf("%d file(s) were renamed.\n", n)
-			os.Exit(2)
-		}
-		if cfg.withVerbose {
-			fmt.Printf("Renamed %d file(s) in %s.\n", n, time.Since(start))
-		}
-	}
-}
-
-func walker(config config, pattern *regexp.Regexp,
-) (map[string]string, error) {
-	pairs := make(map[string]string)
-	err := filepath.WalkDir(
-		config.options.path,
-		func(path string, file fs.DirEntry, err error) error {
-			switch {
-			case err != nil:
-				return err
-			case file.IsDir():
-				return nil
-			}
-			oldName := file.Name()
-			fileExt := filepath.Ext(oldName)
-			if config.options.fileType != "" && fileExt != "" {
-				if fileExt != config.options.fileType {
-					return nil
-				}
-			}
-			targetStr := searchString(pattern, config.options.str, oldName)
-			if config.withRegex && targetStr == "" {
-				return nil
-			}
-
-			newName := strings.ReplaceAll(oldName, targetStr, config.options.replace)
-			if newName == oldName || newName == "" {
-				return nil
-			}
-
-			var targetDir string
-			if config.options.output != "" {
-				targetDir = config.options.output
-			} else {
-				targetDir = path
-			}
-			if config.options.replace != "" {
-				newName = resolveConflict(filepath.Dir(targetDir), newName, pairs)
-			}
-			newPath := filepath.Join(filepath.Dir(targetDir), newName)
-			if path == newPath {
-				return nil
-			}
-			pairs[path] = newPath
-			return nil
-		})
-	return pairs, err
-}
-
-func copyAction(pairs map[string]string) (uint, error) {
-	r, err := ravan.New(ravan.WithWidth(50))
-	if err != nil {
-		return 0, fmt.Errorf("init raven: %w", err)
-	}
-
-	var copied uint
-	total := len(pairs)
-	for oldName, newName := range pairs {
-		if err := copyFile(oldName, newName); err != nil {
-			return copied, fmt.Errorf("%q to %q: %w", oldName, newName, err)
+	cfg := parseFlags()
+	if cfg.pipeline != "" {
+		if cfg.profile != "" {
+			fmt.Println("pipeline can not be used together with profile")
+			os.Exit(1)
 		}
-		copied++
-		r.Draw(float64(copied) / float64(total))
+		runPipeline(cfg, withoutFlag(os.Args[1:], "pipeline"))
+		return
 	}
-	return copied, nil
-}
-
-func moveAction(pairs map[string]string) (uint, error) {
-	r, err := ravan.New(ravan.WithWidth(50))
-	if err != nil {
-		return 0, fmt.Errorf("init raven: %w", err)
+	if (cfg.withUndo || cfg.undoRun != "") && cfg.options.path != "" && !cfg.help {
+		undo(cfg)
+		return
 	}
-
-	var moved uint
-	total := len(pairs)
-	for oldName, newName := range pairs {
-		if err := moveFile(oldName, newName); err != nil {
-			return moved, fmt.Errorf("%q to %q: %w", oldName, newName, err)
+	validateConfig(&cfg)
+	if cfg.ioPriority != "" {
+		if err := setIOPriority(cfg.ioPriority); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
-		moved++
-		r.Draw(float64(moved) / float64(total))
-	}
-	return moved, nil
-}
-
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("open source file: %w", err)
-	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("create destination file: %w", err)
-	}
-	defer out.Close()
-
-	if _, err = io.Copy(out, in); err != nil {
-		return fmt.Errorf("copying data: %w", err)
-	}
-
-	if err = out.Sync(); err != nil {
-		return fmt.Errorf("sync destination file: %w", err)
-	}
-
-	info, err := os.Stat(src)
-	if err != nil {
-		return fmt.Errorf("failed to get file(%q) info: %w", src, err)
-	}
-	if err = os.Chmod(dst, info.Mode()); err != nil {
-		return fmt.Errorf("failed to set file(%q) permissions: %w", dst, err)
 	}
-
-	return nil
-}
-
-func moveFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("open source file: %w", err)
-	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("create destination file: %w", err)
-	}
-	defer out.Close()
-
-	if _, err = io.Copy(out, in); err != nil {
-		return fmt.Errorf("moving data: %w", err)
-	}
-	if err = out.Sync(); err != nil {
-		return fmt.Errorf("sync destination file: %w", err)
-	}
-	info, err := os.Stat(src)
-	if err != nil {
-		return fmt.Errorf("get file(%q) info: %w", src, err)
-	}
-	if err = os.Chmod(dst, info.Mode()); err != nil {
-		return fmt.Errorf("set file(%q) permissions: %w", dst, err)
-	}
-	if err = os.Remove(src); err != nil {
-		return fmt.Errorf("remove source file after copy: %w", err)
-	}
-
-	return nil
-}
-
-func renameAction(pairs map[string]string) (uint, error) {
-	r, err := ravan.New(ravan.WithWidth(50))
-	if err != nil {
-		return 0, fmt.Errorf("init raven: %w", err)
+	pattern := compileSearches(&cfg)
+	switch cfg.action {
+	case ACTION_CHOWN:
+		chown(cfg, pattern)
+		return
+	case ACTION_SYNC_TIMES:
+		syncTimes(cfg, pattern)
+		return
 	}
-
-	var renamed uint
-	total := len(pairs)
-	for oldName, newName := range pairs {
-		if err := os.Rename(oldName, newName); err != nil {
-			return renamed, fmt.Errorf(
-				"%q to %q: %w", oldName, newName, err,
-			)
+	if cfg.withWatch {
+		if err := confine(cfg); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
 		}
-		renamed++
-		r.Draw(float64(renamed) / float64(total))
-	}
-
-	return renamed, nil
-}
-
-func parseFlags() config {
-	var cfg config
-	flag.StringVar(&cfg.options.path, "p", "", "path to dir")
-	flag.StringVar(&cfg.options.str, "s", "", "string to find")
-	flag.StringVar(&cfg.options.fileType, "t", "", "filter file type to modify")
-	flag.StringVar(&cfg.options.replace, "replace", "", "replace str instead of remove it")
-	flag.StringVar(&cfg.options.output, "output", "", "copy to new dir instead of rename in path flag dir")
-	flag.StringVar(&cfg.options.transmissionType, "tt", "", "determine transmission type. default is copy if output flag is exist.")
-	flag.BoolVar(&cfg.withVerbose, "v", false, "verbose")
-	flag.BoolVar(&cfg.withDryRun, "d", false, "dry run")
-	flag.BoolVar(&cfg.withInteractive, "i", false, "interactive")
-	flag.BoolVar(&cfg.withRegex, "r", false, "enable regex")
-	flag.BoolVar(&cfg.help, "help", false, "help")
-	flag.Parse()
-	return cfg
-}
-
-func searchString(pattern *regexp.Regexp, str, fileName string) string {
-	if pattern == nil {
-		return str
-	}
-	return pattern.FindString(fileName)
-}
-
-func canProceed() bool {
-	r := bufio.NewReader(os.Stdin)
-	s, err := r.ReadString('\n')
-	if err != nil {
-		return false
-	}
-	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "y", "yes":
-		return true
-	default:
-		return false
+		serveWatch(func() { watch(cfg, pattern) })
+		return
 	}
-}
-
-func resolveConflict(dir, newName string, pairs map[string]string) string {
-	candidate := newName
-	count := 1
-	for {
-		conflict := false
-		for _, v := range pairs {
-			if filepath.Base(v) == candidate {
-				conflict = true
-				break
-			}
-		}
-		if _, err := os.Stat(filepath.Join(dir, candidate)); err == nil {
-			conflict = true
-		}
-		if !conflict {
-			break
-		}
-		ext := filepath.Ext(newName)
-		nameOnly := strings.TrimSuffix(newName, ext)
-		candidate = fmt.Sprintf("%s_%d%s", nameOnly, count, ext)
-		count++
+	if cfg.remapCapture != 0 {
+		cfg.remap = remapCaptures(cfg, pattern)
 	}
-	return candidate
+	run(cfg, pattern)
 }
 
 func getActionName(output, tType string) string {
 	tt := getTransmissionType(tType)
-	name := RENAME
+	name := omitter.RENAME
 	if output != "" {
 		name = tt
 	}
@@ -362,8 +307,8 @@ func getActionName(output, tType string) string {
 func getTransmissionType(transmissionType string) string {
 	switch transmissionType {
 	case "mv", "move":
-		return MOVE
+		return omitter.MOVE
 	default:
-		return COPY
+		return omitter.COPY
 	}
 }
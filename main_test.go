@@ -1,10 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
 )
 
 // createTempFile is a helper to create a temporary file with the given content.
@@ -17,412 +28,905 @@ func createTempFile(t *testing.T, dir, name, content string) string {
 	return path
 }
 
-// TestWalkerWithoutRegex verifies that walker returns a proper mapping when regex is disabled.
-func TestWalkerWithoutRegex(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "testwalker")
+// TestCanProceedYes simulates a "yes" response for canProceed.
+func TestCanProceedYes(t *testing.T) {
+	// Save original os.Stdin.
+	origStdin := os.Stdin
+	defer func() { os.Stdin = origStdin }()
+
+	// Create a pipe and write "y\n".
+	r, w, err := os.Pipe()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(tempDir)
-
-	// Create files.
-	file1 := createTempFile(t, tempDir, "example_target.txt", "dummy")
-	file2 := createTempFile(t, tempDir, "example.txt", "dummy")
+	_, err = w.WriteString("y\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	os.Stdin = r
 
-	// Create config
-	cfg := config{
-		options:         fileOptions{path: tempDir, str: "target", fileType: "", replace: ""},
-		withVerbose:     false,
-		withDryRun:      false,
-		withInteractive: false,
-		withRegex:       false,
+	if !canProceed() {
+		t.Error("expected canProceed() to return true for input 'y'")
 	}
+}
+
+// TestCanProceedNo simulates a "no" response for canProceed.
+func TestCanProceedNo(t *testing.T) {
+	origStdin := os.Stdin
+	defer func() { os.Stdin = origStdin }()
 
-	// Call walker with regex disabled (pattern is nil) and str "target".
-	pairs, err := walker(cfg, nil)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteString("n\n")
 	if err != nil {
-		t.Fatalf("walker error: %v", err)
+		t.Fatal(err)
+	}
+	w.Close()
+	os.Stdin = r
+
+	if canProceed() {
+		t.Error("expected canProceed() to return false for input 'n'")
+	}
+}
+
+// TestGetActionName verifies returning action name(rename or copy).
+func TestGetActionName(t *testing.T) {
+	actionName1 := getActionName("output_is_not_empty", "copy")
+	if actionName1 != omitter.COPY {
+		t.Errorf("expected %q, got %q", omitter.COPY, actionName1)
+	}
+
+	actionName2 := getActionName("output_is_not_empty", "mv")
+	if actionName2 != omitter.MOVE {
+		t.Errorf("expected %q, got %q", omitter.MOVE, actionName2)
+	}
+
+	actionName3 := getActionName("", "")
+	if actionName3 != omitter.RENAME {
+		t.Errorf("expected %q, got %q", omitter.RENAME, actionName3)
+	}
+}
+
+func TestTransmissionType(t *testing.T) {
+	tt_copy := getTransmissionType("copy")
+	tt_move := getTransmissionType("move")
+	tt_default := getTransmissionType("")
+
+	if tt_copy != omitter.COPY {
+		t.Errorf("expected %s. got %s", omitter.COPY, tt_copy)
 	}
-	// file1 should be processed because it contains "target".
-	if _, ok := pairs[file1]; !ok {
-		t.Errorf("expected file %s to be in pairs", file1)
+	if tt_move != omitter.MOVE {
+		t.Errorf("expected %s. got %s", omitter.MOVE, tt_move)
 	}
-	// file2 should not be processed.
-	if _, ok := pairs[file2]; ok {
-		t.Errorf("did not expect file %s in pairs", file2)
+	if tt_default != omitter.COPY {
+		t.Errorf("expected %s. got %s", omitter.COPY, tt_default)
 	}
 }
 
-// TestWalkerWithRegex verifies that walker correctly uses a regex pattern.
-func TestWalkerWithRegex(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "testwalker")
+// TestRememberOriginalSidecar verifies that a sidecar with the original name is written.
+func TestRememberOriginalSidecar(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testremember")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Create files.
-	file1 := createTempFile(t, tempDir, "example_target.txt", "dummy")
-	file2 := createTempFile(t, tempDir, "example.txt", "dummy")
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(tempDir, "example_.txt")
 
-	// Compile regex pattern to match "_target" in the file name.
-	pattern, err := regexp.Compile("(_target)")
+	after, err := rememberOriginal(REMEMBER_SIDECAR)
 	if err != nil {
-		t.Fatalf("failed to compile regex: %v", err)
+		t.Fatalf("remember original error: %v", err)
 	}
-
-	// Create config
-	cfg := config{
-		options:         fileOptions{path: tempDir, str: "(_target)", fileType: "", replace: ""},
-		withVerbose:     false,
-		withDryRun:      false,
-		withInteractive: false,
-		withRegex:       true,
+	if _, err = omitter.Rename(map[string]string{originalFile: newPath}, omitter.ExecOptions{After: after}); err != nil {
+		t.Fatalf("rename error: %v", err)
 	}
 
-	// Here the second parameter "target" is still passed,
-	// but the searchString function uses the regex if provided.
-	pairs, err := walker(cfg, pattern)
+	b, err := os.ReadFile(newPath + sidecarExt)
 	if err != nil {
-		t.Fatalf("walker error: %v", err)
+		t.Fatalf("failed to read sidecar: %v", err)
 	}
-
-	// file1 should be processed because it matches the regex.
-	if _, ok := pairs[file1]; !ok {
-		t.Errorf("expected file %s to be in pairs", file1)
+	var orig originalName
+	if err = json.Unmarshal(b, &orig); err != nil {
+		t.Fatalf("failed to unmarshal sidecar: %v", err)
 	}
-	// file2 should not be processed.
-	if _, ok := pairs[file2]; ok {
-		t.Errorf("did not expect file %s in pairs", file2)
+	if orig.Name != "example_target.txt" {
+		t.Errorf("expected original name %q, got %q", "example_target.txt", orig.Name)
 	}
 
-	// Verify that the new file name is as expected.
-	expectedNewName := "example.txt" // "example_target.txt" with "_target" removed.
-	newPath, ok := pairs[file1]
-	if !ok {
-		t.Fatalf("file %s not found in pairs", file1)
+	// Renamed again, the file keeps its original name, and its sidecar.
+	renamed := filepath.Join(tempDir, "example.txt")
+	if _, err = omitter.Rename(map[string]string{newPath: renamed}, omitter.ExecOptions{After: after}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if _, err = os.Lstat(newPath + sidecarExt); !os.IsNotExist(err) {
+		t.Errorf("expected the sidecar of %s to be moved, got %v", newPath, err)
+	}
+	if b, err = os.ReadFile(renamed + sidecarExt); err != nil {
+		t.Fatalf("failed to read sidecar: %v", err)
 	}
-	if filepath.Base(newPath) != expectedNewName {
-		t.Errorf("expected new file name %q, got %q", expectedNewName, filepath.Base(newPath))
+	if err = json.Unmarshal(b, &orig); err != nil || orig.Name != "example_target.txt" {
+		t.Errorf("expected original name %q, got %q (%v)", "example_target.txt", orig.Name, err)
+	}
+
+	if _, err = rememberOriginal("unknown"); err == nil {
+		t.Error("expected an error for unknown mode")
 	}
 }
 
-// TestWalkerWithRegex verifies that walker correctly filters files type.
-func TestWalkerWitFileType(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "testwalker")
+// TestCollectOriginals verifies that renamed files are mapped back to their original names.
+func TestCollectOriginals(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testrestore")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Create files.
-	file1 := createTempFile(t, tempDir, "file1.txt", "dummy")
-	file2 := createTempFile(t, tempDir, "file1.json", "dummy")
-	file3 := createTempFile(t, tempDir, "file2.json", "dummy")
-	file4 := createTempFile(t, tempDir, "nothing.json", "dummy")
-
-	// Create config
-	cfg := config{
-		options:         fileOptions{path: tempDir, str: "ile", fileType: ".json", replace: ""},
-		withVerbose:     false,
-		withDryRun:      false,
-		withInteractive: false,
-		withRegex:       false,
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(tempDir, "example_.txt")
+	if _, err = omitter.Rename(map[string]string{originalFile: newPath}, omitter.ExecOptions{After: writeSidecar}); err != nil {
+		t.Fatalf("rename error: %v", err)
 	}
 
-	// Call walker with regex disabled (pattern is nil) and str "target".
-	pairs, err := walker(cfg, nil)
+	pairs, err := collectOriginals(tempDir, io.Discard)
 	if err != nil {
-		t.Fatalf("walker error: %v", err)
+		t.Fatalf("collect originals error: %v", err)
 	}
-	// file1 should not be processed because it contains ".txt" instead of ".json".
-	if _, ok := pairs[file1]; ok {
-		t.Errorf("did not expect file %s in pairs", file1)
+	if pairs[newPath] != originalFile {
+		t.Fatalf("expected %q to be restored to %q, got %v", newPath, originalFile, pairs)
 	}
-	// file2 should be processed.because it contains "ile" in file name and ".json" in file extension
-	if _, ok := pairs[file2]; !ok {
-		t.Errorf("expected file %s to be in pairs", file2)
+
+	if _, err = omitter.Rename(pairs, omitter.ExecOptions{After: forgetOriginal}); err != nil {
+		t.Fatalf("restore error: %v", err)
 	}
-	// file3 should be processed.because it contains "ile" in file name and ".json" in file extension
-	if _, ok := pairs[file3]; !ok {
-		t.Errorf("expected file %s to be in pairs", file3)
+	if _, err := os.Stat(originalFile); err != nil {
+		t.Errorf("expected original file %s to exist, error: %v", originalFile, err)
 	}
-	// file4 should not be processed.
-	if _, ok := pairs[file4]; ok {
-		t.Errorf("did not expect file %s in pairs", file4)
+	if _, err := os.Stat(newPath + sidecarExt); !os.IsNotExist(err) {
+		t.Errorf("expected sidecar of %s to be removed", newPath)
 	}
 }
 
-// TestWalkerWithRegex verifies that resolveConflict correctly works when two files with the same name exist after changes are made.
-func TestCollisionResolution(t *testing.T) {
-	// Create a temporary directory.
-	tempDir, err := os.MkdirTemp("", "collision_test")
+// TestCollectOriginalsForeignOrig verifies that .orig files which are not
+// sidecars are skipped with a warning instead of aborting the restore.
+func TestCollectOriginalsForeignOrig(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(tempDir, "example_.txt")
+	if _, err := omitter.Rename(map[string]string{originalFile: newPath}, omitter.ExecOptions{After: writeSidecar}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	createTempFile(t, tempDir, "config", "dummy")
+	foreign := createTempFile(t, tempDir, "config.orig", "backup of config")
+
+	var out strings.Builder
+	pairs, err := collectOriginals(tempDir, &out)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("collect originals error: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
+	if len(pairs) != 1 || pairs[newPath] != originalFile {
+		t.Fatalf("expected only %q to be restored to %q, got %v", newPath, originalFile, pairs)
+	}
+	if !strings.Contains(out.String(), foreign) {
+		t.Errorf("expected a warning about %s, got %q", foreign, out.String())
+	}
+}
 
-	// Create two files that will produce the same new name when processed.
-	// Using regex "d.*d" on these file names:
-	// "aaa.json"   -> pattern "aaa" replaced by "bbb" produces "bbb.json"
-	// "aaaaaaa.json" -> pattern "aaaaaaa" replaced by "bbb" also produces "bbb.json"
-	_ = createTempFile(t, tempDir, "aaa.json", "dummy")
-	_ = createTempFile(t, tempDir, "aaaaaaa.json", "dummy")
+// TestMirrorPairs verifies that mirrored files are matched by content and mapped to the source names.
+func TestMirrorPairs(t *testing.T) {
+	sourceDir, err := os.MkdirTemp("", "source_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sourceDir)
 
-	// Set up config with regex mode enabled.
-	cfg := config{
-		options: fileOptions{
-			path:    tempDir,
-			str:     "a.*a", // Regex pattern to match the entire part from first d to last d.
-			replace: "bbb",  // Replacement string.
-		},
-		withVerbose:     false,
-		withDryRun:      false,
-		withInteractive: false,
-		withRegex:       true,
+	mirrorDir, err := os.MkdirTemp("", "mirror_dir")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(mirrorDir)
+
+	createTempFile(t, sourceDir, "report.txt", "report content")
+	createTempFile(t, sourceDir, "same.txt", "same content")
+	oldReport := createTempFile(t, mirrorDir, "report_final_v2.txt", "report content")
+	same := createTempFile(t, mirrorDir, "same.txt", "same content")
+	unknown := createTempFile(t, mirrorDir, "unknown.txt", "unknown content")
 
-	// Compile the regex pattern.
-	pattern, err := regexp.Compile(cfg.options.str)
+	pairs, err := mirrorPairs(sourceDir, mirrorDir)
 	if err != nil {
-		t.Fatalf("failed to compile regex: %v", err)
+		t.Fatalf("mirror pairs error: %v", err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 file to be renamed, got %v", pairs)
+	}
+	if pairs[oldReport] != filepath.Join(mirrorDir, "report.txt") {
+		t.Errorf("expected %s to be renamed to report.txt, got %q", oldReport, pairs[oldReport])
 	}
+	if _, ok := pairs[same]; ok {
+		t.Errorf("did not expect file %s in pairs", same)
+	}
+	if _, ok := pairs[unknown]; ok {
+		t.Errorf("did not expect file %s in pairs", unknown)
+	}
+}
 
-	// Call walker to generate the mapping of old paths to new paths.
-	pairs, err := walker(cfg, pattern)
+// TestFixSymlinks verifies that symlinks to renamed files are rewritten.
+func TestFixSymlinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testsymlinks")
 	if err != nil {
-		t.Fatalf("walker error: %v", err)
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(tempDir)
 
-	// We expect both files to be processed.
-	if len(pairs) != 2 {
-		t.Fatalf("expected 2 files to be processed, got %d", len(pairs))
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(tempDir, "example_.txt")
+	relLink := filepath.Join(tempDir, "relative")
+	absLink := filepath.Join(tempDir, "absolute")
+	if err = os.Symlink("example_target.txt", relLink); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(originalFile, absLink); err != nil {
+		t.Fatal(err)
 	}
 
-	// Collect the new file names.
-	newNames := make(map[string]bool)
-	for _, newPath := range pairs {
-		newNames[filepath.Base(newPath)] = true
+	pairs := map[string]string{originalFile: newPath}
+	if _, err = omitter.Rename(pairs, omitter.ExecOptions{}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	fixed, err := fixSymlinks(tempDir, pairs)
+	if err != nil {
+		t.Fatalf("fix symlinks error: %v", err)
+	}
+	if fixed != 2 {
+		t.Errorf("expected 2 symlinks fixed, got %d", fixed)
 	}
 
-	// We expect one file to become "bbb.json" and the other to become "bbb.json".
-	if !newNames["bbb.json"] {
-		t.Errorf("expected 'bbb.json' in new names, got %v", newNames)
+	if link, _ := os.Readlink(relLink); link != "example_.txt" {
+		t.Errorf("expected relative link to %q, got %q", "example_.txt", link)
 	}
-	if !newNames["bbb_1.json"] {
-		t.Errorf("expected 'bbb_1.json' in new names, got %v", newNames)
+	if link, _ := os.Readlink(absLink); link != newPath {
+		t.Errorf("expected absolute link to %q, got %q", newPath, link)
 	}
 }
 
-// TestRenameAction verifies that the rename function renames files as expected.
-func TestRenameAction(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "testrename")
+// TestFindHardlinks verifies that other hard links to renamed files are reported.
+func TestFindHardlinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testhardlinks")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Create a file that should be renamed.
 	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	otherFile := createTempFile(t, tempDir, "other_target.txt", "dummy")
+	alias := filepath.Join(tempDir, "alias.txt")
+	if err = os.Link(originalFile, alias); err != nil {
+		t.Skipf("hard links are not supported: %v", err)
+	}
 
-	// Expected new name after removing "target".
-	newName := "example_.txt"
-	newPath := filepath.Join(tempDir, newName)
 	pairs := map[string]string{
-		originalFile: newPath,
+		originalFile: filepath.Join(tempDir, "example_.txt"),
+		otherFile:    filepath.Join(tempDir, "other_.txt"),
 	}
-
-	// Call renameAction.
-	count, err := renameAction(pairs)
+	aliases, err := findHardlinks(tempDir, pairs)
 	if err != nil {
-		t.Fatalf("rename error: %v", err)
+		t.Fatalf("find hard links error: %v", err)
 	}
-	if count != 1 {
-		t.Errorf("expected 1 file renamed, got %d", count)
+	if len(aliases[originalFile]) != 1 || aliases[originalFile][0] != alias {
+		t.Errorf("expected %s to be reported as alias of %s, got %v", alias, originalFile, aliases)
 	}
-
-	// Verify that the original file no longer exists and the new file does.
-	if _, err := os.Stat(originalFile); !os.IsNotExist(err) {
-		t.Errorf("expected original file %s to be removed", originalFile)
+	if _, ok := aliases[otherFile]; ok {
+		t.Errorf("did not expect file %s in aliases", otherFile)
 	}
-	if _, err := os.Stat(newPath); err != nil {
-		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+}
+
+// TestParseRange verifies parsing of the expected match count ranges.
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		in        string
+		low, high int
+		wantErr   bool
+	}{
+		{"1", 1, 1, false},
+		{"1..3", 1, 3, false},
+		{"2..", 2, -1, false},
+		{"..4", 0, 4, false},
+		{"3..1", 0, 0, true},
+		{"a..b", 0, 0, true},
+	}
+	for _, c := range cases {
+		low, high, err := parseRange(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if !c.wantErr && (low != c.low || high != c.high) {
+			t.Errorf("%q: expected %d..%d, got %d..%d", c.in, c.low, c.high, low, high)
+		}
 	}
 }
 
-// TestCopyAction verifies that the rename function renames files as expected.
-func TestCopyAction(t *testing.T) {
-	srcDir, err := os.MkdirTemp("", "first_dir")
+// TestCheckPerDir verifies that dirs with an unexpected number of matches are reported.
+func TestCheckPerDir(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testperdir")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(srcDir)
+	defer os.RemoveAll(tempDir)
 
-	dstDir, err := os.MkdirTemp("", "second_dir")
-	if err != nil {
-		t.Fatal(err)
+	for _, dir := range []string{"one", "two", "none"} {
+		if err = os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
 	}
-	defer os.RemoveAll(dstDir)
+	createTempFile(t, tempDir, "one/cover_target.jpg", "dummy")
+	createTempFile(t, tempDir, "two/cover_target.jpg", "dummy")
+	createTempFile(t, tempDir, "two/back_target.jpg", "dummy")
+	createTempFile(t, tempDir, "none/readme.txt", "dummy")
 
-	// Create a file that should be copy.
-	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+	cfg := config{options: fileOptions{path: tempDir, str: "_target"}}
+	plan, err := omitter.NewPlan(cfg.planOptions(nil))
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	violations, err := checkPerDir(tempDir, plan.Pairs, 1, 1)
+	if err != nil {
+		t.Fatalf("check per dir error: %v", err)
+	}
+	if len(violations) != 2 {
+		t.Errorf("expected 2 violations, got %v", violations)
+	}
+}
 
-	// Expected new name after removing "target".
-	newName := "example_.txt"
-	newPath := filepath.Join(dstDir, newName)
+// TestConfirmEach verifies the per file confirmation answers.
+func TestConfirmEach(t *testing.T) {
 	pairs := map[string]string{
-		originalFile: newPath,
+		"a/1.txt": "a/one.txt",
+		"a/2.txt": "a/two.txt",
+		"a/3.txt": "a/three.txt",
+		"b/1.txt": "b/one.txt",
+		"b/2.txt": "b/two.txt",
+		"c/1.txt": "c/one.txt",
+		"c/2.txt": "c/two.txt",
 	}
 
-	// Call copyAction.
-	count, err := copyAction(pairs)
-	if err != nil {
-		t.Fatalf("copy error: %v", err)
+	// "n" rejects a/1, "a" accepts the rest of a/, "y" accepts b/1,
+	// "n" rejects b/2 and "A" accepts all of c/.
+	in := strings.NewReader("n\na\ny\nn\nA\n")
+	accepted := confirmEach(pairs, omitter.NewPrompter(in, io.Discard))
+
+	expected := []string{"a/2.txt", "a/3.txt", "b/1.txt", "c/1.txt", "c/2.txt"}
+	if len(accepted) != len(expected) {
+		t.Fatalf("expected %d accepted files, got %v", len(expected), accepted)
 	}
-	if count != 1 {
-		t.Errorf("expected 1 file copied, got %d", count)
+	for _, k := range expected {
+		if _, ok := accepted[k]; !ok {
+			t.Errorf("expected %s to be accepted", k)
+		}
 	}
 
-	if _, err := os.Stat(newPath); err != nil {
-		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+	accepted = confirmEach(pairs, omitter.NewPrompter(strings.NewReader("y\nq\n"), io.Discard))
+	if len(accepted) != 1 {
+		t.Errorf("expected 1 accepted file before quitting, got %v", accepted)
 	}
 }
 
-// TestCopyAction verifies that the rename function renames files as expected.
-func TestMoveAction(t *testing.T) {
-	srcDir, err := os.MkdirTemp("", "first_dir")
+// TestCompileSearches verifies that repeated searches become substitutions,
+// compiled as regexes with -r, in the order given.
+func TestCompileSearches(t *testing.T) {
+	cfg := config{
+		options:   fileOptions{str: "a+"},
+		searches:  []string{"a+", "b+", "c+"},
+		replaces:  []string{"x", "y"},
+		withRegex: true,
+	}
+	pattern := compileSearches(&cfg)
+	if pattern == nil || pattern.String() != "a+" {
+		t.Fatalf("expected the pattern of the first search, got %v", pattern)
+	}
+	if len(cfg.substitutions) != 2 {
+		t.Fatalf("expected 2 substitutions, got %v", cfg.substitutions)
+	}
+	for i, want := range []omitter.Substitution{{Str: "b+", Replace: "y"}, {Str: "c+"}} {
+		got := cfg.substitutions[i]
+		if got.Str != want.Str || got.Replace != want.Replace || got.Pattern == nil {
+			t.Errorf("substitution %d: expected %q -> %q as a regex, got %+v", i, want.Str, want.Replace, got)
+		}
+	}
+}
+
+// TestConformanceKeyInputs verifies that changing any input of a plan changes its cache key.
+func TestConformanceKeyInputs(t *testing.T) {
+	tempDir := t.TempDir()
+	dictPath := createTempFile(t, tempDir, "dict.txt", "colour,color\n")
+	otherDictPath := createTempFile(t, tempDir, "other_dict.txt", "colour,colr\n")
+	dict, err := loadDict(dictPath)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(srcDir)
-
-	dstDir, err := os.MkdirTemp("", "second_dir")
+	otherDict, err := loadDict(otherDictPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := omitter.ParseTemplate("{name}_a{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherTemplate, err := omitter.ParseTemplate("{name}_b{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertions, err := omitter.ParseAssertions("matches('^[a-z.]+$')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expression, err := omitter.ParseExpression("s/a/b/")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(dstDir)
 
-	// Create a file that should be copy.
-	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+	base := func() config {
+		return config{
+			options:  fileOptions{path: tempDir, str: "target"},
+			dict:     dict,
+			template: template,
+		}
+	}
+	baseKey := conformanceKey(base().planOptions(nil))
+	if key := conformanceKey(base().planOptions(nil)); key != baseKey {
+		t.Fatalf("expected the same key for the same options, got %s and %s", baseKey, key)
+	}
+	prompted := base()
+	prompted.options.onConflict = omitter.CONFLICT_PROMPT
+	if conformanceKey(prompted.planOptions(nil)) != conformanceKey(prompted.planOptions(nil)) {
+		t.Error("expected the same key for the same options with a prompter")
+	}
 
-	// Expected new name after removing "target".
-	newName := "example_.txt"
-	newPath := filepath.Join(dstDir, newName)
-	pairs := map[string]string{
-		originalFile: newPath,
+	changes := map[string]func(cfg *config) *regexp.Regexp{
+		"replace": func(cfg *config) *regexp.Regexp { cfg.options.replace = "x"; return nil },
+		"regex":   func(cfg *config) *regexp.Regexp { return regexp.MustCompile("target") },
+		"substitutions": func(cfg *config) *regexp.Regexp {
+			cfg.substitutions = []omitter.Substitution{{Str: "other"}}
+			return nil
+		},
+		"substitution replace": func(cfg *config) *regexp.Regexp {
+			cfg.substitutions = []omitter.Substitution{{Str: "other", Replace: "x"}}
+			return nil
+		},
+		"expressions": func(cfg *config) *regexp.Regexp {
+			cfg.substitutions = []omitter.Substitution{expression}
+			return nil
+		},
+		"include temp": func(cfg *config) *regexp.Regexp { cfg.withIncludeTemp = true; return nil },
+		"sniff":        func(cfg *config) *regexp.Regexp { cfg.withSniff = true; return nil },
+		"dict":         func(cfg *config) *regexp.Regexp { cfg.dict = otherDict; return nil },
+		"template":     func(cfg *config) *regexp.Regexp { cfg.template = otherTemplate; return nil },
+		"assertions":   func(cfg *config) *regexp.Regexp { cfg.assertions = assertions; return nil },
+		"number": func(cfg *config) *regexp.Regexp {
+			cfg.options.withNumber = true
+			return nil
+		},
 	}
+	for name, change := range changes {
+		cfg := base()
+		pattern := change(&cfg)
+		if conformanceKey(cfg.planOptions(pattern)) == baseKey {
+			t.Errorf("expected a cache miss after changing %s", name)
+		}
+	}
+}
 
-	// Call moveAction.
-	count, err := moveAction(pairs)
-	if err != nil {
-		t.Fatalf("move error: %v", err)
+// TestConformanceCache verifies that cached verdicts are dropped once a dir changes.
+func TestConformanceCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	createTempFile(t, tempDir, "example.txt", "dummy")
+
+	cfg := config{options: fileOptions{path: tempDir, str: "target"}}
+	key := conformanceKey(cfg.planOptions(nil))
+	if conformsCached(key) {
+		t.Fatal("did not expect a cached verdict before caching")
+	}
+	if err := cacheConformance(key, tempDir); err != nil {
+		t.Fatalf("cache conformance error: %v", err)
+	}
+	if !conformsCached(key) {
+		t.Fatal("expected a cached verdict")
+	}
+
+	other := config{options: fileOptions{path: tempDir, str: "other"}}
+	if conformsCached(conformanceKey(other.planOptions(nil))) {
+		t.Error("did not expect a cached verdict for other options")
+	}
+
+	// Adding a file changes the mtime of its dir.
+	later := time.Now().Add(time.Hour)
+	createTempFile(t, tempDir, "example_target.txt", "dummy")
+	if err := os.Chtimes(tempDir, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if conformsCached(key) {
+		t.Error("did not expect a cached verdict after the dir changed")
+	}
+}
+
+// TestOpTimerSlowest verifies that the slowest operations are listed first.
+func TestOpTimerSlowest(t *testing.T) {
+	timer := &opTimer{}
+	after := omitter.ChainAfter(nil, timer.record)
+	for name, elapsed := range map[string]time.Duration{
+		"fast.txt":   time.Millisecond,
+		"slow.txt":   time.Second,
+		"medium.txt": 100 * time.Millisecond,
+	} {
+		if err := after(name, name, elapsed); err != nil {
+			t.Fatalf("record error: %v", err)
+		}
+	}
+
+	slowest := timer.slowest(2)
+	if len(slowest) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(slowest))
 	}
-	if count != 1 {
-		t.Errorf("expected 1 file moved, got %d", count)
+	if slowest[0].oldName != "slow.txt" || slowest[1].oldName != "medium.txt" {
+		t.Errorf("expected slow.txt and medium.txt, got %v", slowest)
 	}
+	if len(timer.slowest(10)) != 3 {
+		t.Errorf("expected all 3 operations when asking for more")
+	}
+}
+
+// TestSetIOPriority verifies that unknown io priorities are rejected.
+func TestSetIOPriority(t *testing.T) {
+	if err := setIOPriority("urgent"); err == nil {
+		t.Error("expected an error for unknown io priority")
+	}
+	if err := setIOPriority(IO_PRIORITY_NORMAL); err != nil {
+		t.Errorf("expected normal io priority to be set, got: %v", err)
+	}
+}
 
-	if _, err := os.Stat(newPath); err != nil {
-		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+// TestDropPairs verifies that files renamed onto kept files are dropped as well.
+func TestDropPairs(t *testing.T) {
+	pairs := map[string]string{
+		"a": "b",
+		"b": "c",
+		"c": "d",
+		"x": "y",
+	}
+	dropped := dropPairs(pairs, map[string]bool{"b": true})
+	if !slices.Equal(dropped, []string{"a", "b"}) {
+		t.Errorf("expected a and b to be dropped, got %v", dropped)
 	}
+	if len(pairs) != 2 || pairs["c"] != "d" || pairs["x"] != "y" {
+		t.Errorf("unexpected pairs left: %v", pairs)
+	}
+}
 
-	if _, err := os.Stat(originalFile); err == nil {
-		t.Errorf("expected old file %s to not exist, error: %v", originalFile, err)
+// TestStrictSkips verifies that only files skipped after matching fail a
+// strict run.
+func TestStrictSkips(t *testing.T) {
+	skipped := []omitter.SkippedFile{
+		{Path: "c", Reason: omitter.SKIP_CONFLICT},
+		{Path: "b", Reason: omitter.SKIP_NO_MATCH},
+		{Path: "a", Reason: omitter.SKIP_EMPTY_RESULT},
+		{Path: "d", Reason: SKIP_NOT_CHANGED},
+		{Path: "e", Reason: SKIP_TARGET_KEPT},
+	}
+	got := strictSkips(skipped)
+	var paths []string
+	for _, f := range got {
+		paths = append(paths, f.Path)
+	}
+	if !slices.Equal(paths, []string{"a", "c", "e"}) {
+		t.Errorf("expected a, c and e, got %v", got)
+	}
+	if got := strictSkips(skipped[1:2]); len(got) != 0 {
+		t.Errorf("did not expect filtered files, got %v", got)
 	}
 }
 
-// TestSearchString verifies the behavior of searchString.
-func TestSearchString(t *testing.T) {
-	// When pattern is nil, it should simply return the str parameter.
-	result := searchString(nil, "target", "example_target.txt")
-	if result != "target" {
-		t.Errorf("expected 'target', got '%s'", result)
+// TestSkipCounts verifies that skipped files are counted by reason.
+func TestSkipCounts(t *testing.T) {
+	skipped := []omitter.SkippedFile{
+		{Path: "a", Reason: SKIP_OPEN_FILE},
+		{Path: "b", Reason: omitter.SKIP_CONFLICT},
+		{Path: "c", Reason: omitter.SKIP_CONFLICT},
 	}
+	if got, want := skipCounts(skipped), "conflict: 2, open_file: 1"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
 
-	// With regex pattern provided.
-	pattern, err := regexp.Compile("target")
+// TestOpenFiles verifies that a file held open by another process is detected.
+func TestOpenFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open files are only detected through /proc")
+	}
+	tempDir, err := os.MkdirTemp("", "testopen")
 	if err != nil {
-		t.Fatalf("failed to compile regex: %v", err)
+		t.Fatal(err)
 	}
-	result = searchString(pattern, "target", "example_target.txt")
-	if result != "target" {
-		t.Errorf("expected 'target', got '%s'", result)
+	defer os.RemoveAll(tempDir)
+
+	busy := createTempFile(t, tempDir, "busy.txt", "dummy")
+	idle := createTempFile(t, tempDir, "idle.txt", "dummy")
+	cmd := exec.Command("sleep", "30")
+	f, err := os.Open(busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.ExtraFiles = []*os.File{f}
+	if err = cmd.Start(); err != nil {
+		t.Skip("can not start a process:", err)
 	}
+	f.Close()
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
 
-	// Test with a non-matching pattern.
-	pattern, err = regexp.Compile("nomatch")
+	open, err := openFiles([]string{busy, idle})
 	if err != nil {
-		t.Fatalf("failed to compile regex: %v", err)
+		t.Fatalf("open files error: %v", err)
 	}
-	result = searchString(pattern, "nomatch", "example_target.txt")
-	if result != "" {
-		t.Errorf("expected empty string, got '%s'", result)
+	if !open[busy] || open[idle] {
+		t.Errorf("expected only %s to be open, got %v", busy, open)
 	}
 }
 
-// TestCanProceedYes simulates a "yes" response for canProceed.
-func TestCanProceedYes(t *testing.T) {
-	// Save original os.Stdin.
-	origStdin := os.Stdin
-	defer func() { os.Stdin = origStdin }()
+// TestProtectedFiles verifies that files without protecting attributes are not reported.
+func TestProtectedFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testprotected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
 
-	// Create a pipe and write "y\n".
-	r, w, err := os.Pipe()
+	file := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	pairs := map[string]string{file: filepath.Join(tempDir, "example_.txt")}
+	if protected := protectedFiles(pairs, omitter.RENAME); len(protected) != 0 {
+		t.Errorf("did not expect protected files, got %v", protected)
+	}
+
+	if runtime.GOOS != "linux" || exec.Command("chattr", "+i", file).Run() != nil {
+		t.Skip("can not make files immutable")
+	}
+	defer exec.Command("chattr", "-i", file).Run()
+	if protected := protectedFiles(pairs, omitter.RENAME); protected[file] == "" {
+		t.Errorf("expected %s to be protected", file)
+	}
+	if protected := protectedFiles(pairs, omitter.COPY); len(protected) != 0 {
+		t.Errorf("did not expect copying to be blocked, got %v", protected)
+	}
+}
+
+// TestPreserveACL verifies that copies keep the ACL of their source with
+// -preserve acl, and that unknown modes are refused.
+func TestPreserveACL(t *testing.T) {
+	if f, err := copyMetadata(omitter.COPY, "", false); err != nil || f != nil {
+		t.Errorf("expected nothing to preserve, got %v", err)
+	}
+	if _, err := copyMetadata(omitter.COPY, "acl,color", false); err == nil {
+		t.Error("expected an error for an unknown preserve mode")
+	}
+	if _, err := copyMetadata(omitter.COPY, "owner, times", false); err != nil {
+		t.Errorf("expected owner and times to be known, got %v", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "testacl")
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = w.WriteString("y\n")
+	defer os.RemoveAll(tempDir)
+
+	src := createTempFile(t, tempDir, "a.txt", "dummy")
+	dst := filepath.Join(tempDir, "b.txt")
+	if runtime.GOOS != "linux" || exec.Command("setfacl", "-m", "u:nobody:r", src).Run() != nil {
+		t.Skip("can not set ACLs")
+	}
+	f, err := copyMetadata(omitter.COPY, PRESERVE_ACL, false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	w.Close()
-	os.Stdin = r
+	if _, err = omitter.Copy(map[string]string{src: dst}, omitter.ExecOptions{CopyMetadata: f}); err != nil {
+		t.Fatalf("copy error: %v", err)
+	}
+	want, _ := exec.Command("getfacl", "--omit-header", src).Output()
+	got, err := exec.Command("getfacl", "--omit-header", dst).Output()
+	if err != nil || string(got) != string(want) {
+		t.Errorf("expected the ACL of %s to be kept, got %q (%v)", dst, got, err)
+	}
+}
 
-	if !canProceed() {
-		t.Error("expected canProceed() to return true for input 'y'")
+// TestDirSummary verifies that affected files are counted by their dir.
+func TestDirSummary(t *testing.T) {
+	pairs := map[string]string{
+		filepath.Join("root", "a", "one.txt"):     filepath.Join("root", "a", "1.txt"),
+		filepath.Join("root", "a", "two.txt"):     filepath.Join("root", "a", "2.txt"),
+		filepath.Join("root", "backups", "x.txt"): filepath.Join("root", "backups", "y.txt"),
+	}
+	counts := dirSummary(pairs)
+	if len(counts) != 2 ||
+		counts[filepath.Join("root", "a")] != 2 ||
+		counts[filepath.Join("root", "backups")] != 1 {
+		t.Errorf("unexpected dir summary: %v", counts)
 	}
 }
 
-// TestCanProceedNo simulates a "no" response for canProceed.
-func TestCanProceedNo(t *testing.T) {
-	origStdin := os.Stdin
-	defer func() { os.Stdin = origStdin }()
+// TestCaptureGroups verifies that files are grouped by the value of the
+// capture group.
+func TestCaptureGroups(t *testing.T) {
+	pairs := map[string]string{
+		filepath.Join("root", "PRJ1_b.txt"): filepath.Join("root", "b.txt"),
+		filepath.Join("root", "PRJ1_a.txt"): filepath.Join("root", "a.txt"),
+		filepath.Join("root", "PRJ2_c.txt"): filepath.Join("root", "c.txt"),
+	}
+	groups := captureGroups(pairs, regexp.MustCompile(`^(PRJ\d+)_`), 1)
+	if len(groups) != 2 ||
+		!slices.Equal(groups["PRJ1"], []string{filepath.Join("root", "PRJ1_a.txt"), filepath.Join("root", "PRJ1_b.txt")}) ||
+		!slices.Equal(groups["PRJ2"], []string{filepath.Join("root", "PRJ2_c.txt")}) {
+		t.Errorf("unexpected groups: %v", groups)
+	}
+}
 
-	r, w, err := os.Pipe()
+// TestByDateTemplate verifies the templates of -by-date.
+func TestByDateTemplate(t *testing.T) {
+	for _, byDate := range []string{BY_DATE_MTIME, BY_DATE_CTIME} {
+		tmpl, err := byDateTemplate(byDate, "")
+		if err != nil {
+			t.Fatalf("%s: %v", byDate, err)
+		}
+		if _, err = omitter.ParseTemplate(tmpl); err != nil {
+			t.Errorf("%s: parse template error: %v", byDate, err)
+		}
+	}
+	if _, err := byDateTemplate("atime", ""); err == nil {
+		t.Error("expected an error for an unknown time")
+	}
+	if _, err := byDateTemplate(BY_DATE_MTIME, "{name}"); err == nil {
+		t.Error("expected an error together with a template")
+	}
+}
+
+// TestAskRemap verifies that every value is asked for, and empty answers
+// keep the value.
+func TestAskRemap(t *testing.T) {
+	remap := askRemap([]string{"A", "B", "C"}, omitter.NewPrompter(strings.NewReader("X\n\nZ"), io.Discard))
+	if len(remap) != 2 || remap["A"] != "X" || remap["C"] != "Z" {
+		t.Errorf("unexpected remap: %v", remap)
+	}
+}
+
+// TestLoadDict verifies that dict files are read, and invalid rows refused.
+func TestLoadDict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testdict")
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = w.WriteString("n\n")
+	defer os.RemoveAll(tempDir)
+
+	path := createTempFile(t, tempDir, "map.csv", "E100,alice\n\"E,200\",bob\n")
+	dict, err := loadDict(path)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("load dict error: %v", err)
 	}
-	w.Close()
-	os.Stdin = r
+	if len(dict) != 2 || dict["E100"] != "alice" || dict["E,200"] != "bob" {
+		t.Errorf("unexpected dict: %v", dict)
+	}
+	for _, content := range []string{"a,b\na,c\n", ",b\n", "a,b,c\n", "a,b/c\n"} {
+		path := createTempFile(t, tempDir, "invalid.csv", content)
+		if _, err := loadDict(path); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
 
-	if canProceed() {
-		t.Error("expected canProceed() to return false for input 'n'")
+// TestWholePlanFlags verifies that flags needing the whole plan are refused
+// with -stream.
+func TestWholePlanFlags(t *testing.T) {
+	var cfg config
+	if flags := wholePlanFlags(cfg); len(flags) != 0 {
+		t.Errorf("did not expect flags, got %v", flags)
+	}
+	cfg.order = "smallest-first"
+	cfg.workers = 4
+	cfg.withAtomic = true
+	if flags := wholePlanFlags(cfg); !slices.Equal(flags, []string{"-order", "-workers"}) {
+		t.Errorf("unexpected flags: %v", flags)
+	}
+	cfg.options.onConflict = omitter.CONFLICT_OVERWRITE
+	if flags := wholePlanFlags(cfg); !slices.Contains(flags, "-on-conflict overwrite") {
+		t.Errorf("expected overwriting to be refused, got %v", flags)
 	}
 }
 
-// TestGetActionName verifies returning action name(rename or copy).
-func TestGetActionName(t *testing.T) {
-	actionName1 := getActionName("output_is_not_empty", "copy")
-	if actionName1 != COPY {
-		t.Errorf("expected %q, got %q", COPY, actionName1)
+// TestWalkFlags verifies that flags selecting files or computing names are
+// refused with -plan-in, unless left at their defaults.
+func TestWalkFlags(t *testing.T) {
+	var cfg config
+	cfg.options.allowFallback = omitter.FALLBACK_REPLACE
+	cfg.options.sanitizeChar = "_"
+	cfg.options.numberStart, cfg.options.numberStep = 1, 1
+	cfg.options.numberFormat = omitter.DEFAULT_NUMBER_FORMAT
+	cfg.options.numberSort = omitter.NUMBER_SORT_NAME
+	cfg.options.conflictSuffix = omitter.DEFAULT_CONFLICT_SUFFIX
+	cfg.options.suffixPlacement = omitter.PLACEMENT_BEFORE_EXT
+	cfg.options.onConflict = omitter.CONFLICT_SUFFIX
+	if flags := walkFlags(cfg); len(flags) != 0 {
+		t.Errorf("did not expect flags, got %v", flags)
+	}
+	cfg.searches = []string{"x"}
+	cfg.options.str = "x"
+	cfg.options.template = "{name}"
+	cfg.options.include = "*.jpg"
+	cfg.withRegex = true
+	want := []string{"-include", "-r", "-s", "-template"}
+	if flags := walkFlags(cfg); !slices.Equal(flags, want) {
+		t.Errorf("expected %v, got %v", want, flags)
 	}
+}
 
-	actionName2 := getActionName("output_is_not_empty", "mv")
-	if actionName2 != MOVE {
-		t.Errorf("expected %q, got %q", MOVE, actionName2)
+// TestResultReport verifies the status of every file after a failed run.
+func TestResultReport(t *testing.T) {
+	pairs := map[string]string{"a": "a1", "b": "b1", "c": "c1"}
+	done := doneRecorder{"a": true}
+	fail := errors.New("permission denied")
+	err := errors.Join(&omitter.FileError{Old: "b", New: "b1", Err: fail}, errors.New("stopped"))
+
+	r := resultReport(pairs, omitter.RENAME, done, err, false)
+	want := []jsonFile{
+		{Old: "a", New: "a1", Action: omitter.RENAME, Status: STATUS_DONE},
+		{Old: "b", New: "b1", Action: omitter.RENAME, Status: STATUS_FAILED, Error: fail.Error()},
+		{Old: "c", New: "c1", Action: omitter.RENAME, Status: STATUS_PENDING},
+	}
+	if !slices.Equal(r.Files, want) {
+		t.Errorf("expected %v, got %v", want, r.Files)
+	}
+	if r.Error != err.Error() {
+		t.Errorf("expected error %q, got %q", err.Error(), r.Error)
 	}
 
-	actionName3 := getActionName("", "")
-	if actionName3 != RENAME {
-		t.Errorf("expected %q, got %q", RENAME, actionName3)
+	r = resultReport(pairs, omitter.RENAME, done, err, true)
+	if r.Files[0].Status != STATUS_ROLLED_BACK {
+		t.Errorf("expected %s, got %s", STATUS_ROLLED_BACK, r.Files[0].Status)
 	}
 }
 
-// TestCopyFile verifies the copying single file from src to dst.
-func TestCopyFile(t *testing.T) {
+// TestScanTree verifies the counts of the tree summary.
+func TestScanTree(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testscan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err = os.MkdirAll(filepath.Join(tempDir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createTempFile(t, tempDir, "one.txt", "12345")
+	createTempFile(t, tempDir, "a/two.TXT", "123")
+	createTempFile(t, tempDir, "a/b/three.jpg", "1")
+
+	summary, err := scanTree(tempDir)
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if summary.files != 3 || summary.dirs != 3 || summary.bytes != 9 || summary.depth != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.exts[".txt"] != 2 || summary.exts[".jpg"] != 1 {
+		t.Errorf("unexpected extension histogram: %v", summary.exts)
+	}
+}
+
+// TestEstimateTransfer verifies the estimated size of a copy.
+func TestEstimateTransfer(t *testing.T) {
 	srcDir, err := os.MkdirTemp("", "first_dir")
 	if err != nil {
 		t.Fatal(err)
@@ -435,45 +939,140 @@ func TestCopyFile(t *testing.T) {
 	}
 	defer os.RemoveAll(dstDir)
 
-	var (
-		fileName    string = "file1.txt"
-		fileContent string = "sample_content"
-	)
-
-	// Create file.
-	file1 := createTempFile(t, srcDir, fileName, fileContent)
-
-	newPath := filepath.Join(dstDir, fileName)
-	if err := copyFile(file1, newPath); err != nil {
-		t.Errorf("expected copy %q to %q", file1, newPath)
+	file1 := createTempFile(t, srcDir, "one.txt", "12345")
+	file2 := createTempFile(t, srcDir, "two.txt", "1234567890")
+	pairs := map[string]string{
+		file1: filepath.Join(dstDir, "one.txt"),
+		file2: filepath.Join(dstDir, "two.txt"),
 	}
 
-	if _, err := os.Stat(newPath); os.IsNotExist(err) {
-		t.Errorf("expected copied file %q to be in %q", newPath, dstDir)
+	est, err := estimateTransfer(pairs)
+	if err != nil {
+		t.Fatalf("estimate error: %v", err)
+	}
+	if est.bytes != 15 {
+		t.Errorf("expected 15 bytes, got %d", est.bytes)
+	}
+	entries, err := os.ReadDir(dstDir)
+	if err != nil {
+		t.Fatal(err)
 	}
+	if len(entries) != 0 {
+		t.Errorf("expected the sample file to be removed, got %d entries", len(entries))
+	}
+}
 
-	b, err := os.ReadFile(newPath)
+// TestReadOnlyMounts verifies that writable dirs are not reported as read-only.
+func TestReadOnlyMounts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testreadonly")
 	if err != nil {
-		t.Fatalf("failed to read file: %v", err)
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(tempDir)
 
-	if string(b) != fileContent {
-		t.Errorf("expected %s. got %s", fileContent, string(b))
+	file1 := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	pairs := map[string]string{file1: filepath.Join(tempDir, "example_.txt")}
+	for _, action := range []string{omitter.RENAME, omitter.COPY, omitter.MOVE} {
+		if blocked := readOnlyMounts(pairs, action); len(blocked) != 0 {
+			t.Errorf("%s: did not expect read-only mounts, got %v", action, blocked)
+		}
+	}
+	if mount := mountPoint(tempDir); mount == "" {
+		t.Errorf("expected a mount point for %s", tempDir)
 	}
 }
 
-func TestTransmissionType(t *testing.T) {
-	tt_copy := getTransmissionType("copy")
-	tt_move := getTransmissionType("move")
-	tt_default := getTransmissionType("")
+// TestLookupOwner verifies the user:group forms of -owner.
+func TestLookupOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("owners are Unix only")
+	}
+	tests := []struct {
+		owner    string
+		uid, gid int
+	}{
+		{"0:0", 0, 0},
+		{"0", 0, -1},
+		{":0", -1, 0},
+		{"root:0", 0, 0},
+	}
+	for _, tc := range tests {
+		uid, gid, err := lookupOwner(tc.owner)
+		if err != nil {
+			t.Errorf("lookupOwner(%q) error: %v", tc.owner, err)
+			continue
+		}
+		if uid != tc.uid || gid != tc.gid {
+			t.Errorf("lookupOwner(%q) = %d, %d, want %d, %d", tc.owner, uid, gid, tc.uid, tc.gid)
+		}
+	}
+	for _, owner := range []string{"", ":", "no-such-user-omitter"} {
+		if _, _, err := lookupOwner(owner); err == nil {
+			t.Errorf("expected an error for %q", owner)
+		}
+	}
+}
+
+// TestExitCode verifies that failures exit by the kind of their error, even
+// when it is wrapped.
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&omitter.FileError{Old: "a", New: "b", Err: omitter.ErrConflict}, exitConflict},
+		{&omitter.AssertionError{}, exitInvalidName},
+		{omitter.SkippedFile{Path: "a", Reason: omitter.SKIP_CONFLICT}.Err(), exitSkipped},
+		{fmt.Errorf("move: %w", omitter.ErrCrossDevice), exitCrossDevice},
+		{errors.New("permission denied"), 2},
+	}
+	for _, tc := range tests {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, got)
+		}
+	}
+}
 
-	if tt_copy != COPY {
-		t.Errorf("expected %s. got %s", COPY, tt_copy)
+// TestParseSize verifies that sizes are parsed with binary units, and that
+// malformed ones are refused.
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"1024": 1024, "512M": 512 << 20, "2GiB": 2 << 30, "64 kb": 64 << 10, "1T": 1 << 40,
+	} {
+		if got, err := parseSize(s); err != nil || got != want {
+			t.Errorf("%q: expected %d, got %d (%v)", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "M", "1.5G", "12X", "-1G", "99999999999T"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
 	}
-	if tt_move != MOVE {
-		t.Errorf("expected %s. got %s", MOVE, tt_move)
+}
+
+// TestSeededRand verifies that the names of a template with ids are the same
+// for the same seed, and differ for another one.
+func TestSeededRand(t *testing.T) {
+	tempDir := t.TempDir()
+	file := createTempFile(t, tempDir, "a.txt", "dummy")
+	tmpl, err := omitter.ParseTemplate("{uuid}{ext}")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if tt_default != COPY {
-		t.Errorf("expected %s. got %s", COPY, tt_default)
+	name := func(seed uint64) string {
+		t.Helper()
+		cfg := config{template: tmpl, random: seededRand(seed)}
+		cfg.options.path = tempDir
+		p, err := omitter.NewPlan(cfg.planOptions(nil))
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		return p.Pairs[file]
+	}
+	if a, b := name(1), name(1); a != b {
+		t.Errorf("expected the same name for the same seed, got %s and %s", a, b)
+	}
+	if a, b := name(1), name(2); a == b {
+		t.Errorf("expected other names for other seeds, got %s twice", a)
 	}
 }
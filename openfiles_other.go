@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+var errOpenFilesUnsupported = errors.New("detecting open files is not supported on this platform")
+
+func openFiles(paths []string) (map[string]bool, error) {
+	return nil, errOpenFilesUnsupported
+}
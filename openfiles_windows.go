@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modrstrtmgr             = windows.NewLazySystemDLL("rstrtmgr.dll")
+	procRmStartSession      = modrstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = modrstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = modrstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = modrstrtmgr.NewProc("RmEndSession")
+)
+
+// rmSessionKeyLen is CCH_RM_SESSION_KEY, plus the terminating null.
+const rmSessionKeyLen = 33
+
+// openFiles returns the paths which are held open by other processes, as
+// reported by the Restart Manager.
+func openFiles(paths []string) (map[string]bool, error) {
+	open := make(map[string]bool)
+	for _, path := range paths {
+		inUse, err := isInUse(path)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", path, err)
+		}
+		if inUse {
+			open[path] = true
+		}
+	}
+	return open, nil
+}
+
+// isInUse registers path in its own Restart Manager session, and reports
+// whether any process is using it.
+func isInUse(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	name, err := windows.UTF16PtrFromString(abs)
+	if err != nil {
+		return false, err
+	}
+
+	var session uint32
+	key := make([]uint16, rmSessionKeyLen)
+	r, _, _ := procRmStartSession.Call(
+		uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&key[0])),
+	)
+	if r != 0 {
+		return false, fmt.Errorf("start restart manager session: %w", windows.Errno(r))
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	r, _, _ = procRmRegisterResources.Call(
+		uintptr(session), 1, uintptr(unsafe.Pointer(&name)), 0, 0, 0, 0,
+	)
+	if r != 0 {
+		return false, fmt.Errorf("register resource: %w", windows.Errno(r))
+	}
+
+	// Without room for the process list, only the number of processes is
+	// returned, along with ERROR_MORE_DATA if there are any.
+	var needed, count, reasons uint32
+	r, _, _ = procRmGetList.Call(
+		uintptr(session),
+		uintptr(unsafe.Pointer(&needed)),
+		uintptr(unsafe.Pointer(&count)),
+		0,
+		uintptr(unsafe.Pointer(&reasons)),
+	)
+	if r != 0 && windows.Errno(r) != windows.ERROR_MORE_DATA {
+		return false, fmt.Errorf("list processes: %w", windows.Errno(r))
+	}
+	return needed > 0, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// originalName is the content of a sidecar file.
+type originalName struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// rememberOriginal returns the AfterFunc storing original names according to
+// mode. It returns nil if mode is empty.
+func rememberOriginal(mode string) (omitter.AfterFunc, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case REMEMBER_XATTR:
+		return func(oldName, newName string, _ time.Duration) error {
+			// Files renamed before keep their first name.
+			if _, err := getXattr(newName, originalXattr); err == nil {
+				return nil
+			}
+			return setXattr(newName, originalXattr, []byte(filepath.Base(oldName)))
+		}, nil
+	case REMEMBER_SIDECAR:
+		return writeSidecar, nil
+	default:
+		return nil, fmt.Errorf("unknown remember-original mode: %q", mode)
+	}
+}
+
+// writeSidecar remembers the original name of the file renamed, copied or
+// moved from oldName to newName in a sidecar next to it. Files with a sidecar
+// already keep the name it holds, and the sidecar goes along with them,
+// unless they were copied.
+func writeSidecar(oldName, newName string, _ time.Duration) error {
+	sidecar := oldName + sidecarExt
+	b, err := os.ReadFile(sidecar)
+	var orig originalName
+	if err != nil || json.Unmarshal(b, &orig) != nil || orig.Name == "" {
+		absPath, err := filepath.Abs(oldName)
+		if err != nil {
+			return fmt.Errorf("resolve absolute path: %w", err)
+		}
+		if b, err = json.MarshalIndent(
+			originalName{Name: filepath.Base(oldName), Path: absPath}, "", "  ",
+		); err != nil {
+			return fmt.Errorf("marshal sidecar: %w", err)
+		}
+		sidecar = ""
+	}
+	if err = os.WriteFile(newName+sidecarExt, b, 0o644); err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	if _, err = os.Lstat(oldName); sidecar != "" && os.IsNotExist(err) {
+		if err = os.Remove(sidecar); err != nil {
+			return fmt.Errorf("remove sidecar: %w", err)
+		}
+	}
+	return nil
+}
+
+func restoreNames(args []string) {
+	flags := flag.NewFlagSet("restore-names", flag.ExitOnError)
+	path := flags.String("p", "", "path to dir")
+	withDryRun := flags.Bool("d", false, "dry run")
+	withVerbose := flags.Bool("v", false, "verbose")
+	flags.Parse(args)
+	if *path == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	pairs, err := collectOriginals(*path, os.Stdout)
+	if err != nil {
+		fmt.Println("collect original names:", err)
+		os.Exit(2)
+	}
+	if *withDryRun {
+		fmt.Printf("Found %d file(s) to restore!\n", len(pairs))
+		if *withVerbose {
+			for k, v := range pairs {
+				fmt.Printf("%s -> %s\n", k, v)
+			}
+		}
+		return
+	}
+
+	start := time.Now()
+	n, err := omitter.Rename(pairs, omitter.ExecOptions{After: forgetOriginal})
+	if err != nil {
+		fmt.Println("Restoring:", err)
+		fmt.Printf("%d file(s) were restored.\n", n)
+		os.Exit(2)
+	}
+	if *withVerbose {
+		fmt.Printf("Restored %d file(s) in %s.\n", n, time.Since(start))
+	}
+}
+
+// collectOriginals walks root and maps every file with a remembered original
+// name, either in a sidecar or in an xattr, to its original path. Files whose
+// original name is already taken are left alone, and so are .orig files which
+// are not sidecars, with a warning to out.
+func collectOriginals(root string, out io.Writer) (map[string]string, error) {
+	pairs := make(map[string]string)
+	taken := make(map[string]bool)
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case file.IsDir():
+				return nil
+			}
+
+			var name string
+			if strings.HasSuffix(path, sidecarExt) {
+				target := strings.TrimSuffix(path, sidecarExt)
+				if _, err := os.Stat(target); err != nil {
+					return nil
+				}
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("read sidecar %q: %w", path, err)
+				}
+				var orig originalName
+				if err = json.Unmarshal(b, &orig); err != nil {
+					fmt.Fprintf(out, "Warning: skipping %s, which is not a sidecar: %v\n", path, err)
+					return nil
+				}
+				path, name = target, orig.Name
+			} else {
+				b, err := getXattr(path, originalXattr)
+				if err != nil {
+					return nil
+				}
+				name = string(b)
+			}
+
+			if name == "" || name != filepath.Base(name) {
+				return nil
+			}
+			newPath := filepath.Join(filepath.Dir(path), name)
+			if newPath == path || taken[newPath] {
+				return nil
+			}
+			if _, err := os.Stat(newPath); err == nil {
+				return nil
+			}
+			taken[newPath] = true
+			pairs[path] = newPath
+			return nil
+		})
+	return pairs, err
+}
+
+// forgetOriginal removes the remembered original name of a restored file.
+func forgetOriginal(oldName, newName string, _ time.Duration) error {
+	err := os.Remove(oldName + sidecarExt)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove sidecar: %w", err)
+	}
+	if _, err = getXattr(newName, originalXattr); err == nil {
+		return removeXattr(newName, originalXattr)
+	}
+	return nil
+}
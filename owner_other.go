@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// lookupOwner fails, as files have no Unix owners on this platform.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	return -1, -1, errors.New("changing owners is only supported on Unix")
+}
+
+// preserveOwner does nothing, as files have no Unix owners on this platform.
+func preserveOwner(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lookupOwner parses the user:group of -owner, either of which may be a name
+// or a numeric id, or be left out to keep it unchanged, as in user or :group.
+// Left out ids are -1.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+	if userName == "" && groupName == "" {
+		return -1, -1, fmt.Errorf("empty owner")
+	}
+	uid, gid = -1, -1
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// preserveOwner gives dst the owner and group of src, when running as root,
+// as others can not give files away. The mode is set again, as changing the
+// owner clears the setuid and setgid bits.
+func preserveOwner(src, dst string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err = os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+		return fmt.Errorf("preserve owner: %w", err)
+	}
+	if info.Mode().Type() == 0 {
+		if err = os.Chmod(dst, info.Mode()); err != nil {
+			return fmt.Errorf("preserve owner: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// runPipeline applies the stages of the -pipeline of cfg in order, each as a
+// run of omitter with args and the profile of the stage. Stages with
+// confirm: true are dry run first, and only applied once confirmed. A failed
+// stage stops the pipeline.
+func runPipeline(cfg config, args []string) {
+	path := cfg.configPath
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	c, err := loadConfigFile(path)
+	if err != nil {
+		fmt.Println("load config:", err)
+		os.Exit(1)
+	}
+	stages, ok := c.pipelines[cfg.pipeline]
+	if !ok {
+		fmt.Printf("unknown pipeline: %q\n", cfg.pipeline)
+		os.Exit(1)
+	}
+	confirm := make([]bool, len(stages))
+	for i, stage := range stages {
+		profile, ok := c.profiles[stage]
+		if !ok {
+			fmt.Printf("unknown profile of pipeline %q: %q\n", cfg.pipeline, stage)
+			os.Exit(1)
+		}
+		if value, ok := profile[confirmKey]; ok {
+			if confirm[i], err = strconv.ParseBool(value); err != nil {
+				fmt.Printf("invalid %s of profile %q: %q\n", confirmKey, stage, value)
+				os.Exit(1)
+			}
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println("find executable:", err)
+		os.Exit(2)
+	}
+
+	for i, stage := range stages {
+		fmt.Printf("Stage %d/%d: %s\n", i+1, len(stages), stage)
+		stageArgs := append(slices.Clone(args), "-profile", stage)
+		// A dry run of the whole pipeline needs no gates.
+		if confirm[i] && !cfg.withDryRun {
+			code := runStage(exe, append(slices.Clone(stageArgs), "-d", "-v"))
+			if code == exitNothingToDo {
+				continue
+			}
+			if code != 0 {
+				os.Exit(code)
+			}
+			if !omitter.Confirm(cfg.prompter, fmt.Sprintf("Apply stage %s?(y/n) ", stage)) {
+				fmt.Println("Aborted.")
+				return
+			}
+		}
+		if code := runStage(exe, stageArgs); code != 0 && code != exitNothingToDo {
+			fmt.Printf("Stage %s failed, the rest of the pipeline was not run.\n", stage)
+			os.Exit(code)
+		}
+	}
+}
+
+// runStage runs exe with args in the foreground, and returns its exit code.
+func runStage(exe string, args []string) int {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	case err != nil:
+		fmt.Println("run stage:", err)
+		return 2
+	}
+	return 0
+}
+
+// withoutFlag returns args without the flag name and its value, given as
+// -name value or -name=value, with one or two dashes.
+func withoutFlag(args []string, name string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(kept, args[i:]...)
+		}
+		flagName := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+		case flagName == name:
+			i++
+			continue
+		case strings.HasPrefix(flagName, name+"="):
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
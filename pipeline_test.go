@@ -0,0 +1,18 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestWithoutFlag verifies that every form of a flag is left out of the
+// arguments of stages.
+func TestWithoutFlag(t *testing.T) {
+	args := []string{
+		"-p", "dir", "-pipeline", "tidy", "--pipeline=tidy", "-pipeline=x", "-v", "--", "-pipeline",
+	}
+	want := []string{"-p", "dir", "-v", "--", "-pipeline"}
+	if got := withoutFlag(args, "pipeline"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
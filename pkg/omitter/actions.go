@@ -0,0 +1,764 @@
+package omitter
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pooulad/ravan"
+)
+
+const (
+	ORDER_SMALLEST_FIRST string = "smallest-first"
+	ORDER_LARGEST_FIRST  string = "largest-first"
+	ORDER_OLDEST_FIRST   string = "oldest-first"
+)
+
+// Policies of file operations which time out.
+const (
+	TIMEOUT_ABORT string = "abort"
+	TIMEOUT_SKIP  string = "skip"
+)
+
+// AfterFunc is called once a file has been successfully renamed, copied or
+// moved from oldName to newName, which took elapsed.
+type AfterFunc func(oldName, newName string, elapsed time.Duration) error
+
+// ChainAfter returns an AfterFunc calling every non-nil fn in order.
+func ChainAfter(fns ...AfterFunc) AfterFunc {
+	return func(oldName, newName string, elapsed time.Duration) error {
+		for _, fn := range fns {
+			if fn == nil {
+				continue
+			}
+			if err := fn(oldName, newName, elapsed); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Clock tells the time and waits. It is injected, so embedders and tests can
+// control time.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time        { return time.Now() }
+func (SystemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Controller lets another party pause or stop an execution.
+type Controller interface {
+	// Checkpoint is called before every file operation. It may block, and
+	// an error stops the execution.
+	Checkpoint() error
+	// Advance is called after every file operation.
+	Advance()
+}
+
+// ExecOptions tune how the actions carry out a plan.
+type ExecOptions struct {
+	// After, if set, is called after every file operation, never
+	// concurrently.
+	After AfterFunc
+	// Chunks is the number of parallel ranges big files are copied in.
+	Chunks int
+	// Order is the order files are processed in, sorted by name if empty.
+	Order string
+	// Workers is the number of files copied or moved at once. Files are
+	// processed one at a time if it is not above one.
+	Workers int
+	// Window, if set, is the time of day files may be processed in.
+	Window *Window
+	// Control, if set, lets another party pause or stop the execution.
+	Control Controller
+	// Context, if set, stops the execution once it is done, with its error.
+	// No file operation is started after, and copies in progress are
+	// abandoned, without leaving partial files behind.
+	Context context.Context
+	// Clock times the file operations, the system clock if nil.
+	Clock Clock
+	// Rand is the source of the random suffixes of the temporary names files
+	// are parked under to break rename cycles, crypto/rand if nil.
+	Rand io.Reader
+	// HideProgress keeps the progress bar off the standard output.
+	HideProgress bool
+	// CopyMetadata, if set, is called once the data of a file is copied, and
+	// before the source of a move is removed, to carry over what the copy
+	// loses. Files moved within a file system are renamed instead, and keep
+	// their metadata, so it is called with their new path as both.
+	CopyMetadata func(src, dst string) error
+	// KeepTimes gives copies the access and modification times their source
+	// had before it was read.
+	KeepTimes bool
+	// OpTimeout, if positive, is the time a file operation may take before
+	// it is given up on with ErrTimeout, such as a rename hanging on an
+	// unreachable network file system. Copies are stopped, but renames can
+	// not be interrupted, and may still complete later.
+	OpTimeout time.Duration
+	// OnTimeout is the policy of operations which time out: TIMEOUT_ABORT,
+	// the default, stops the execution, while TIMEOUT_SKIP carries on with
+	// the other files and returns the errors at the end. Timeouts in the
+	// middle of breaking a rename cycle always stop it.
+	OnTimeout string
+	// Stalled, if set, is called for every operation which timed out, never
+	// concurrently, so it can be recorded to be checked or undone later.
+	Stalled func(oldName, newName string)
+	// MaxOpenFiles and MaxMemory, if positive, are soft limits of the files
+	// which the copies and moves in progress hold open, and of the bytes of
+	// their buffers. Workers wait for other operations to finish rather than
+	// go over them.
+	MaxOpenFiles int
+	MaxMemory    int64
+}
+
+// fileOp carries out a file operation from oldName to newName with o.
+type fileOp func(o ExecOptions, oldName, newName string) error
+
+func renameOp(_ ExecOptions, oldName, newName string) error {
+	return renameFile(oldName, newName)
+}
+
+func (o ExecOptions) now() time.Time {
+	if o.Clock == nil {
+		return time.Now()
+	}
+	return o.Clock.Now()
+}
+
+func (o ExecOptions) random() io.Reader {
+	if o.Rand == nil {
+		return rand.Reader
+	}
+	return o.Rand
+}
+
+func (o ExecOptions) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// before waits for the window and the controller before a file operation,
+// unless the context is done.
+func (o ExecOptions) before() error {
+	if err := o.context().Err(); err != nil {
+		return err
+	}
+	o.Window.Wait(o.Clock)
+	if o.Control == nil {
+		return nil
+	}
+	return o.Control.Checkpoint()
+}
+
+// timed carries out op, giving up on it with ErrTimeout once it takes longer
+// than OpTimeout.
+func (o ExecOptions) timed(op fileOp, oldName, newName string) error {
+	if o.OpTimeout <= 0 {
+		return op(o, oldName, newName)
+	}
+	parent := o.context()
+	ctx, cancel := context.WithTimeout(parent, o.OpTimeout)
+	defer cancel()
+	o.Context = ctx
+	errc := make(chan error, 1)
+	go func() { errc <- op(o, oldName, newName) }()
+	select {
+	case err := <-errc:
+		if parent.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			// A copy was stopped by the timeout.
+			return fmt.Errorf("%w after %s", ErrTimeout, o.OpTimeout)
+		}
+		return err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			// Interrupted operations are waited for, as without a timeout.
+			return <-errc
+		}
+		return fmt.Errorf("%w after %s", ErrTimeout, o.OpTimeout)
+	}
+}
+
+// stalled reports the operation from oldName to newName to Stalled, if err
+// is a timeout.
+func (o ExecOptions) stalled(oldName, newName string, err error) {
+	if o.Stalled != nil && errors.Is(err, ErrTimeout) {
+		o.Stalled(oldName, newName)
+	}
+}
+
+// skipTimeout reports whether the execution carries on after err.
+func (o ExecOptions) skipTimeout(err error) bool {
+	return o.OnTimeout == TIMEOUT_SKIP && errors.Is(err, ErrTimeout)
+}
+
+// progress returns the function drawing the progress bar, which does
+// nothing if it is hidden.
+func (o ExecOptions) progress() (func(float64), error) {
+	if o.HideProgress {
+		return func(float64) {}, nil
+	}
+	r, err := ravan.New(ravan.WithWidth(50))
+	if err != nil {
+		return nil, fmt.Errorf("init raven: %w", err)
+	}
+	return r.Draw, nil
+}
+
+// copy copies the data of src to dst, in chunks if set, and then its
+// metadata and its times if set.
+func (o ExecOptions) copy(src, dst string) error {
+	var info fs.FileInfo
+	var err error
+	if o.KeepTimes {
+		// Reading the source changes its access time.
+		if info, err = os.Stat(src); err != nil {
+			return fmt.Errorf("get file(%q) info: %w", src, err)
+		}
+	}
+	if o.Chunks > 1 {
+		err = copyFileChunked(o.context(), src, dst, o.Chunks)
+	} else {
+		err = copyFile(o.context(), src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if o.CopyMetadata != nil {
+		if err = o.CopyMetadata(src, dst); err != nil {
+			// Do not leave a copy without its metadata behind.
+			os.Remove(dst)
+			return fmt.Errorf("copy metadata: %w", err)
+		}
+	}
+	// Times go last, so nothing touches the copy after them.
+	if info != nil {
+		if err = os.Chtimes(dst, accessTime(info), info.ModTime()); err != nil {
+			os.Remove(dst)
+			return fmt.Errorf("keep times: %w", err)
+		}
+	}
+	return nil
+}
+
+// move renames src to dst, or where they are on different file systems,
+// copies src to dst, verifies the copy and then removes src.
+func (o ExecOptions) move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		if o.CopyMetadata != nil {
+			if err = o.CopyMetadata(dst, dst); err != nil {
+				// Keep the source, as a failed copy would.
+				os.Rename(dst, src)
+				return fmt.Errorf("copy metadata: %w", err)
+			}
+		}
+		return nil
+	}
+	if !crossDevice(err) {
+		return err
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("get file(%q) info: %w", src, err)
+	}
+	if err = o.copy(src, dst); err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err == nil && dstInfo.Size() != srcInfo.Size() {
+		err = fmt.Errorf("copy has %d bytes instead of %d", dstInfo.Size(), srcInfo.Size())
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("verify copy: %w", err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("remove source file after copy: %w", err)
+	}
+	return nil
+}
+
+// done reports a file operation which started at start.
+func (o ExecOptions) done(oldName, newName string, start time.Time) error {
+	if o.Control != nil {
+		o.Control.Advance()
+	}
+	if o.After == nil {
+		return nil
+	}
+	if err := o.After(oldName, newName, o.now().Sub(start)); err != nil {
+		return fmt.Errorf("%q: %w", newName, err)
+	}
+	return nil
+}
+
+// Result is the outcome of applying a plan.
+type Result struct {
+	// Action is the one of RENAME, COPY or MOVE which was carried out.
+	Action string
+	// Count is the number of files which were processed, even on errors.
+	Count   uint
+	Elapsed time.Duration
+}
+
+// Apply carries out the plan with action, which is one of RENAME, COPY or
+// MOVE.
+func (p Plan) Apply(action string, opts ExecOptions) (Result, error) {
+	res := Result{Action: action}
+	start := opts.now()
+	var err error
+	switch action {
+	case RENAME:
+		res.Count, err = Rename(p.Pairs, opts)
+	case COPY:
+		res.Count, err = Copy(p.Pairs, opts)
+	case MOVE:
+		res.Count, err = Move(p.Pairs, opts)
+	default:
+		return res, fmt.Errorf("unknown action: %q", action)
+	}
+	res.Elapsed = opts.now().Sub(start)
+	return res, err
+}
+
+// Copy copies the files of pairs to their new paths.
+func Copy(pairs map[string]string, opts ExecOptions) (uint, error) {
+	return transfer(pairs, opts, ExecOptions.copy)
+}
+
+// Move moves the files of pairs to their new paths, by renaming them, or by
+// copying them and removing the source across file systems.
+func Move(pairs map[string]string, opts ExecOptions) (uint, error) {
+	return transfer(pairs, opts, ExecOptions.move)
+}
+
+// transfer carries out op for every file of pairs, on opts.Workers
+// goroutines. Sequential runs stop at the first error, while parallel ones
+// carry on with the other files and return every error, unless an operation
+// times out under TIMEOUT_ABORT.
+func transfer(pairs map[string]string, opts ExecOptions, op fileOp) (uint, error) {
+	keys, err := orderKeys(pairs, opts.Order)
+	if err != nil {
+		return 0, err
+	}
+	draw, err := opts.progress()
+	if err != nil {
+		return 0, err
+	}
+
+	var mu sync.Mutex
+	var count uint
+	total := len(pairs)
+	// Every copy holds its source and its destination open, with a buffer
+	// for each of its streams.
+	files, memory := newBudget(int64(opts.MaxOpenFiles)), newBudget(opts.MaxMemory)
+	process := func(oldName string) error {
+		newName := pairs[oldName]
+		taken := files.take(2)
+		defer files.give(taken)
+		takenMemory := memory.take(int64(max(opts.Chunks, 1)) * copyBufferSize)
+		defer memory.give(takenMemory)
+		opStart := opts.now()
+		if err := opts.timed(op, oldName, newName); err != nil {
+			mu.Lock()
+			opts.stalled(oldName, newName, err)
+			mu.Unlock()
+			return &FileError{Old: oldName, New: newName, Err: err}
+		}
+		// Hooks are called one at a time, so they need not be safe for
+		// concurrent use.
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		if err := opts.done(oldName, newName, opStart); err != nil {
+			return err
+		}
+		draw(float64(count) / float64(total))
+		return nil
+	}
+
+	var errs []error
+	if opts.Workers <= 1 {
+		for _, oldName := range keys {
+			if err := opts.before(); err != nil {
+				return count, errors.Join(append(errs, err)...)
+			}
+			if err := process(oldName); err != nil {
+				errs = append(errs, err)
+				if !opts.skipTimeout(err) {
+					return count, errors.Join(errs...)
+				}
+			}
+		}
+		return count, errors.Join(errs...)
+	}
+
+	var aborted bool
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range min(opts.Workers, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for oldName := range jobs {
+				if err := process(oldName); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					aborted = aborted || errors.Is(err, ErrTimeout) && !opts.skipTimeout(err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, oldName := range keys {
+		mu.Lock()
+		stop := aborted
+		mu.Unlock()
+		if stop {
+			break
+		}
+		// Waiting happens before handing out files, so a pause or a stop
+		// holds back every worker.
+		if err := opts.before(); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			break
+		}
+		jobs <- oldName
+	}
+	close(jobs)
+	wg.Wait()
+	return count, errors.Join(errs...)
+}
+
+// Rename renames the files of pairs to their new paths, in the order of
+// opts.Order. A file whose new path is held by another file of pairs is
+// renamed after that one, so chains never clobber a file, and cycles such as
+// swaps are broken by parking one of their files under a temporary name.
+func Rename(pairs map[string]string, opts ExecOptions) (uint, error) {
+	keys, err := orderKeys(pairs, opts.Order)
+	if err != nil {
+		return 0, err
+	}
+	draw, err := opts.progress()
+	if err != nil {
+		return 0, err
+	}
+
+	var renamed uint
+	total := len(pairs)
+	done := make(map[string]bool, total)
+	pending := make(map[string]bool)
+	// parked maps the files moved out of the way of a cycle to their
+	// temporary names.
+	parked := make(map[string]string)
+	// stalled maps the files whose rename timed out to its error, and
+	// cycleStalled is set if parking one did.
+	stalled := make(map[string]error)
+	var cycleStalled bool
+	finish := func(oldName, from string, opStart time.Time) error {
+		newName := pairs[oldName]
+		if err := opts.timed(renameOp, from, newName); err != nil {
+			err = &FileError{Old: oldName, New: newName, Err: err}
+			if errors.Is(err, ErrTimeout) {
+				opts.stalled(oldName, newName, err)
+				stalled[oldName] = err
+			}
+			return err
+		}
+		done[oldName] = true
+		renamed++
+		if err := opts.done(oldName, newName, opStart); err != nil {
+			return err
+		}
+		draw(float64(renamed) / float64(total))
+		return nil
+	}
+	// rename renames oldName, after first renaming the file currently
+	// holding its new name away.
+	var rename func(oldName string) error
+	rename = func(oldName string) error {
+		if done[oldName] {
+			return nil
+		}
+		if _, ok := parked[oldName]; ok {
+			return nil
+		}
+		// The files waiting for a stalled one to move away stay in place,
+		// as it may still do so later.
+		if err, ok := stalled[oldName]; ok {
+			return err
+		}
+		newName := pairs[oldName]
+		if _, ok := pairs[newName]; ok {
+			if pending[newName] {
+				// newName started the chain leading here, and waits for
+				// oldName to move away. oldName is parked, and takes its
+				// new name once the chain is done.
+				if err := opts.before(); err != nil {
+					return err
+				}
+				tmp, err := parkingName(opts.random(), oldName)
+				if err != nil {
+					return err
+				}
+				if err = opts.timed(renameOp, oldName, tmp); err != nil {
+					if errors.Is(err, ErrTimeout) {
+						opts.stalled(oldName, tmp, err)
+						cycleStalled = true
+					}
+					return fmt.Errorf("%q to %q: %w", oldName, tmp, err)
+				}
+				parked[oldName] = tmp
+				return nil
+			}
+			pending[oldName] = true
+			err := rename(newName)
+			delete(pending, oldName)
+			if err != nil {
+				return err
+			}
+		}
+		if err := opts.before(); err != nil {
+			return err
+		}
+		return finish(oldName, oldName, opts.now())
+	}
+	// unpark renames the parked files to their new names, which the chains
+	// have freed by now.
+	unpark := func() error {
+		for _, oldName := range slices.Sorted(maps.Keys(parked)) {
+			if err := finish(oldName, parked[oldName], opts.now()); err != nil {
+				return err
+			}
+			delete(parked, oldName)
+		}
+		return nil
+	}
+	var errs []error
+	for _, oldName := range keys {
+		err := rename(oldName)
+		if err == nil {
+			err = unpark()
+		}
+		if err == nil {
+			continue
+		}
+		// Files waiting for a stalled one report its error again.
+		if !slices.Contains(errs, err) {
+			errs = append(errs, err)
+		}
+		if opts.skipTimeout(err) && len(parked) == 0 && !cycleStalled {
+			continue
+		}
+		// Parked files get their old names back, so none is left under a
+		// temporary one.
+		for oldName, tmp := range parked {
+			os.Rename(tmp, oldName)
+		}
+		return renamed, errors.Join(errs...)
+	}
+
+	return renamed, errors.Join(errs...)
+}
+
+// parkingName returns an unused temporary name next to path, with a random
+// suffix read from r, so it can not be guessed in shared dirs.
+func parkingName(r io.Reader, path string) (string, error) {
+	dir, base := filepath.Split(path)
+	b := make([]byte, 8)
+	for range 100 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", fmt.Errorf("generate temporary name: %w", err)
+		}
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.omitter-swap-%x", base, b))
+		if _, err := os.Lstat(tmp); os.IsNotExist(err) {
+			return tmp, nil
+		} else if err != nil {
+			return "", fmt.Errorf("check temporary name %q: %w", tmp, err)
+		}
+	}
+	return "", fmt.Errorf("no unused temporary name next to %q", path)
+}
+
+// Stage builds root with the renames of pairs applied inside the staging
+// dir, validates it, and only then swaps it with root. The source tree is
+// never left half-renamed; on failure it is intact. Files are hard linked
+// into the staged tree rather than copied, so they keep their times, owner,
+// extended attributes, ACLs and hard links, and FIFOs or devices are never
+// opened. Dirs are recreated with their permissions, times and, where
+// permitted, owner. The staging dir must be outside of root, on the same file
+// system.
+func Stage(root, staging string, pairs map[string]string, after AfterFunc,
+) (uint, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return 0, fmt.Errorf("resolve absolute path: %w", err)
+	}
+	absStaging, err := filepath.Abs(staging)
+	if err != nil {
+		return 0, fmt.Errorf("resolve absolute path: %w", err)
+	}
+	if rel, err := filepath.Rel(absRoot, absStaging); err == nil && filepath.IsLocal(rel) {
+		return 0, fmt.Errorf("staging dir %q is inside %q", staging, root)
+	}
+	if err = os.MkdirAll(absStaging, 0o755); err != nil {
+		return 0, fmt.Errorf("create staging dir: %w", err)
+	}
+	if same, err := sameDevice(absRoot, absStaging); err != nil {
+		return 0, fmt.Errorf("check staging dir: %w", err)
+	} else if !same {
+		return 0, fmt.Errorf("staging dir %q is not on the file system of %q: %w", staging, root, ErrCrossDevice)
+	}
+	stagedRoot := filepath.Join(absStaging, filepath.Base(absRoot))
+	if _, err = os.Lstat(stagedRoot); err == nil {
+		return 0, fmt.Errorf("staged tree %q already exists", stagedRoot)
+	}
+
+	var staged uint
+	// sources are the staged files and the ones they link to, and dirs the
+	// staged dirs and their source info, set once their entries are in.
+	sources := make(map[string]string)
+	type stagedDir struct {
+		path string
+		info fs.FileInfo
+	}
+	var dirs []stagedDir
+	err = filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(stagedRoot, rel)
+			switch {
+			case file.IsDir():
+				info, err := file.Info()
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, stagedDir{path: target, info: info})
+				return os.MkdirAll(target, 0o700)
+			case file.Type()&fs.ModeSymlink != 0:
+				link, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				return os.Symlink(link, target)
+			}
+			if newPath, ok := pairs[path]; ok {
+				target = filepath.Join(filepath.Dir(target), filepath.Base(newPath))
+				staged++
+			}
+			if err = os.Link(path, target); err != nil {
+				return fmt.Errorf("%q to %q: %w", path, target, err)
+			}
+			sources[target] = path
+			return nil
+		})
+	if err != nil {
+		os.RemoveAll(stagedRoot)
+		return 0, fmt.Errorf("stage: %w", err)
+	}
+
+	for target, path := range sources {
+		info, err := os.Lstat(target)
+		if err != nil {
+			os.RemoveAll(stagedRoot)
+			return 0, fmt.Errorf("validate staged file %q: %w", target, err)
+		}
+		if srcInfo, err := os.Lstat(path); err != nil || !os.SameFile(info, srcInfo) {
+			os.RemoveAll(stagedRoot)
+			return 0, fmt.Errorf("validate staged file %q: not linked to %q", target, path)
+		}
+	}
+	// Deeper dirs first, as filling a dir changes its times.
+	for _, d := range slices.Backward(dirs) {
+		keepOwner(d.path, d.info)
+		if err = os.Chmod(d.path, d.info.Mode().Perm()); err == nil {
+			err = os.Chtimes(d.path, accessTime(d.info), d.info.ModTime())
+		}
+		if err != nil {
+			os.RemoveAll(stagedRoot)
+			return 0, fmt.Errorf("stage dir %q: %w", d.path, err)
+		}
+	}
+
+	oldRoot := absRoot + ".omitter-old"
+	if err = os.Rename(absRoot, oldRoot); err != nil {
+		return 0, fmt.Errorf("swap out source: %w", err)
+	}
+	if err = os.Rename(stagedRoot, absRoot); err != nil {
+		if rErr := os.Rename(oldRoot, absRoot); rErr != nil {
+			return 0, fmt.Errorf("swap in staged tree: %w (source left at %q)", err, oldRoot)
+		}
+		return 0, fmt.Errorf("swap in staged tree: %w", err)
+	}
+	if err = os.RemoveAll(oldRoot); err != nil {
+		return staged, fmt.Errorf("remove old tree %q: %w", oldRoot, err)
+	}
+
+	if after != nil {
+		for oldName, newName := range pairs {
+			if err = after(oldName, newName, 0); err != nil {
+				return staged, fmt.Errorf("%q: %w", newName, err)
+			}
+		}
+	}
+	return staged, nil
+}
+
+// orderKeys returns the old names of pairs in the order they are processed.
+func orderKeys(pairs map[string]string, order string) ([]string, error) {
+	keys := slices.Sorted(maps.Keys(pairs))
+	if order == "" {
+		return keys, nil
+	}
+
+	infos := make(map[string]fs.FileInfo, len(keys))
+	for _, k := range keys {
+		info, err := os.Stat(k)
+		if err != nil {
+			return nil, fmt.Errorf("get file(%q) info: %w", k, err)
+		}
+		infos[k] = info
+	}
+	var compare func(a, b fs.FileInfo) int
+	switch order {
+	case ORDER_SMALLEST_FIRST:
+		compare = func(a, b fs.FileInfo) int { return cmp.Compare(a.Size(), b.Size()) }
+	case ORDER_LARGEST_FIRST:
+		compare = func(a, b fs.FileInfo) int { return cmp.Compare(b.Size(), a.Size()) }
+	case ORDER_OLDEST_FIRST:
+		compare = func(a, b fs.FileInfo) int { return a.ModTime().Compare(b.ModTime()) }
+	default:
+		return nil, fmt.Errorf("unknown order: %q", order)
+	}
+	slices.SortStableFunc(keys, func(a, b string) int {
+		return compare(infos[a], infos[b])
+	})
+	return keys, nil
+}
@@ -0,0 +1,787 @@
+package omitter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRenameAction verifies that the rename function renames files as expected.
+func TestRenameAction(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testrename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a file that should be renamed.
+	originalFile := createTempFile(t, tempDir, "example_target.txt", "dummy")
+
+	// Expected new name after removing "target".
+	newName := "example_.txt"
+	newPath := filepath.Join(tempDir, newName)
+	pairs := map[string]string{
+		originalFile: newPath,
+	}
+
+	// Call Rename.
+	count, err := Rename(pairs, ExecOptions{})
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file renamed, got %d", count)
+	}
+
+	// Verify that the original file no longer exists and the new file does.
+	if _, err := os.Stat(originalFile); !os.IsNotExist(err) {
+		t.Errorf("expected original file %s to be removed", originalFile)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+	}
+}
+
+// TestRenameCycles verifies that swaps and longer cycles are renamed through temporary names.
+func TestRenameCycles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testrename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	names := []string{"a.txt", "b.txt", "x.txt", "y.txt", "z.txt"}
+	paths := make(map[string]string)
+	for _, name := range names {
+		paths[name] = createTempFile(t, tempDir, name, name)
+	}
+	pairs := map[string]string{
+		// a <-> b
+		paths["a.txt"]: paths["b.txt"],
+		paths["b.txt"]: paths["a.txt"],
+		// x -> y -> z -> x
+		paths["x.txt"]: paths["y.txt"],
+		paths["y.txt"]: paths["z.txt"],
+		paths["z.txt"]: paths["x.txt"],
+	}
+	var hooked []string
+	count, err := Rename(pairs, ExecOptions{After: func(oldName, newName string, _ time.Duration) error {
+		hooked = append(hooked, filepath.Base(oldName)+">"+filepath.Base(newName))
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if count != 5 || len(hooked) != 5 {
+		t.Errorf("expected 5 files renamed and hooked, got %d and %v", count, hooked)
+	}
+	for oldName, newName := range map[string]string{
+		"a.txt": "b.txt", "b.txt": "a.txt", "x.txt": "y.txt", "y.txt": "z.txt", "z.txt": "x.txt",
+	} {
+		b, err := os.ReadFile(paths[newName])
+		if err != nil || string(b) != oldName {
+			t.Errorf("expected %s to hold %q, got %q (%v)", newName, oldName, b, err)
+		}
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(names) {
+		t.Errorf("expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+// TestCopyAction verifies that the rename function renames files as expected.
+func TestCopyAction(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "second_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	// Create a file that should be copy.
+	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+
+	// Expected new name after removing "target".
+	newName := "example_.txt"
+	newPath := filepath.Join(dstDir, newName)
+	pairs := map[string]string{
+		originalFile: newPath,
+	}
+
+	// Call Copy.
+	count, err := Copy(pairs, ExecOptions{})
+	if err != nil {
+		t.Fatalf("copy error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file copied, got %d", count)
+	}
+
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+	}
+}
+
+// TestCopyAction verifies that the rename function renames files as expected.
+func TestMoveAction(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "second_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	// Create a file that should be copy.
+	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+
+	// Expected new name after removing "target".
+	newName := "example_.txt"
+	newPath := filepath.Join(dstDir, newName)
+	pairs := map[string]string{
+		originalFile: newPath,
+	}
+
+	// Call Move.
+	count, err := Move(pairs, ExecOptions{})
+	if err != nil {
+		t.Fatalf("move error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file moved, got %d", count)
+	}
+
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+	}
+
+	if _, err := os.Stat(originalFile); err == nil {
+		t.Errorf("expected old file %s to not exist, error: %v", originalFile, err)
+	}
+}
+
+// TestMoveCrossDevice verifies that files moved to another file system are
+// copied and their source removed.
+func TestMoveCrossDevice(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir, err := os.MkdirTemp("/dev/shm", "test_dir")
+	if err != nil {
+		t.Skip("no second file system")
+	}
+	defer os.RemoveAll(dstDir)
+
+	src := createTempFile(t, srcDir, "a.txt", "dummy")
+	dst := filepath.Join(dstDir, "a.txt")
+	if err = os.Link(src, filepath.Join(dstDir, "link.txt")); !crossDevice(err) {
+		t.Skipf("%s and %s are on the same file system", srcDir, dstDir)
+	}
+	if _, err = Move(map[string]string{src: dst}, ExecOptions{HideProgress: true}); err != nil {
+		t.Fatalf("move error: %v", err)
+	}
+	if b, err := os.ReadFile(dst); err != nil || string(b) != "dummy" {
+		t.Errorf("expected %s to be moved, error: %v", dst, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected source %s to be removed", src)
+	}
+}
+
+// TestCopyWorkers verifies that parallel copies carry on past a failed file,
+// and report its error.
+func TestCopyWorkers(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "second_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	pairs := make(map[string]string)
+	for i := range 10 {
+		name := fmt.Sprintf("file_%d.txt", i)
+		pairs[createTempFile(t, srcDir, name, name)] = filepath.Join(dstDir, name)
+	}
+	failing := createTempFile(t, srcDir, "failing.txt", "dummy")
+	pairs[failing] = filepath.Join(dstDir, "missing", "failing.txt")
+
+	var calls int
+	after := func(string, string, time.Duration) error {
+		calls++
+		return nil
+	}
+	count, err := Copy(pairs, ExecOptions{Workers: 4, After: after})
+	if err == nil {
+		t.Fatal("expected the error of the failing file")
+	}
+	if count != 10 || calls != 10 {
+		t.Errorf("expected 10 files copied and reported, got %d and %d", count, calls)
+	}
+	for oldName, newName := range pairs {
+		if oldName == failing {
+			continue
+		}
+		if b, err := os.ReadFile(newName); err != nil || string(b) != filepath.Base(newName) {
+			t.Errorf("expected %s to be copied, error: %v", newName, err)
+		}
+	}
+}
+
+// TestCopyCanceled verifies that a canceled copy stops after the file in
+// progress, and that a copy cut short leaves no partial file behind.
+func TestCopyCanceled(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "second_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	pairs := make(map[string]string)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		pairs[createTempFile(t, srcDir, name, name)] = filepath.Join(dstDir, name)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	after := func(string, string, time.Duration) error {
+		cancel()
+		return nil
+	}
+	count, err := Copy(pairs, ExecOptions{Context: ctx, After: after})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file copied, got %d", count)
+	}
+	entries, err := os.ReadDir(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a.txt" {
+		t.Errorf("expected only a.txt to be copied, got %v", entries)
+	}
+
+	dst := filepath.Join(dstDir, "d.txt")
+	if err = copyFile(ctx, filepath.Join(srcDir, "b.txt"), dst); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the partial copy %s to be removed, error: %v", dst, err)
+	}
+}
+
+// TestCopyKeepTimes verifies that copies keep the times their source had
+// before it was read.
+func TestCopyKeepTimes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src := createTempFile(t, tempDir, "a.txt", "dummy")
+	dst := filepath.Join(tempDir, "b.txt")
+	mtime := time.Date(2020, 5, 17, 8, 30, 0, 0, time.UTC)
+	atime := mtime.Add(time.Hour)
+	if err = os.Chtimes(src, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Copy(map[string]string{src: dst}, ExecOptions{KeepTimes: true}); err != nil {
+		t.Fatalf("copy error: %v", err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected modification time %s, got %s", mtime, info.ModTime())
+	}
+	if runtime.GOOS == "linux" && !accessTime(info).Equal(atime) {
+		t.Errorf("expected access time %s, got %s", atime, accessTime(info))
+	}
+}
+
+// TestMoveCopyMetadata verifies that the metadata of moved files is copied
+// before their source is removed, and that its failure keeps the source.
+func TestMoveCopyMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "test_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src := createTempFile(t, tempDir, "a.txt", "dummy")
+	dst := filepath.Join(tempDir, "b.txt")
+	var called bool
+	opts := ExecOptions{CopyMetadata: func(from, to string) error {
+		called = true
+		if _, err := os.Stat(from); err != nil {
+			t.Errorf("expected source %s to exist, error: %v", from, err)
+		}
+		if to != dst {
+			t.Errorf("expected destination %s, got %s", dst, to)
+		}
+		return nil
+	}}
+	if _, err = Move(map[string]string{src: dst}, opts); err != nil {
+		t.Fatalf("move error: %v", err)
+	}
+	if !called {
+		t.Error("expected CopyMetadata to be called")
+	}
+
+	opts.CopyMetadata = func(string, string) error { return errors.New("denied") }
+	if _, err = Move(map[string]string{dst: src}, opts); err == nil {
+		t.Fatal("expected the metadata error")
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("expected source %s to be kept, error: %v", dst, err)
+	}
+}
+
+// TestCopyFile verifies the copying single file from src to dst.
+func TestCopyFile(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "second_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	var (
+		fileName    string = "file1.txt"
+		fileContent string = "sample_content"
+	)
+
+	// Create file.
+	file1 := createTempFile(t, srcDir, fileName, fileContent)
+
+	newPath := filepath.Join(dstDir, fileName)
+	if err := CopyFile(file1, newPath); err != nil {
+		t.Errorf("expected copy %q to %q", file1, newPath)
+	}
+
+	if _, err := os.Stat(newPath); os.IsNotExist(err) {
+		t.Errorf("expected copied file %q to be in %q", newPath, dstDir)
+	}
+
+	b, err := os.ReadFile(newPath)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	if string(b) != fileContent {
+		t.Errorf("expected %s. got %s", fileContent, string(b))
+	}
+}
+
+// TestStagingAction verifies that the renamed tree is built in staging and swapped into place.
+func TestStagingAction(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	stagingDir, err := os.MkdirTemp("", "staging_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err = os.Mkdir(filepath.Join(srcDir, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	originalFile := createTempFile(t, srcDir, "nested/example_target.txt", "dummy")
+	untouchedFile := createTempFile(t, srcDir, "other.txt", "dummy")
+	newPath := filepath.Join(srcDir, "nested", "example_.txt")
+
+	count, err := Stage(srcDir, stagingDir, map[string]string{originalFile: newPath}, nil)
+	if err != nil {
+		t.Fatalf("staging error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 file renamed, got %d", count)
+	}
+
+	if _, err := os.Stat(originalFile); !os.IsNotExist(err) {
+		t.Errorf("expected original file %s to be removed", originalFile)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected new file %s to exist, error: %v", newPath, err)
+	}
+	if _, err := os.Stat(untouchedFile); err != nil {
+		t.Errorf("expected untouched file %s to exist, error: %v", untouchedFile, err)
+	}
+	if _, err := os.Stat(srcDir + ".omitter-old"); !os.IsNotExist(err) {
+		t.Errorf("expected old tree to be removed")
+	}
+}
+
+// TestStagingKeepsMetadata verifies that staging keeps file times and hard links.
+func TestStagingKeepsMetadata(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	stagingDir, err := os.MkdirTemp("", "staging_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+	linkedFile := filepath.Join(srcDir, "linked.txt")
+	if err = os.Link(originalFile, linkedFile); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err = os.Chtimes(originalFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	newPath := filepath.Join(srcDir, "example_.txt")
+
+	if _, err = Stage(srcDir, stagingDir, map[string]string{originalFile: newPath}, nil); err != nil {
+		t.Fatalf("staging error: %v", err)
+	}
+
+	info, err := os.Stat(newPath)
+	if err != nil {
+		t.Fatalf("expected new file %s to exist, error: %v", newPath, err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected mtime %v, got %v", modTime, info.ModTime())
+	}
+	linkedInfo, err := os.Stat(linkedFile)
+	if err != nil {
+		t.Fatalf("expected linked file %s to exist, error: %v", linkedFile, err)
+	}
+	if !os.SameFile(info, linkedInfo) {
+		t.Errorf("expected %s and %s to stay hard linked", newPath, linkedFile)
+	}
+}
+
+// TestStagingInsideRoot verifies that a staging dir inside root is refused.
+func TestStagingInsideRoot(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	originalFile := createTempFile(t, srcDir, "example_target.txt", "dummy")
+	newPath := filepath.Join(srcDir, "example_.txt")
+	stagingDir := filepath.Join(srcDir, "staging")
+
+	if _, err = Stage(srcDir, stagingDir, map[string]string{originalFile: newPath}, nil); err == nil {
+		t.Fatal("expected an error for a staging dir inside root")
+	}
+	if _, err := os.Stat(originalFile); err != nil {
+		t.Errorf("expected original file %s to be left alone, error: %v", originalFile, err)
+	}
+	if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+		t.Errorf("expected staging dir %s not to be created", stagingDir)
+	}
+}
+
+// TestCopyFileChunked verifies that a file copied in chunks is identical to the source.
+func TestCopyFileChunked(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "first_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	content := make([]byte, 3*minChunkSize+12345)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	src := filepath.Join(srcDir, "big.bin")
+	if err = os.WriteFile(src, content, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(srcDir, "big_copy.bin")
+	if err = copyFileChunked(context.Background(), src, dst, 8); err != nil {
+		t.Fatalf("chunked copy error: %v", err)
+	}
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Error("expected copied content to match the source")
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode %v, got %v", os.FileMode(0640), info.Mode().Perm())
+	}
+}
+
+// TestOrderKeys verifies the execution orders.
+func TestOrderKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	big := createTempFile(t, tempDir, "a_big.txt", "1234567890")
+	small := createTempFile(t, tempDir, "b_small.txt", "1")
+	medium := createTempFile(t, tempDir, "c_medium.txt", "12345")
+	now := time.Now()
+	for i, path := range []string{medium, big, small} {
+		mtime := now.Add(time.Duration(i) * time.Hour)
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pairs := map[string]string{big: big + "_", small: small + "_", medium: medium + "_"}
+
+	cases := map[string][]string{
+		"":                   {big, small, medium},
+		ORDER_SMALLEST_FIRST: {small, medium, big},
+		ORDER_LARGEST_FIRST:  {big, medium, small},
+		ORDER_OLDEST_FIRST:   {medium, big, small},
+	}
+	for order, expected := range cases {
+		keys, err := orderKeys(pairs, order)
+		if err != nil {
+			t.Fatalf("%q: order error: %v", order, err)
+		}
+		if !slices.Equal(keys, expected) {
+			t.Errorf("%q: expected %v, got %v", order, expected, keys)
+		}
+	}
+
+	if _, err = orderKeys(pairs, "random"); err == nil {
+		t.Error("expected an error for unknown order")
+	}
+}
+
+// TestTimeWindow verifies parsing of time windows and the time until they open.
+func TestTimeWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	night, err := ParseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatalf("parse window error: %v", err)
+	}
+	day, err := ParseWindow("09:00-17:00")
+	if err != nil {
+		t.Fatalf("parse window error: %v", err)
+	}
+
+	cases := []struct {
+		window   *Window
+		at       time.Time
+		expected time.Duration
+	}{
+		{night, at(23, 0), 0},
+		{night, at(3, 0), 0},
+		{night, at(6, 0), 16 * time.Hour},
+		{night, at(21, 30), 30 * time.Minute},
+		{day, at(12, 0), 0},
+		{day, at(18, 0), 15 * time.Hour},
+	}
+	for _, c := range cases {
+		if got := c.window.untilOpen(c.at); got != c.expected {
+			t.Errorf("%v at %s: expected %s, got %s", *c.window, c.at.Format("15:04"), c.expected, got)
+		}
+	}
+
+	if _, err = ParseWindow("22:00"); err == nil {
+		t.Error("expected an error for a window without end")
+	}
+	if _, err = ParseWindow("25:00-06:00"); err == nil {
+		t.Error("expected an error for an invalid hour")
+	}
+}
+
+// TestRenameCyclesRand verifies that temporary names take their suffixes
+// from the injected randomness, and skip the ones which are taken.
+func TestRenameCyclesRand(t *testing.T) {
+	tempDir := t.TempDir()
+	a := createTempFile(t, tempDir, "a.txt", "a.txt")
+	b := createTempFile(t, tempDir, "b.txt", "b.txt")
+	createTempFile(t, tempDir, ".a.txt.omitter-swap-0000000000000000", "")
+	createTempFile(t, tempDir, ".b.txt.omitter-swap-0000000000000000", "")
+
+	random := bytes.NewReader(append(make([]byte, 8), bytes.Repeat([]byte{1}, 8)...))
+	if _, err := Rename(map[string]string{a: b, b: a}, ExecOptions{Rand: random, HideProgress: true}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	for oldName, newName := range map[string]string{a: b, b: a} {
+		got, err := os.ReadFile(newName)
+		if err != nil || string(got) != filepath.Base(oldName) {
+			t.Errorf("expected %s to hold %q, got %q (%v)", newName, filepath.Base(oldName), got, err)
+		}
+	}
+	if random.Len() != 0 {
+		t.Errorf("expected every random byte to be read, %d left", random.Len())
+	}
+
+	_, err := Rename(map[string]string{a: b, b: a}, ExecOptions{Rand: bytes.NewReader(nil), HideProgress: true})
+	if err == nil {
+		t.Error("expected an error once the randomness runs out")
+	}
+	for _, path := range []string{a, b} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be left in place, error: %v", path, err)
+		}
+	}
+}
+
+// fakeClock is a clock whose time only moves when sleeping.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+// TestTimeWindowWait verifies that waiting sleeps on the injected clock until the window opens.
+func TestTimeWindowWait(t *testing.T) {
+	window, err := ParseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatalf("parse window error: %v", err)
+	}
+
+	c := &fakeClock{now: time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)}
+	window.Wait(c)
+	if c.slept != 2*time.Hour {
+		t.Errorf("expected to sleep 2h, slept %s", c.slept)
+	}
+	window.Wait(c)
+	if c.slept != 2*time.Hour {
+		t.Errorf("did not expect to sleep within the window, slept %s", c.slept)
+	}
+}
+
+// TestCopyOpTimeout verifies that operations taking too long are given up on
+// and reported as stalled, and that the others go on under TIMEOUT_SKIP.
+func TestCopyOpTimeout(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testoptimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	a := createTempFile(t, tempDir, "a.txt", "a")
+	b := createTempFile(t, tempDir, "b.txt", "b")
+	pairs := map[string]string{a: a + ".copy", b: b + ".copy"}
+	// Copying the metadata of a hangs until the test is done.
+	hang := make(chan struct{})
+	defer close(hang)
+	hangOnA := func(src, dst string) error {
+		if src == a {
+			<-hang
+		}
+		return nil
+	}
+
+	var stalled []string
+	opts := ExecOptions{
+		HideProgress: true, CopyMetadata: hangOnA, OpTimeout: 20 * time.Millisecond,
+		Stalled: func(oldName, _ string) { stalled = append(stalled, oldName) },
+	}
+	n, err := Copy(pairs, opts)
+	if !errors.Is(err, ErrTimeout) || n != 0 {
+		t.Errorf("expected the copy to stop at the timeout of a, got %d copies and %v", n, err)
+	}
+
+	opts.OnTimeout = TIMEOUT_SKIP
+	n, err = Copy(pairs, opts)
+	if !errors.Is(err, ErrTimeout) || n != 1 {
+		t.Errorf("expected b to be copied after the timeout of a, got %d copies and %v", n, err)
+	}
+	if _, err = os.Stat(b + ".copy"); err != nil {
+		t.Errorf("expected b to be copied: %v", err)
+	}
+	if !slices.Equal(stalled, []string{a, a}) {
+		t.Errorf("expected a to be reported stalled twice, got %v", stalled)
+	}
+}
+
+// TestCopyMaxOpenFiles verifies that workers wait rather than hold more files
+// open than MaxOpenFiles.
+func TestCopyMaxOpenFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testmaxopen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pairs := make(map[string]string)
+	for i := range 8 {
+		src := createTempFile(t, tempDir, fmt.Sprintf("%d.txt", i), "dummy")
+		pairs[src] = src + ".copy"
+	}
+	var mu sync.Mutex
+	var running, most int
+	track := func(src, dst string) error {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	n, err := Copy(pairs, ExecOptions{HideProgress: true, Workers: 8, MaxOpenFiles: 4, CopyMetadata: track})
+	if err != nil || n != 8 {
+		t.Fatalf("expected 8 copies, got %d and %v", n, err)
+	}
+	if most > 2 {
+		t.Errorf("expected at most 2 copies at once, got %d", most)
+	}
+}
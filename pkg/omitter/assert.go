@@ -0,0 +1,189 @@
+package omitter
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Parts of names which keeps assertions guarantee.
+const (
+	KEEPS_EXT    string = "ext"
+	KEEPS_DIR    string = "dir"
+	KEEPS_DIGITS string = "digits"
+)
+
+// ErrAssertion is wrapped by the errors of plans with new names violating
+// their assertions, along with ErrInvalidName.
+var ErrAssertion = errors.New("assertion violated")
+
+var digitRuns = regexp.MustCompile(`\d+`)
+
+// Assertion is a guarantee which every new name of a plan must hold, such as
+// keeping the extension of the old one.
+type Assertion struct {
+	text  string
+	check func(oldPath, newPath string) bool
+}
+
+// String returns the assertion as it was written.
+func (a Assertion) String() string {
+	return a.text
+}
+
+// Holds reports whether renaming oldPath to newPath keeps the assertion.
+func (a Assertion) Holds(oldPath, newPath string) bool {
+	return a.check(oldPath, newPath)
+}
+
+// ParseAssertions parses a comma separated list of assertions:
+//
+//	keeps(ext)        the extension is unchanged
+//	keeps(dir)        the file stays in its dir
+//	keeps(digits)     every run of digits of the old name is kept, in order
+//	matches('regex')  the new name matches the regex
+//
+// Arguments may be quoted with single or double quotes, which they must be
+// if they contain a comma or a parenthesis.
+func ParseAssertions(s string) ([]Assertion, error) {
+	var assertions []Assertion
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		name, arg, after, err := parseCall(rest)
+		if err != nil {
+			return nil, err
+		}
+		a, err := newAssertion(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		a.text = strings.TrimSpace(rest[:len(rest)-len(after)])
+		assertions = append(assertions, a)
+
+		rest = strings.TrimSpace(after)
+		if rest == "" {
+			break
+		}
+		var ok bool
+		if rest, ok = strings.CutPrefix(rest, ","); !ok {
+			return nil, fmt.Errorf("expected a comma before %q", rest)
+		}
+		if rest = strings.TrimSpace(rest); rest == "" {
+			return nil, errors.New("trailing comma")
+		}
+	}
+	return assertions, nil
+}
+
+// parseCall parses the name(arg) call at the start of s, and returns what
+// follows it.
+func parseCall(s string) (name, arg, rest string, err error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		return "", "", "", fmt.Errorf("expected an assertion such as keeps(ext), got %q", s)
+	}
+	name = strings.TrimSpace(s[:open])
+	rest = strings.TrimLeft(s[open+1:], " ")
+	if rest != "" && (rest[0] == '\'' || rest[0] == '"') {
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return "", "", "", fmt.Errorf("unterminated quote in %s", name)
+		}
+		arg, rest = rest[1:end+1], strings.TrimLeft(rest[end+2:], " ")
+		if !strings.HasPrefix(rest, ")") {
+			return "", "", "", fmt.Errorf("expected ) after the argument of %s", name)
+		}
+		return name, arg, rest[1:], nil
+	}
+	end := strings.IndexByte(rest, ')')
+	if end < 0 {
+		return "", "", "", fmt.Errorf("expected ) after the argument of %s", name)
+	}
+	return name, strings.TrimSpace(rest[:end]), rest[end+1:], nil
+}
+
+func newAssertion(name, arg string) (Assertion, error) {
+	switch name {
+	case "keeps":
+		switch arg {
+		case KEEPS_EXT:
+			return Assertion{check: func(oldPath, newPath string) bool {
+				return filepath.Ext(oldPath) == filepath.Ext(newPath)
+			}}, nil
+		case KEEPS_DIR:
+			return Assertion{check: func(oldPath, newPath string) bool {
+				return filepath.Dir(oldPath) == filepath.Dir(newPath)
+			}}, nil
+		case KEEPS_DIGITS:
+			return Assertion{check: func(oldPath, newPath string) bool {
+				return keepsRuns(digitRuns.FindAllString(filepath.Base(oldPath), -1), filepath.Base(newPath))
+			}}, nil
+		}
+		return Assertion{}, fmt.Errorf("unknown part of keeps: %q", arg)
+	case "matches":
+		pattern, err := regexp.Compile(arg)
+		if err != nil {
+			return Assertion{}, fmt.Errorf("compile matches: %w", err)
+		}
+		return Assertion{check: func(_, newPath string) bool {
+			return pattern.MatchString(filepath.Base(newPath))
+		}}, nil
+	}
+	return Assertion{}, fmt.Errorf("unknown assertion: %q", name)
+}
+
+// keepsRuns reports whether name contains runs in order, without overlaps.
+func keepsRuns(runs []string, name string) bool {
+	for _, run := range runs {
+		i := strings.Index(name, run)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(run):]
+	}
+	return true
+}
+
+// Violation is a new name which violates an assertion.
+type Violation struct {
+	Path, New string
+	Assertion string
+}
+
+// AssertionError lists the violations of the assertions of a plan.
+type AssertionError struct {
+	Violations []Violation
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("%v: %d new name(s) do not hold", ErrAssertion, len(e.Violations))
+}
+
+func (e *AssertionError) Unwrap() []error {
+	return []error{ErrAssertion, ErrInvalidName}
+}
+
+// CheckAssertions checks every new path of pairs against assertions, and
+// returns an *AssertionError listing the violations, sorted by path, if
+// there are any.
+func CheckAssertions(pairs map[string]string, assertions []Assertion) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+	var violations []Violation
+	for _, oldPath := range slices.Sorted(maps.Keys(pairs)) {
+		for _, a := range assertions {
+			if !a.Holds(oldPath, pairs[oldPath]) {
+				violations = append(violations, Violation{Path: oldPath, New: pairs[oldPath], Assertion: a.text})
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &AssertionError{Violations: violations}
+}
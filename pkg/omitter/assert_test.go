@@ -0,0 +1,99 @@
+package omitter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseAssertions verifies that assertions are parsed with quoted and
+// bare arguments, and that malformed ones are refused.
+func TestParseAssertions(t *testing.T) {
+	assertions, err := ParseAssertions(`keeps(ext), matches('^[a-z0-9-]+(\.[a-z]+)?$') ,keeps( digits )`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	want := []string{"keeps(ext)", `matches('^[a-z0-9-]+(\.[a-z]+)?$')`, "keeps( digits )"}
+	if len(assertions) != len(want) {
+		t.Fatalf("expected %d assertions, got %v", len(want), assertions)
+	}
+	for i, a := range assertions {
+		if a.String() != want[i] {
+			t.Errorf("expected %q, got %q", want[i], a.String())
+		}
+	}
+
+	for _, s := range []string{
+		"keeps(name)",
+		"contains(ext)",
+		"keeps(ext",
+		"matches('[a-z')",
+		"matches('abc)",
+		"keeps(ext) keeps(dir)",
+		"keeps(ext),",
+		"ext",
+	} {
+		if _, err := ParseAssertions(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
+
+// TestCheckAssertions verifies that every violated assertion of every new
+// name is reported.
+func TestCheckAssertions(t *testing.T) {
+	assertions, err := ParseAssertions(`keeps(ext), keeps(dir), keeps(digits), matches("^[a-z0-9-]+\.[a-z]+$")`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	pairs := map[string]string{
+		"/a/IMG 2024 07.jpg": "/a/img-2024-07.jpg",
+		"/a/IMG 2024 08.jpg": "/b/img-2024.jpeg",
+	}
+	err = CheckAssertions(pairs, assertions)
+	var assertErr *AssertionError
+	if !errors.As(err, &assertErr) || !errors.Is(err, ErrAssertion) {
+		t.Fatalf("expected an assertion error, got %v", err)
+	}
+	var violated []string
+	for _, v := range assertErr.Violations {
+		if v.Path != "/a/IMG 2024 08.jpg" {
+			t.Errorf("did not expect %s to violate %s", v.Path, v.Assertion)
+		}
+		violated = append(violated, v.Assertion)
+	}
+	if len(violated) != 3 {
+		t.Errorf("expected ext, dir and digits to be violated, got %v", violated)
+	}
+
+	delete(pairs, "/a/IMG 2024 08.jpg")
+	if err = CheckAssertions(pairs, assertions); err != nil {
+		t.Errorf("did not expect an error, got %v", err)
+	}
+}
+
+// TestPlanAssertions verifies that plans with new names violating their
+// assertions fail.
+func TestPlanAssertions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testassert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	createTempFile(t, tempDir, "a_draft.txt", "dummy")
+	b := createTempFile(t, tempDir, "B_draft.txt", "dummy")
+	assertions, err := ParseAssertions("matches('^[a-z.]+$')")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	_, err = NewPlan(Options{Path: tempDir, Str: "_draft", Assert: assertions})
+	var assertErr *AssertionError
+	if !errors.As(err, &assertErr) {
+		t.Fatalf("expected an assertion error, got %v", err)
+	}
+	if len(assertErr.Violations) != 1 || assertErr.Violations[0].New != filepath.Join(tempDir, "B.txt") {
+		t.Errorf("expected only %s to violate the assertion, got %+v", b, assertErr.Violations)
+	}
+}
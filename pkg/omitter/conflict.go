@@ -0,0 +1,159 @@
+package omitter
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	PLACEMENT_BEFORE_EXT string = "before-ext"
+	PLACEMENT_AFTER_EXT  string = "after-ext"
+)
+
+// Policies of conflicts, where a new name is already taken.
+const (
+	CONFLICT_SUFFIX    string = "suffix"
+	CONFLICT_SKIP      string = "skip"
+	CONFLICT_OVERWRITE string = "overwrite"
+	CONFLICT_FAIL      string = "fail"
+	// CONFLICT_PROMPT asks Options.Prompter about every conflict, and
+	// CONFLICT_ASK_PER_DIR about all of the conflicts of a dir at once.
+	CONFLICT_PROMPT      string = "prompt"
+	CONFLICT_ASK_PER_DIR string = "ask-per-dir"
+)
+
+// SUFFIX_TIMESTAMP is the conflict suffix format appending the time of the
+// run instead of a counter.
+const SUFFIX_TIMESTAMP string = "timestamp"
+
+// timestampLayout sorts the same lexically and chronologically.
+const timestampLayout = "20060102T150405"
+
+// ConflictSuffix is appended to conflicting names. Format is given the
+// counter, and the suffix goes after the extension if AfterExt is set.
+type ConflictSuffix struct {
+	Format   string
+	AfterExt bool
+	// Time is the time of SUFFIX_TIMESTAMP suffixes, the current time if
+	// zero.
+	Time time.Time
+}
+
+// Apply returns name with the suffix of the count-th conflict.
+func (s ConflictSuffix) Apply(name string, count int) string {
+	var suffix string
+	switch s.Format {
+	case "":
+		suffix = fmt.Sprintf(DEFAULT_CONFLICT_SUFFIX, count)
+	case SUFFIX_TIMESTAMP:
+		t := s.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		// Further conflicts of the same name in the run still need a counter.
+		suffix = "_" + t.Format(timestampLayout)
+		if count > 1 {
+			suffix += fmt.Sprintf(DEFAULT_CONFLICT_SUFFIX, count)
+		}
+	default:
+		suffix = fmt.Sprintf(s.Format, count)
+	}
+	if s.AfterExt {
+		return name + suffix
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + suffix + ext
+}
+
+// ValidSuffixFormat reports whether format formats a single counter, or is
+// SUFFIX_TIMESTAMP.
+func ValidSuffixFormat(format string) bool {
+	if format == SUFFIX_TIMESTAMP {
+		return true
+	}
+	formatted := fmt.Sprintf(format, 1)
+	return !strings.Contains(formatted, "%!") &&
+		formatted != fmt.Sprintf(format, 2) &&
+		!strings.ContainsRune(formatted, filepath.Separator)
+}
+
+// onConflict returns the name of c in dir according to the conflict policy
+// of opts, if newName is taken, or an empty name if c is skipped.
+func onConflict(opts Options, c candidate, newName string,
+	taken, vacated map[string]bool,
+) (string, error) {
+	target := filepath.Join(c.dir, newName)
+	if target == c.path || !isOccupied(target, taken, vacated, opts.names) ||
+		!taken[target] && opts.names == nil && sameFile(c.path, target) {
+		return newName, nil
+	}
+	policy := cmp.Or(opts.OnConflict, CONFLICT_SUFFIX)
+	if opts.AskConflict != nil {
+		policy = opts.AskConflict(c.path, target)
+	}
+	switch policy {
+	case CONFLICT_SKIP:
+		return "", nil
+	case CONFLICT_FAIL:
+		return "", &FileError{Old: c.path, New: target, Err: ErrConflict}
+	case CONFLICT_OVERWRITE:
+		// Files of the plan never overwrite each other, only ones which are
+		// left alone.
+		if taken[target] {
+			return "", nil
+		}
+		return newName, nil
+	}
+	return resolveConflict(c.dir, newName, taken, vacated, opts.names, opts.ConflictSuffix), nil
+}
+
+func resolveConflict(dir, newName string, taken, vacated, names map[string]bool,
+	suffix ConflictSuffix,
+) string {
+	candidate := newName
+	count := 1
+	for isOccupied(filepath.Join(dir, candidate), taken, vacated, names) {
+		candidate = suffix.Apply(newName, count)
+		count++
+	}
+	return candidate
+}
+
+// sameFile reports whether target only differs from path in case or
+// normalization, and is the same file, as on file systems which ignore them.
+// Hard links to the file are still taken.
+func sameFile(path, target string) bool {
+	if filepath.Dir(path) != filepath.Dir(target) ||
+		!strings.EqualFold(norm.NFC.String(filepath.Base(path)), norm.NFC.String(filepath.Base(target))) {
+		return false
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	targetInfo, err := os.Lstat(target)
+	return err == nil && os.SameFile(info, targetInfo)
+}
+
+// isOccupied reports whether path will exist after the run: either another
+// file is going to be renamed to it, or it exists and is not renamed away.
+// Existing files are looked up in names instead of the file system, if set.
+func isOccupied(path string, taken, vacated, names map[string]bool) bool {
+	if taken[path] {
+		return true
+	}
+	if vacated[path] {
+		return false
+	}
+	if names != nil {
+		return names[path]
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
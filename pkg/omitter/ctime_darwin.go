@@ -0,0 +1,25 @@
+package omitter
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the time the inode of the file last changed.
+func changeTime(info fs.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Ctimespec.Unix())
+}
+
+// accessTime returns the time the file was last read.
+func accessTime(info fs.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Atimespec.Unix())
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package omitter
+
+import (
+	"io/fs"
+	"time"
+)
+
+// changeTime falls back to the modification time on this platform.
+func changeTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// accessTime falls back to the modification time on this platform.
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,26 @@
+package omitter
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the creation time of the file, as Windows keeps no
+// change time.
+func changeTime(info fs.FileInfo) time.Time {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(0, data.CreationTime.Nanoseconds())
+}
+
+// accessTime returns the time the file was last read.
+func accessTime(info fs.FileInfo) time.Time {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds())
+}
@@ -0,0 +1,62 @@
+package omitter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Kinds of errors, which the errors of the package wrap, along with the
+// file they are about in a *FileError, so callers can tell them apart with
+// errors.Is.
+var (
+	// ErrConflict is returned by planning for conflicts under
+	// CONFLICT_FAIL.
+	ErrConflict = errors.New("new name is already taken")
+	// ErrCrossDevice is returned for renames to another file system, which
+	// only moves can carry out.
+	ErrCrossDevice = errors.New("new path is on another file system")
+	// ErrInvalidName is returned for names which can not be used, such as
+	// new names with disallowed characters under FALLBACK_FAIL.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrSkipped is the error of a file which matched, but is skipped, as
+	// returned by SkippedFile.Err.
+	ErrSkipped = errors.New("file is skipped")
+	// ErrTimeout is returned for file operations which took longer than
+	// ExecOptions.OpTimeout.
+	ErrTimeout = errors.New("file operation timed out")
+)
+
+// FileError is the error of the file operation from Old to New, which is
+// empty for operations on Old alone.
+type FileError struct {
+	Old, New string
+	Err      error
+}
+
+func (e *FileError) Error() string {
+	if e.New == "" {
+		return fmt.Sprintf("%q: %v", e.Old, e.Err)
+	}
+	return fmt.Sprintf("%q to %q: %v", e.Old, e.New, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Err returns the error of f, wrapping ErrSkipped, for callers which treat
+// skipped files as failures.
+func (f SkippedFile) Err() error {
+	return &FileError{Old: f.Path, Err: fmt.Errorf("%w: %s", ErrSkipped, f.Reason)}
+}
+
+// renameFile renames from to to, wrapping ErrCrossDevice in the error of
+// renames to another file system.
+func renameFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err != nil && crossDevice(err) {
+		return fmt.Errorf("%w: %w", ErrCrossDevice, err)
+	}
+	return err
+}
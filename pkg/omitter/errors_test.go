@@ -0,0 +1,37 @@
+package omitter
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestErrorKinds verifies that the errors of planning wrap their kind, along
+// with the file they are about.
+func TestErrorKinds(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testerrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	taken := createTempFile(t, tempDir, "a_y.txt", "dummy")
+
+	_, err = NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", OnConflict: CONFLICT_FAIL})
+	var fileErr *FileError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &fileErr) || fileErr.Old != file || fileErr.New != taken {
+		t.Errorf("expected a conflict of %s with %s, got %v", file, taken, err)
+	}
+
+	_, err = NewPlan(Options{Path: tempDir, Str: "_x", Replace: " z", AllowedChars: regexp.MustCompile(`[a-z._]`), AllowFallback: FALLBACK_FAIL})
+	if !errors.Is(err, ErrInvalidName) || !errors.As(err, &fileErr) || fileErr.Old != file {
+		t.Errorf("expected %s to have an invalid name, got %v", file, err)
+	}
+
+	err = SkippedFile{Path: file, Reason: SKIP_CONFLICT}.Err()
+	if !errors.Is(err, ErrSkipped) || errors.Is(err, ErrConflict) {
+		t.Errorf("expected a skipped file error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package omitter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseExpression parses a sed style substitution, s/regex/replacement/flags,
+// where any character may take the place of the slashes, as in s|a/b|c|, and
+// is escaped with a backslash inside the regex and the replacement. In the
+// replacement, \1 to \9 and & refer to the groups of the match, as in sed.
+// Without flags the first match is replaced, and the flags are:
+//
+//	g  every match, unless Options.Occurrence or Options.Count limit them
+//	i  the regex ignores case
+//	N  only the Nth match, as in s/a/b/2
+func ParseExpression(s string) (Substitution, error) {
+	rest, ok := strings.CutPrefix(s, "s")
+	delim, size := utf8.DecodeRuneInString(rest)
+	if !ok || size == 0 || delim == '\\' || delim == '\n' || isAlnum(delim) {
+		return Substitution{}, fmt.Errorf("expected an expression such as s/old/new/g, got %q", s)
+	}
+	parts, err := splitExpression(rest[size:], delim)
+	if err != nil {
+		return Substitution{}, fmt.Errorf("%w in %q", err, s)
+	}
+	if parts[0] == "" {
+		return Substitution{}, fmt.Errorf("empty regex in %q", s)
+	}
+
+	var global, ignoreCase bool
+	var nth int
+	for flags := parts[2]; flags != ""; {
+		switch {
+		case flags[0] == 'g' && !global:
+			global, flags = true, flags[1:]
+		case flags[0] == 'i' && !ignoreCase:
+			ignoreCase, flags = true, flags[1:]
+		case flags[0] >= '1' && flags[0] <= '9' && nth == 0:
+			end := 1
+			for end < len(flags) && flags[end] >= '0' && flags[end] <= '9' {
+				end++
+			}
+			nth, _ = strconv.Atoi(flags[:end])
+			flags = flags[end:]
+		default:
+			return Substitution{}, fmt.Errorf("unknown or repeated flag %q in %q", flags[0], s)
+		}
+	}
+	if global && nth > 0 {
+		return Substitution{}, fmt.Errorf("g can not be combined with a number in %q", s)
+	}
+
+	expr := parts[0]
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return Substitution{}, fmt.Errorf("compile %q: %w", s, err)
+	}
+	replace := sedReplacement(parts[1])
+	if strings.ContainsAny(replace, `/\`) {
+		return Substitution{}, fmt.Errorf("replacement of %q contains a path separator", s)
+	}
+	sub := Substitution{Str: parts[0], Pattern: pattern, Replace: replace}
+	switch {
+	case nth > 0:
+		sub.Occurrence = nth
+	case !global:
+		sub.Occurrence = 1
+	}
+	return sub, nil
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// splitExpression splits what follows the first delimiter of an expression
+// into its regex, replacement and flags. An escaped delimiter in the regex
+// matches itself, even if it is a metacharacter such as |. Other escapes, and
+// those of the replacement, are kept to be read by the regex or sedReplacement.
+func splitExpression(s string, delim rune) ([3]string, error) {
+	var parts [3]string
+	var b strings.Builder
+	i := 0
+	for n := 0; n < 2; n++ {
+		for {
+			if i >= len(s) {
+				return parts, errors.New("unterminated expression")
+			}
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == delim {
+				i += size
+				break
+			}
+			if r == '\\' && i+1 < len(s) {
+				next, nextSize := utf8.DecodeRuneInString(s[i+1:])
+				if next == delim && n == 0 {
+					b.WriteString(regexp.QuoteMeta(string(delim)))
+				} else {
+					b.WriteRune(r)
+					b.WriteRune(next)
+				}
+				i += 1 + nextSize
+				continue
+			}
+			b.WriteRune(r)
+			i += size
+		}
+		parts[n] = b.String()
+		b.Reset()
+	}
+	parts[2] = s[i:]
+	return parts, nil
+}
+
+// sedReplacement turns a sed replacement into one of regexp.Expand: \1 and &
+// become ${1} and ${0}, \& and \\ a literal & and \, and $ is escaped.
+func sedReplacement(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '$':
+			b.WriteString("$$")
+		case c == '\\' && i+1 < len(s):
+			i++
+			if next := s[i]; next >= '0' && next <= '9' {
+				b.WriteString("${" + string(next) + "}")
+			} else if next == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(next)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseExpression verifies that sed style expressions replace the
+// matches their flags select, with sed references in replacements, and that
+// malformed ones are refused.
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr, name, want string
+	}{
+		{"s/foo/bar/", "foo_foo.txt", "bar_foo.txt"},
+		{"s/foo/bar/g", "foo_foo.txt", "bar_bar.txt"},
+		{"s/FOO/bar/gi", "foo_Foo.txt", "bar_bar.txt"},
+		{"s/foo/bar/2", "foo_foo_foo.txt", "foo_bar_foo.txt"},
+		{`s|\.txt$|.md|`, "a.txt", "a.md"},
+		{`s/a\/b/c/`, "a/b", "c"},
+		{`s|a\|b|X|`, "a|b.txt", "X.txt"},
+		{`s|a\|b|X|`, "a.txt", "a.txt"},
+		{`s,a,x\,y,`, "a.txt", "x,y.txt"},
+		{`s/(\w+)-(\w+)/\2_\1/`, "one-two.txt", "two_one.txt"},
+		{`s/x/[&] \& $1/`, "x.txt", "[x] & $1.txt"},
+	}
+	for _, tt := range tests {
+		s, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Errorf("%q: parse error: %v", tt.expr, err)
+			continue
+		}
+		if got := s.apply(tt.name, 0, 0); got != tt.want {
+			t.Errorf("%q on %q: expected %q, got %q", tt.expr, tt.name, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{
+		"foo", "s/a/b", "s//b/", "s/a/b/x", "s/a/b/gg", "s/a/b/2g", "s/(/b/", "sxaxbx",
+		`s/a/\//`, `s|a|b\\c|`,
+	} {
+		if _, err := ParseExpression(expr); err == nil {
+			t.Errorf("expected %q to be refused", expr)
+		}
+	}
+}
+
+// TestPlanExpressions verifies that expressions alone are made in order, and
+// that files none of them matches are left alone.
+func TestPlanExpressions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testexpressions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	movie := createTempFile(t, tempDir, "Movie.2020.x265.mkv", "dummy")
+	createTempFile(t, tempDir, "notes", "dummy")
+	var subs []Substitution
+	for _, expr := range []string{`s/\.x265//i`, `s/\./ /g`, `s/ mkv$/.mkv/`} {
+		s, err := ParseExpression(expr)
+		if err != nil {
+			t.Fatalf("%q: parse error: %v", expr, err)
+		}
+		subs = append(subs, s)
+	}
+	plan, err := NewPlan(Options{Path: tempDir, Substitutions: subs})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 1 || plan.Pairs[movie] != filepath.Join(tempDir, "Movie 2020.mkv") {
+		t.Errorf("expected only %s to be renamed, got %v", movie, plan.Pairs)
+	}
+}
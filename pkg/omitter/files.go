@@ -0,0 +1,132 @@
+package omitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// CopyFile copies src to dst, along with its permissions.
+func CopyFile(src, dst string) error {
+	return copyFile(context.Background(), src, dst)
+}
+
+// contextReader reads from r until ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// copyFile copies src to dst like CopyFile, until ctx is done. A copy which
+// is cut short is removed.
+func copyFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("create destination file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, contextReader{ctx: ctx, r: in}); err != nil {
+		if ctx.Err() != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+		return fmt.Errorf("copying data: %w", err)
+	}
+
+	if err = out.Sync(); err != nil {
+		return fmt.Errorf("sync destination file: %w", err)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to get file(%q) info: %w", src, err)
+	}
+	if err = os.Chmod(dst, info.Mode()); err != nil {
+		return fmt.Errorf("failed to set file(%q) permissions: %w", dst, err)
+	}
+
+	return nil
+}
+
+// minChunkSize is the smallest range copied by a single goroutine. Files too
+// small to be split in chunks of at least this size are copied sequentially.
+const minChunkSize = 8 << 20
+
+// copyFileChunked copies src to dst like copyFile, but with up to chunks
+// goroutines, each copying its own byte range of the file.
+func copyFileChunked(ctx context.Context, src, dst string, chunks int) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("get file(%q) info: %w", src, err)
+	}
+	size := info.Size()
+	chunks = int(min(int64(chunks), size/minChunkSize))
+	if chunks < 2 {
+		return copyFile(ctx, src, dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("create destination file: %w", err)
+	}
+	defer out.Close()
+	if err = out.Truncate(size); err != nil {
+		return fmt.Errorf("allocate destination file: %w", err)
+	}
+
+	chunkSize := (size + int64(chunks) - 1) / int64(chunks)
+	errs := make([]error, chunks)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		offset := int64(i) * chunkSize
+		length := min(chunkSize, size-offset)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := io.NewSectionReader(in, offset, length)
+			w := io.NewOffsetWriter(out, offset)
+			if _, err := io.Copy(w, contextReader{ctx: ctx, r: r}); err != nil {
+				errs[i] = fmt.Errorf("copying chunk at %d: %w", offset, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		if ctx.Err() != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+		return err
+	}
+
+	if err = out.Sync(); err != nil {
+		return fmt.Errorf("sync destination file: %w", err)
+	}
+	if err = os.Chmod(dst, info.Mode()); err != nil {
+		return fmt.Errorf("set file(%q) permissions: %w", dst, err)
+	}
+	return nil
+}
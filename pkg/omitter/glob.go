@@ -0,0 +1,135 @@
+package omitter
+
+import (
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ValidGlob reports whether pattern is a well-formed glob of Include or
+// Exclude.
+func ValidGlob(pattern string) bool {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchGlob reports whether name, a slash separated path relative to the root
+// of a tree, matches pattern. Patterns without a slash match the last element
+// of name at any depth, as *.jpg does. Others match the whole of name, where
+// a ** element matches any number of elements, as in **/node_modules/**.
+func MatchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// relPath returns the slash separated path of path relative to the root of
+// opts.
+func (opts Options) relPath(path string) string {
+	rel, err := filepath.Rel(opts.Path, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// anchoredPath returns the slash separated path of file relative to its
+// nearest AnchorDir, or relative to the root of opts if AnchorDir is not set.
+// It returns false if file has no AnchorDir above it.
+func (opts Options) anchoredPath(file string) (string, bool) {
+	rel := opts.relPath(file)
+	if opts.AnchorDir == "" {
+		return rel, true
+	}
+	elems := strings.Split(rel, "/")
+	for i := len(elems) - 2; i >= 0; i-- {
+		if elems[i] == opts.AnchorDir {
+			return strings.Join(elems[i+1:], "/"), true
+		}
+	}
+	if !opts.rootAnchored {
+		return "", false
+	}
+	return path.Join(opts.rootAnchor, rel), true
+}
+
+// rootAnchor returns the slash separated path of root relative to the
+// nearest dir named anchor holding it, or root itself, and whether there is
+// one.
+func rootAnchor(root, anchor string) (string, bool) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	elems := strings.Split(filepath.ToSlash(abs), "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if elems[i] == anchor {
+			return strings.Join(elems[i+1:], "/"), true
+		}
+	}
+	return "", false
+}
+
+// excludedDir reports whether the dir at path matches Exclude, so nothing
+// under it needs to be walked.
+func (opts Options) excludedDir(path string) bool {
+	if len(opts.Exclude) == 0 || path == opts.Path {
+		return false
+	}
+	// A dir without an anchor may still hold one.
+	rel, ok := opts.anchoredPath(path)
+	if !ok || rel == "" {
+		return false
+	}
+	return slices.ContainsFunc(opts.Exclude, func(pattern string) bool {
+		return MatchGlob(pattern, rel)
+	})
+}
+
+// selected reports whether the file at path matches Include, if set, and
+// does not match Exclude.
+func (opts Options) selected(path string) bool {
+	if len(opts.Include) == 0 && len(opts.Exclude) == 0 {
+		return true
+	}
+	rel, ok := opts.anchoredPath(path)
+	if !ok {
+		return false
+	}
+	matches := func(pattern string) bool {
+		return MatchGlob(pattern, rel)
+	}
+	if slices.ContainsFunc(opts.Exclude, matches) {
+		return false
+	}
+	return len(opts.Include) == 0 || slices.ContainsFunc(opts.Include, matches)
+}
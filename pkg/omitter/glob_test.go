@@ -0,0 +1,128 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMatchGlob verifies globs against paths, with and without ** elements.
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.jpg", "a.jpg", true},
+		{"*.jpg", "sub/dir/a.jpg", true},
+		{"*.jpg", "a.png", false},
+		{"sub/*.jpg", "sub/a.jpg", true},
+		{"sub/*.jpg", "sub/dir/a.jpg", false},
+		{"/sub/*.jpg", "sub/a.jpg", true},
+		{"**/node_modules/**", "node_modules/a.js", true},
+		{"**/node_modules/**", "app/node_modules/lib/a.js", true},
+		{"**/node_modules/**", "app/node_modules", true},
+		{"**/node_modules/**", "app/modules/a.js", false},
+		{"sub/**/*.txt", "sub/a.txt", true},
+		{"sub/**/*.txt", "sub/x/y/a.txt", true},
+		{"sub/**/*.txt", "other/a.txt", false},
+	}
+	for _, tc := range tests {
+		if got := MatchGlob(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+	if ValidGlob("[a-") {
+		t.Errorf("expected [a- to be invalid")
+	}
+}
+
+// TestWalkerIncludeExclude verifies that exclude takes precedence over
+// include, and that excluded dirs are not walked.
+func TestWalkerIncludeExclude(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testglob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err = os.MkdirAll(filepath.Join(tempDir, "app", "node_modules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	included := createTempFile(t, tempDir, "a_x.jpg", "dummy")
+	other := createTempFile(t, tempDir, "b_x.txt", "dummy")
+	excluded := createTempFile(t, filepath.Join(tempDir, "app", "node_modules"), "c_x.jpg", "dummy")
+
+	plan, err := NewPlan(Options{
+		Path: tempDir, Str: "_x",
+		Include: []string{"*.jpg"}, Exclude: []string{"**/node_modules/**"},
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if _, ok := plan.Pairs[included]; !ok || len(plan.Pairs) != 1 {
+		t.Errorf("expected only %s in pairs, got %v", included, plan.Pairs)
+	}
+	reasons := make(map[string]string)
+	for _, s := range plan.Skipped {
+		reasons[s.Path] = s.Reason
+	}
+	if reasons[other] != SKIP_GLOB_FILTERED {
+		t.Errorf("expected %s to be skipped as %q, got %q", other, SKIP_GLOB_FILTERED, reasons[other])
+	}
+	if _, ok := reasons[excluded]; ok {
+		t.Errorf("did not expect %s to be walked", excluded)
+	}
+}
+
+// TestWalkerAnchorDir verifies that globs are matched relative to the nearest
+// anchor dir, and that files outside of one are skipped.
+func TestWalkerAnchorDir(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testanchor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"a/assets/img", "b/c/assets/img", "d"} {
+		if err = os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := createTempFile(t, filepath.Join(tempDir, "a", "assets", "img"), "x_old.png", "dummy")
+	second := createTempFile(t, filepath.Join(tempDir, "b", "c", "assets", "img"), "y_old.png", "dummy")
+	top := createTempFile(t, filepath.Join(tempDir, "b", "c", "assets"), "z_old.png", "dummy")
+	outside := createTempFile(t, filepath.Join(tempDir, "d"), "w_old.png", "dummy")
+
+	plan, err := NewPlan(Options{
+		Path: tempDir, Str: "_old", AnchorDir: "assets", Include: []string{"img/*.png"},
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if _, ok := plan.Pairs[first]; !ok {
+		t.Errorf("expected %s in pairs", first)
+	}
+	if _, ok := plan.Pairs[second]; !ok {
+		t.Errorf("expected %s in pairs", second)
+	}
+	reasons := make(map[string]string)
+	for _, s := range plan.Skipped {
+		reasons[s.Path] = s.Reason
+	}
+	if reasons[top] != SKIP_GLOB_FILTERED {
+		t.Errorf("expected %s to be skipped as %q, got %q", top, SKIP_GLOB_FILTERED, reasons[top])
+	}
+	if reasons[outside] != SKIP_NO_ANCHOR {
+		t.Errorf("expected %s to be skipped as %q, got %q", outside, SKIP_NO_ANCHOR, reasons[outside])
+	}
+
+	// The root itself may be within an anchor.
+	root := filepath.Join(tempDir, "a", "assets", "img")
+	plan, err = NewPlan(Options{Path: root, Str: "_old", AnchorDir: "assets", Include: []string{"img/*.png"}})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if _, ok := plan.Pairs[first]; !ok {
+		t.Errorf("expected %s in pairs with an anchored root", first)
+	}
+}
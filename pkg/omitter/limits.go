@@ -0,0 +1,56 @@
+package omitter
+
+import "sync"
+
+// copyBufferSize is the size of the buffer every stream of a copy holds, as
+// io.Copy allocates.
+const copyBufferSize = 32 << 10
+
+// budget is a pool of units, such as open files or bytes of memory, which
+// operations take from before they start and give back once they are done.
+// A nil budget is unlimited.
+type budget struct {
+	mu    sync.Mutex
+	freed *sync.Cond
+	limit int64
+	used  int64
+}
+
+// newBudget returns a budget of limit units, or nil if limit is not
+// positive.
+func newBudget(limit int64) *budget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &budget{limit: limit}
+	b.freed = sync.NewCond(&b.mu)
+	return b
+}
+
+// take waits until n units are free and takes them, and returns how many it
+// took. Operations needing more than the limit on their own take all of it,
+// and so run alone.
+func (b *budget) take(n int64) int64 {
+	if b == nil {
+		return 0
+	}
+	n = min(n, b.limit)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used+n > b.limit {
+		b.freed.Wait()
+	}
+	b.used += n
+	return n
+}
+
+// give gives back n units taken before.
+func (b *budget) give(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.freed.Broadcast()
+}
@@ -0,0 +1,63 @@
+package omitter
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization forms of Normalize.
+const (
+	NORMALIZE_NFC string = "nfc"
+	NORMALIZE_NFD string = "nfd"
+)
+
+// transliterations are the letters which do not decompose into an ASCII
+// letter and marks.
+var transliterations = strings.NewReplacer(
+	"ß", "ss", "ẞ", "SS", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE",
+	"ø", "o", "Ø", "O", "đ", "d", "Đ", "D", "ł", "l", "Ł", "L",
+	"þ", "th", "Þ", "Th", "ð", "d", "Ð", "D", "ı", "i",
+)
+
+// Normalize returns name in the Unicode normalization form, NORMALIZE_NFC
+// or NORMALIZE_NFD. macOS has long written names decomposed, while Linux and
+// Windows keep them as typed, which is mostly composed, so the same name can
+// be two different files.
+func Normalize(name, form string) string {
+	if form == NORMALIZE_NFD {
+		return norm.NFD.String(name)
+	}
+	return norm.NFC.String(name)
+}
+
+// ValidNormalForm reports whether form is a normalization form of
+// Normalize.
+func ValidNormalForm(form string) bool {
+	return form == NORMALIZE_NFC || form == NORMALIZE_NFD
+}
+
+// Transliterate returns name in ASCII: letters lose their accents, as in é
+// to e, a few others are spelled out, as in ß to ss, and what is left
+// outside of ASCII, such as emoji, is removed, along with the spaces around
+// it.
+func Transliterate(name string) string {
+	var b strings.Builder
+	var removed bool
+	for _, r := range norm.NFD.String(transliterations.Replace(name)) {
+		switch {
+		case r <= unicode.MaxASCII:
+			b.WriteRune(r)
+		case !unicode.Is(unicode.Mn, r):
+			removed = true
+		}
+	}
+	if !removed {
+		return b.String()
+	}
+	ext := filepath.Ext(b.String())
+	stem := strings.TrimSuffix(b.String(), ext)
+	return strings.Join(strings.Fields(stem), " ") + ext
+}
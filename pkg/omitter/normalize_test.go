@@ -0,0 +1,58 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTransliterate verifies that accents are dropped, special letters spelled
+// out, and what is left outside of ASCII removed.
+func TestTransliterate(t *testing.T) {
+	tests := map[string]string{
+		"report.txt":           "report.txt",
+		"Café résumé.txt":      "Cafe resume.txt",
+		"Müller Straße.pdf":    "Muller Strasse.pdf",
+		"Øresund Łódź.jpg":     "Oresund Lodz.jpg",
+		"party 🎉 photos 🎈.png": "party photos.png",
+		"日本.txt":               ".txt",
+	}
+	for name, want := range tests {
+		if got := Transliterate(name); got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+// TestPlanNormalize verifies that decomposed names are composed, and that
+// the composed names which exist already are conflicts.
+func TestPlanNormalize(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testnormalize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	nfd := createTempFile(t, tempDir, "Cafe\u0301.txt", "dummy")
+	createTempFile(t, tempDir, "plain.txt", "dummy")
+	if Normalize(filepath.Base(nfd), NORMALIZE_NFC) != "Café.txt" {
+		t.Fatalf("expected the name to be composed, got %q", Normalize(filepath.Base(nfd), NORMALIZE_NFC))
+	}
+
+	plan, err := NewPlan(Options{Path: tempDir, Normalize: NORMALIZE_NFC})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 1 || plan.Pairs[nfd] != filepath.Join(tempDir, "Café.txt") {
+		t.Errorf("expected only %s to be composed, got %v", nfd, plan.Pairs)
+	}
+
+	createTempFile(t, tempDir, "Café.txt", "dummy")
+	plan, err = NewPlan(Options{Path: tempDir, Normalize: NORMALIZE_NFC})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if plan.Pairs[nfd] != filepath.Join(tempDir, "Café_1.txt") {
+		t.Errorf("expected the composed name to be a conflict, got %v", plan.Pairs)
+	}
+}
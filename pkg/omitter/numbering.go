@@ -0,0 +1,65 @@
+package omitter
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Orders files are numbered in.
+const (
+	NUMBER_SORT_NAME  string = "name"
+	NUMBER_SORT_MTIME string = "mtime"
+)
+
+// DEFAULT_NUMBER_FORMAT formats numbers with no padding.
+const DEFAULT_NUMBER_FORMAT string = "%d"
+
+// Numbering appends sequential numbers to names, as in holiday_001.jpg and
+// holiday_002.jpg, in the order of their files. Streams number files in the
+// order they are walked instead.
+type Numbering struct {
+	// Start is the number of the first file, and Step is added for each
+	// following one, 1 if zero.
+	Start int
+	Step  int
+	// Format formats the numbers, DEFAULT_NUMBER_FORMAT if empty.
+	Format string
+	// Sort is the order files are numbered in, NUMBER_SORT_NAME if empty:
+	// by name, then by path for files of the same name.
+	Sort string
+}
+
+// Apply returns name with the number of the count-th file before its
+// extension.
+func (n Numbering) Apply(name string, count int) string {
+	step := cmp.Or(n.Step, 1)
+	ext := filepath.Ext(name)
+	number := fmt.Sprintf(cmp.Or(n.Format, DEFAULT_NUMBER_FORMAT), n.Start+(count-1)*step)
+	return strings.TrimSuffix(name, ext) + number + ext
+}
+
+// ValidNumberFormat reports whether format formats a single number.
+func ValidNumberFormat(format string) bool {
+	formatted := fmt.Sprintf(format, 1)
+	return !strings.Contains(formatted, "%!") &&
+		formatted != fmt.Sprintf(format, 2) &&
+		!strings.ContainsAny(formatted, `/\`)
+}
+
+// sort sorts candidates in the order they are numbered in.
+func (n Numbering) sort(candidates []candidate) {
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if n.Sort == NUMBER_SORT_MTIME {
+			if c := a.modTime.Compare(b.modTime); c != 0 {
+				return c
+			}
+		}
+		return cmp.Or(
+			cmp.Compare(filepath.Base(a.path), filepath.Base(b.path)),
+			cmp.Compare(a.path, b.path),
+		)
+	})
+}
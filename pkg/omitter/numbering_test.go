@@ -0,0 +1,76 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestNumbering verifies that files are numbered by name or by mtime, from
+// the start by the step.
+func TestNumbering(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testnumbering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err = os.Mkdir(filepath.Join(tempDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := createTempFile(t, tempDir, "a.jpg", "dummy")
+	b := createTempFile(t, tempDir, "b.jpg", "dummy")
+	c := createTempFile(t, tempDir, filepath.Join("sub", "c.jpg"), "dummy")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, path := range []string{c, b, a} {
+		mtime := base.Add(time.Duration(i) * time.Hour)
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		number Numbering
+		want   map[string]string
+	}{
+		{
+			Numbering{Start: 1, Format: "%03d"},
+			map[string]string{a: "holiday_001.jpg", b: "holiday_002.jpg", c: "holiday_003.jpg"},
+		},
+		{
+			Numbering{Start: 10, Step: 5, Sort: NUMBER_SORT_MTIME},
+			map[string]string{c: "holiday_10.jpg", b: "holiday_15.jpg", a: "holiday_20.jpg"},
+		},
+	}
+	for _, tc := range tests {
+		plan, err := NewPlan(Options{
+			Path:    tempDir,
+			Str:     "^[a-z]+",
+			Pattern: regexp.MustCompile("^[a-z]+"),
+			Replace: "holiday_",
+			Number:  &tc.number,
+		})
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		for path, name := range tc.want {
+			if want := filepath.Join(filepath.Dir(path), name); plan.Pairs[path] != want {
+				t.Errorf("%+v: expected %s, got %s", tc.number, want, plan.Pairs[path])
+			}
+		}
+	}
+}
+
+// TestNumberingWithoutStr verifies that every file is numbered when there is
+// nothing to find, even if its name is unchanged otherwise.
+func TestNumberingWithoutStr(t *testing.T) {
+	got, err := ProposeNames([]string{"b.txt", "a.txt"}, Options{Number: &Numbering{Format: "_%d"}})
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	if got[0].New != "b_1.txt" || got[1].New != "a_0.txt" {
+		t.Errorf("expected a_0.txt and b_1.txt, got %v", got)
+	}
+}
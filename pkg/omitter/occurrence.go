@@ -0,0 +1,95 @@
+package omitter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Named occurrences of ParseOccurrence.
+const (
+	OCCURRENCE_FIRST string = "first"
+	OCCURRENCE_LAST  string = "last"
+)
+
+// ParseOccurrence parses first, last or the position of a match from 1, and
+// returns it as Options.Occurrence counts them.
+func ParseOccurrence(s string) (int, error) {
+	switch s {
+	case OCCURRENCE_FIRST:
+		return 1, nil
+	case OCCURRENCE_LAST:
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("occurrence must be first, last or a position such as 2 or -2, got %q", s)
+	}
+	return n, nil
+}
+
+// selectSpans returns the spans of the matches selected by occurrence and
+// count, as described in Options. Zero for both selects every match.
+func selectSpans(spans [][]int, occurrence, count int) [][]int {
+	if occurrence == 0 && count <= 0 {
+		return spans
+	}
+	if count <= 0 {
+		count = 1
+	}
+	start, end := 0, count
+	switch {
+	case occurrence > 0:
+		start, end = occurrence-1, occurrence-1+count
+	case occurrence < 0:
+		end = len(spans) + occurrence + 1
+		start = end - count
+	}
+	start, end = max(start, 0), min(end, len(spans))
+	if start >= end {
+		return nil
+	}
+	return spans[start:end]
+}
+
+// replaceSpans replaces every span of name with what replacement returns for
+// it.
+func replaceSpans(name string, spans [][]int, replacement func(span []int) string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(name[last:span[0]])
+		b.WriteString(replacement(span))
+		last = span[1]
+	}
+	b.WriteString(name[last:])
+	return b.String()
+}
+
+// ReplaceOccurrences replaces the occurrences of old in name with new which
+// occurrence and count select, as described in Options.
+func ReplaceOccurrences(name, old, new string, occurrence, count int) string {
+	var spans [][]int
+	for i := 0; old != "" && i <= len(name); {
+		j := strings.Index(name[i:], old)
+		if j < 0 {
+			break
+		}
+		spans = append(spans, []int{i + j, i + j + len(old)})
+		i += j + len(old)
+	}
+	return replaceSpans(name, selectSpans(spans, occurrence, count), func([]int) string {
+		return new
+	})
+}
+
+// ReplaceMatches replaces the matches of pattern in name with template, in
+// which $1 or ${name} refer to the groups of the match, for the matches
+// which occurrence and count select, as described in Options.
+func ReplaceMatches(pattern *regexp.Regexp, name, template string, occurrence, count int) string {
+	spans := pattern.FindAllStringSubmatchIndex(name, -1)
+	return replaceSpans(name, selectSpans(spans, occurrence, count), func(span []int) string {
+		return string(pattern.ExpandString(nil, template, name, span))
+	})
+}
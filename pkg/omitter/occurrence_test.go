@@ -0,0 +1,66 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestReplaceOccurrences verifies that occurrence and count select the
+// matches which are replaced, from the start or from the end.
+func TestReplaceOccurrences(t *testing.T) {
+	tests := []struct {
+		occurrence, count int
+		want              string
+	}{
+		{0, 0, "x_b_x_c_x.txt"},
+		{1, 0, "x_b_a_c_a.txt"},
+		{-1, 0, "a_b_a_c_x.txt"},
+		{2, 0, "a_b_x_c_a.txt"},
+		{-2, 2, "x_b_x_c_a.txt"},
+		{2, 5, "a_b_x_c_x.txt"},
+		{0, 2, "x_b_x_c_a.txt"},
+		{4, 0, "a_b_a_c_a.txt"},
+		{-4, 0, "a_b_a_c_a.txt"},
+	}
+	for _, tt := range tests {
+		if got := ReplaceOccurrences("a_b_a_c_a.txt", "a", "x", tt.occurrence, tt.count); got != tt.want {
+			t.Errorf("occurrence %d, count %d: expected %q, got %q", tt.occurrence, tt.count, tt.want, got)
+		}
+	}
+
+	pattern := regexp.MustCompile(`(\d+)`)
+	if got := ReplaceMatches(pattern, "v1_v2_v3.txt", "<$1>", -1, 0); got != "v1_v2_v<3>.txt" {
+		t.Errorf("expected the last match to be replaced, got %q", got)
+	}
+
+	for s, want := range map[string]int{"first": 1, "last": -1, "3": 3, "-2": -2} {
+		if got, err := ParseOccurrence(s); err != nil || got != want {
+			t.Errorf("%q: expected %d, got %d, %v", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"0", "second", ""} {
+		if _, err := ParseOccurrence(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
+
+// TestPlanOccurrence verifies that only the last occurrence is replaced.
+func TestPlanOccurrence(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testoccurrence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := createTempFile(t, tempDir, "a_b_a.txt", "dummy")
+	plan, err := NewPlan(Options{Path: tempDir, Str: "a", Replace: "x", Occurrence: -1})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if want := filepath.Join(tempDir, "a_b_x.txt"); plan.Pairs[path] != want {
+		t.Errorf("expected %s, got %v", want, plan.Pairs)
+	}
+}
@@ -0,0 +1,995 @@
+// Package omitter is the renaming engine of the omitter command. It plans the
+// new names of the files of a tree, resolves their conflicts, and renames,
+// copies or moves them accordingly.
+package omitter
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	RENAME string = "rename"
+	COPY   string = "copy"
+	MOVE   string = "move"
+)
+
+// Reasons of files being skipped.
+const (
+	SKIP_NO_MATCH         string = "no_match"
+	SKIP_EXT_FILTERED     string = "ext_filtered"
+	SKIP_EMPTY_RESULT     string = "empty_result"
+	SKIP_DISALLOWED_CHARS string = "disallowed_chars"
+	SKIP_UNCHANGED        string = "unchanged"
+	SKIP_GLOB_FILTERED    string = "glob_filtered"
+	SKIP_CONFLICT         string = "conflict"
+	SKIP_NO_ANCHOR        string = "no_anchor"
+	SKIP_TOO_DEEP         string = "too_deep"
+	SKIP_TEMP             string = "temp"
+)
+
+// TempPatterns match the names of the transient files which other programs
+// are still producing, such as partial downloads and Office lock files,
+// which are skipped unless Options.IncludeTemp is set.
+var TempPatterns = []string{"*.part", "*.crdownload", "*.tmp", "~$*.docx", "~$*.xlsx", "~$*.pptx", ".DS_Store"}
+
+// DEFAULT_CONFLICT_SUFFIX is appended to names which are already taken.
+const DEFAULT_CONFLICT_SUFFIX string = "_%d"
+
+const (
+	FALLBACK_REPLACE string = "replace"
+	FALLBACK_FAIL    string = "fail"
+	FALLBACK_SKIP    string = "skip"
+)
+
+// Options select the files of a tree and describe their new names.
+type Options struct {
+	// Path is the root of the tree.
+	Path string
+	// Str is removed from names, or replaced with Replace.
+	Str     string
+	Replace string
+	// Pattern, if set, is searched in names instead of Str. Files without a
+	// match are skipped, and in the others every match is replaced with
+	// Replace, where $1 or ${name} refer to the groups of the match.
+	Pattern *regexp.Regexp
+	// Remap, if set, is used instead of Replace: the text which the
+	// RemapGroup-th group of Pattern captures is replaced with its value in
+	// Remap, or kept if it has none.
+	Remap      map[string]string
+	RemapGroup int
+	// Occurrence and Count, if set, limit the matches of Str or Pattern
+	// which are replaced with Replace. Occurrence selects a match by its
+	// position from 1, or from the end if negative, as -1 for the last, and
+	// Count replaces as many from there, towards the end, or towards the
+	// start for a negative Occurrence. Count alone replaces the first ones.
+	// Remap replaces every match.
+	Occurrence int
+	Count      int
+	// Substitutions, if set, are made after Str, if set, one after the
+	// other on the name the previous ones left, with Occurrence and Count
+	// unless they have their own. Files are renamed if Str or any of them
+	// matches.
+	Substitutions []Substitution
+	// Dict, if set, maps tokens to the text they are replaced with in names.
+	// Longer tokens are matched first, in a single pass.
+	Dict map[string]string
+	// FileType, if set, is the only extension files are renamed with.
+	FileType string
+	// TypeGroup, if set, is the key of the TypeGroups files must belong to,
+	// detected by content if Sniff is set.
+	TypeGroup string
+	Sniff     bool
+	// IncludeTemp renames the files matching TempPatterns too, which are
+	// skipped by default.
+	IncludeTemp bool
+	// Include, if set, are the globs of MatchGlob which files must match to
+	// be renamed. Files matching Exclude are skipped, and dirs matching it
+	// are not walked, even if they match Include as well.
+	Include []string
+	Exclude []string
+	// AnchorDir, if set, is the name of the dirs Include and Exclude are
+	// relative to instead of Path: the nearest one above each file, which
+	// may be Path or one of its parents. Files without one are skipped.
+	AnchorDir string
+	// MaxDepth, if positive, is the depth of the deepest files walked, where
+	// 1 is the files of Path itself.
+	MaxDepth int
+	// Swap, if set, swaps the parts of names around its first occurrence,
+	// as in Lastname_Firstname to Firstname_Lastname.
+	Swap string
+	// ReverseStem reverses names, leaving their extension in place.
+	ReverseStem bool
+	// Prefix and Suffix, if set, are added to the start of names, and to the
+	// end of them before the extension, unless they are there already. If
+	// Str is set, only names with a match get them.
+	Prefix string
+	Suffix string
+	// Number, if set, numbers the names the other options compute. Files
+	// are renamed even if those are unchanged, unless Str is set.
+	Number *Numbering
+	// Redact, if set, masks its matches in names.
+	Redact *regexp.Regexp
+	// AllowedChars, if set, matches every allowed character of the names.
+	// Others are handled by AllowFallback, one of FALLBACK_REPLACE, the
+	// default if empty, FALLBACK_FAIL and FALLBACK_SKIP.
+	AllowedChars  *regexp.Regexp
+	AllowFallback string
+	// ASCII transliterates the new names to ASCII with Transliterate, and
+	// Normalize, if set, brings them to its form with Normalize.
+	ASCII     bool
+	Normalize string
+	// Sanitize makes the new names safe to use on Windows and exFAT with
+	// Sanitize, replacing unsafe characters with SanitizeChar.
+	Sanitize     bool
+	SanitizeChar string
+	// Output, if set, is the dir files are copied or moved to.
+	Output string
+	// Template, if set, builds the new names, out of the names the other
+	// options compute. Files are renamed even if those are unchanged.
+	Template *Template
+	// Location, if set, is the time zone template dates are written in,
+	// instead of the local one.
+	Location *time.Location
+	// ConflictSuffix tells apart names which are already taken.
+	ConflictSuffix ConflictSuffix
+	// OnConflict is the policy of new names which are already taken,
+	// CONFLICT_SUFFIX if empty. AskConflict, if set, is asked for the policy
+	// of every conflict instead, given the path of the file and the taken
+	// path.
+	OnConflict  string
+	AskConflict func(path, target string) string
+	// Prompter is asked about conflicts under CONFLICT_PROMPT and
+	// CONFLICT_ASK_PER_DIR. Without it, they fail.
+	Prompter Prompter
+	// Clock tells the time of SUFFIX_TIMESTAMP suffixes, unless
+	// ConflictSuffix has one, and of {ulid} placeholders, the system clock
+	// if nil.
+	Clock Clock
+	// Rand is the source of {uuid} and {ulid} placeholders, crypto/rand if
+	// nil. They are drawn in the order files are numbered in, so a seeded
+	// source gives the same names for the same tree.
+	Rand io.Reader
+	// Counterparts, if set, keeps new names which are already taken instead
+	// of resolving the conflict, to pair files with existing ones, such as
+	// originals with their derivatives.
+	Counterparts bool
+	// Assert, if set, are the assertions every new name must hold. Plans
+	// violating them fail with an *AssertionError.
+	Assert []Assertion
+	// Workers is the number of goroutines computing names, GOMAXPROCS if
+	// not positive.
+	Workers int
+	// Context, if set, stops the walk once it is done, with its error.
+	Context context.Context
+
+	// names, if set, are the files of the tree ProposeNames plans for, which
+	// are looked up instead of the file system.
+	names map[string]bool
+	// dict is the replacer of Dict, built once per plan.
+	dict *strings.Replacer
+	// rootAnchor is the path of Path relative to the nearest AnchorDir
+	// holding it, and rootAnchored whether there is one.
+	rootAnchor   string
+	rootAnchored bool
+	// idTime is the time of {ulid} placeholders, the time the plan was made.
+	idTime time.Time
+}
+
+// SkippedFile is a file which was scanned but is not going to be renamed.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Plan is the outcome of walking a tree.
+type Plan struct {
+	// Pairs maps the path of every file to be renamed to its new path.
+	Pairs map[string]string
+	// Skipped are the files which were scanned but are left alone.
+	Skipped []SkippedFile
+}
+
+// TypeGroup is a category of files, by extension or, when sniffing is
+// enabled, by detected content type.
+type TypeGroup struct {
+	Exts  []string
+	Mimes []string
+}
+
+var TypeGroups = map[string]TypeGroup{
+	"images": {
+		Exts:  []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff", ".heic", ".svg", ".ico"},
+		Mimes: []string{"image/"},
+	},
+	"videos": {
+		Exts:  []string{".mp4", ".mkv", ".avi", ".mov", ".wmv", ".webm", ".flv", ".m4v", ".mpg", ".mpeg"},
+		Mimes: []string{"video/"},
+	},
+	"audio": {
+		Exts:  []string{".mp3", ".flac", ".wav", ".ogg", ".m4a", ".aac", ".wma", ".opus", ".aiff"},
+		Mimes: []string{"audio/", "application/ogg"},
+	},
+	"documents": {
+		Exts:  []string{".pdf", ".doc", ".docx", ".odt", ".rtf", ".txt", ".md", ".xls", ".xlsx", ".ods", ".ppt", ".pptx", ".odp", ".csv"},
+		Mimes: []string{"application/pdf", "text/"},
+	},
+	"archives": {
+		Exts:  []string{".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar", ".zst"},
+		Mimes: []string{"application/zip", "application/x-gzip", "application/x-rar-compressed"},
+	},
+}
+
+// candidate is a file which was found to be renamed, before its conflicts
+// are resolved.
+type candidate struct {
+	path       string
+	dir        string
+	newName    string
+	modTime    time.Time
+	changeTime time.Time
+	tags       map[string]string
+	// id are the random bits of {uuid} and {ulid}.
+	id [16]byte
+}
+
+// NewPlan walks the tree of opts, and returns the new path of every file to
+// be renamed, along with the files which were scanned but skipped. Files
+// named after an entry of ignore, or matching it as a glob such as *.orig,
+// are not scanned.
+func NewPlan(opts Options, ignore ...string) (Plan, error) {
+	opts = opts.prepared()
+	var paths []string
+	var entries []fs.DirEntry
+	err := filepath.WalkDir(
+		opts.Path,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case opts.canceled() != nil:
+				return opts.canceled()
+			case file.IsDir() && opts.skipDir(path):
+				return filepath.SkipDir
+			case file.IsDir(), ignored(file.Name(), ignore):
+				return nil
+			}
+			paths = append(paths, path)
+			entries = append(entries, file)
+			return nil
+		})
+	if err != nil {
+		return Plan{}, err
+	}
+
+	// Computing names can be CPU bound, so it runs on its own pool. Results
+	// keep the walk order, which conflict resolution depends on.
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]*candidate, len(paths))
+	reasons := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], reasons[i], errs[i] = transform(opts, paths[i], entries[i])
+			}
+		}()
+	}
+	for i := range paths {
+		if opts.canceled() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err = opts.canceled(); err != nil {
+		return Plan{}, err
+	}
+	if err = errors.Join(errs...); err != nil {
+		return Plan{}, err
+	}
+	var candidates []candidate
+	var skipped []SkippedFile
+	for i, c := range results {
+		if c != nil {
+			candidates = append(candidates, *c)
+		} else {
+			skipped = append(skipped, SkippedFile{Path: paths[i], Reason: reasons[i]})
+		}
+	}
+
+	pairs, conflicted, err := opts.resolve(candidates)
+	if err != nil {
+		return Plan{}, err
+	}
+	return Plan{Pairs: pairs, Skipped: append(skipped, conflicted...)}, nil
+}
+
+// PlanFiles plans the files at paths, in the tree of opts, as NewPlan would
+// but without walking it, for callers which know the files that changed.
+// Every other file of the tree is left where it is, so its name stays taken.
+// Files which the walk would not reach are skipped, and ones which are
+// ignored, as by NewPlan, or gone, are left out.
+func PlanFiles(opts Options, paths []string, ignore ...string) (Plan, error) {
+	opts = opts.prepared()
+	var candidates []candidate
+	var skipped []SkippedFile
+	for _, path := range paths {
+		if err := opts.canceled(); err != nil {
+			return Plan{}, err
+		}
+		if ignored(filepath.Base(path), ignore) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return Plan{}, err
+		}
+		var c *candidate
+		reason := opts.walkReason(opts.relPath(path))
+		if reason == "" {
+			if c, reason, err = transform(opts, path, fs.FileInfoToDirEntry(info)); err != nil {
+				return Plan{}, err
+			}
+		}
+		if c != nil {
+			candidates = append(candidates, *c)
+		} else {
+			skipped = append(skipped, SkippedFile{Path: path, Reason: reason})
+		}
+	}
+
+	pairs, conflicted, err := opts.resolve(candidates)
+	if err != nil {
+		return Plan{}, err
+	}
+	return Plan{Pairs: pairs, Skipped: append(skipped, conflicted...)}, nil
+}
+
+// resolve returns the new paths of candidates, in order, or in the order of
+// Number if set, along with the ones which are skipped. Conflicts are
+// resolved against the tree as it will be after the run: names taken by earlier candidates are occupied, and in
+// rename mode the names of renamed files are freed. Skipped candidates stay
+// where they are, so they are resolved again until none of the files staying
+// had its name given away.
+func (opts Options) resolve(candidates []candidate) (map[string]string, []SkippedFile, error) {
+	if opts.Number != nil {
+		opts.Number.sort(candidates)
+	}
+	for i := range candidates {
+		if err := opts.drawID(&candidates[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Conflicts are asked about once, however many times they are resolved.
+	if ask := opts.AskConflict; ask != nil {
+		answers := make(map[[2]string]string)
+		opts.AskConflict = func(path, target string) string {
+			key := [2]string{path, target}
+			if _, ok := answers[key]; !ok {
+				answers[key] = ask(path, target)
+			}
+			return answers[key]
+		}
+	}
+	staying := make(map[string]bool)
+	for {
+		pairs, skipped, err := opts.resolveStaying(candidates, staying)
+		if err != nil {
+			return nil, nil, err
+		}
+		settled := true
+		for _, s := range skipped {
+			if !staying[s.Path] {
+				staying[s.Path], settled = true, false
+			}
+		}
+		if !settled {
+			continue
+		}
+		if err = CheckAssertions(pairs, opts.Assert); err != nil {
+			return nil, nil, err
+		}
+		return pairs, skipped, nil
+	}
+}
+
+// resolveStaying resolves candidates, as resolve does, with the ones in
+// staying left where they are.
+func (opts Options) resolveStaying(candidates []candidate, staying map[string]bool,
+) (map[string]string, []SkippedFile, error) {
+	taken := make(map[string]bool)
+	vacated := make(map[string]bool)
+	if opts.Output == "" {
+		for _, c := range candidates {
+			vacated[c.path] = !staying[c.path]
+		}
+	}
+	pairs := make(map[string]string)
+	var skipped []SkippedFile
+	for i, c := range candidates {
+		newPath, reason, err := finalPath(opts, c, i+1, taken, vacated)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			skipped = append(skipped, SkippedFile{Path: c.path, Reason: reason})
+			continue
+		}
+		pairs[c.path] = newPath
+		taken[newPath] = true
+	}
+	return pairs, skipped, nil
+}
+
+// prepared returns opts with what planning derives from them filled in.
+func (opts Options) prepared() Options {
+	if opts.Pattern != nil {
+		opts.Replace = numberedGroupsBraced(opts.Replace)
+	}
+	if opts.Dict != nil {
+		opts.dict = dictReplacer(opts.Dict)
+	}
+	if opts.AnchorDir != "" {
+		opts.rootAnchor, opts.rootAnchored = rootAnchor(opts.Path, opts.AnchorDir)
+	}
+	switch opts.OnConflict {
+	case CONFLICT_PROMPT:
+		opts.OnConflict, opts.AskConflict = "", AskConflict(opts.Prompter)
+	case CONFLICT_ASK_PER_DIR:
+		opts.OnConflict, opts.AskConflict = "", AskConflictPerDir(opts.Prompter)
+	}
+	// Every timestamp suffix of a plan is the time it was made.
+	if opts.ConflictSuffix.Format == SUFFIX_TIMESTAMP && opts.ConflictSuffix.Time.IsZero() {
+		opts.ConflictSuffix.Time = SystemClock{}.Now()
+		if opts.Clock != nil {
+			opts.ConflictSuffix.Time = opts.Clock.Now()
+		}
+	}
+	if opts.Template != nil && opts.Template.usesIDs() {
+		opts.idTime = SystemClock{}.Now()
+		if opts.Clock != nil {
+			opts.idTime = opts.Clock.Now()
+		}
+	}
+	return opts
+}
+
+// drawID draws the random bits of the {uuid} and {ulid} placeholders of c,
+// if the template has any.
+func (opts Options) drawID(c *candidate) error {
+	if opts.Template == nil || !opts.Template.usesIDs() {
+		return nil
+	}
+	r := opts.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	if _, err := io.ReadFull(r, c.id[:]); err != nil {
+		return fmt.Errorf("draw id: %w", err)
+	}
+	return nil
+}
+
+// finalPath numbers the counter-th candidate c and expands the template for
+// it, and resolves the conflicts of the result. It returns the reason instead
+// if c is skipped.
+func finalPath(opts Options, c candidate, counter int,
+	taken, vacated map[string]bool,
+) (string, string, error) {
+	newName := c.newName
+	if opts.Number != nil {
+		newName = opts.Number.Apply(newName, counter)
+	}
+	if opts.Location != nil {
+		c.modTime, c.changeTime = c.modTime.In(opts.Location), c.changeTime.In(opts.Location)
+	}
+	if opts.Template != nil {
+		newName = opts.Template.expand(templateVars{
+			name:       newName,
+			parent:     filepath.Base(filepath.Dir(c.path)),
+			counter:    counter,
+			modTime:    c.modTime,
+			changeTime: c.changeTime,
+			tags:       c.tags,
+			id:         c.id,
+			idTime:     opts.idTime,
+		})
+		if newName == "" {
+			return "", SKIP_EMPTY_RESULT, nil
+		}
+	}
+	// Numbers and templates may bring unsafe characters back, such as the
+	// colons of times, or the accents of tags.
+	if opts.Number != nil || opts.Template != nil {
+		if newName = opts.finishName(newName); newName == "" {
+			return "", SKIP_EMPTY_RESULT, nil
+		}
+	}
+	// Other policies than the default one are followed whatever the options,
+	// as they are asked for explicitly. Plain removals overwrite the files
+	// which are left alone, but no two files of the plan ever get the same
+	// new path, as removing text can bring their names together. Counterparts
+	// are existing files, which only a single file may be paired with.
+	policy := cmp.Or(opts.OnConflict, CONFLICT_SUFFIX)
+	target := filepath.Join(c.dir, newName)
+	if opts.Counterparts {
+		if taken[target] {
+			return "", SKIP_CONFLICT, nil
+		}
+	} else if taken[target] || policy != CONFLICT_SUFFIX || opts.AskConflict != nil ||
+		opts.Replace != "" || opts.Remap != nil || opts.Dict != nil ||
+		opts.Swap != "" || opts.ReverseStem || opts.Prefix != "" || opts.Suffix != "" ||
+		opts.Number != nil || opts.Template != nil || opts.finishesNames() {
+		var err error
+		newName, err = onConflict(opts, c, newName, taken, vacated)
+		if err != nil || newName == "" {
+			return "", SKIP_CONFLICT, err
+		}
+	}
+	newPath := filepath.Join(c.dir, newName)
+	if c.path == newPath {
+		return "", SKIP_UNCHANGED, nil
+	}
+	return newPath, "", nil
+}
+
+// finishName transliterates, normalizes and sanitizes name, as set in opts,
+// after every other option. Files are renamed if only these change their
+// names.
+func (opts Options) finishName(name string) string {
+	if opts.ASCII {
+		name = Transliterate(name)
+	}
+	if opts.Normalize != "" {
+		name = Normalize(name, opts.Normalize)
+	}
+	if opts.Sanitize {
+		name = Sanitize(name, opts.SanitizeChar)
+	}
+	return name
+}
+
+// finishesNames reports whether finishName changes names.
+func (opts Options) finishesNames() bool {
+	return opts.ASCII || opts.Normalize != "" || opts.Sanitize
+}
+
+// transform computes the new name of the file at path. It returns nil and
+// the reason if the file is skipped.
+func transform(opts Options, path string, entry fs.DirEntry) (*candidate, string, error) {
+	if reason := opts.filter(path); reason != "" {
+		return nil, reason, nil
+	}
+	oldName := filepath.Base(path)
+	newName := oldName
+	if opts.Str != "" {
+		targetStr := searchString(opts.Pattern, opts.Str, oldName)
+		if opts.Pattern != nil && targetStr == "" && !opts.matches(oldName) {
+			return nil, SKIP_NO_MATCH, nil
+		}
+		switch {
+		case opts.Pattern != nil && opts.Remap != nil:
+			newName = RemapCaptures(opts.Pattern, oldName, opts.RemapGroup, opts.Remap)
+		case opts.Pattern != nil && (opts.Occurrence != 0 || opts.Count > 0):
+			newName = ReplaceMatches(opts.Pattern, oldName, opts.Replace, opts.Occurrence, opts.Count)
+		case opts.Pattern != nil:
+			newName = opts.Pattern.ReplaceAllString(oldName, opts.Replace)
+		default:
+			newName = ReplaceOccurrences(oldName, targetStr, opts.Replace, opts.Occurrence, opts.Count)
+		}
+	}
+	for _, s := range opts.Substitutions {
+		newName = s.apply(newName, opts.Occurrence, opts.Count)
+	}
+	if opts.dict != nil {
+		newName = opts.dict.Replace(newName)
+	}
+	if opts.Swap != "" {
+		newName = Swap(newName, opts.Swap)
+	}
+	if opts.ReverseStem {
+		newName = ReverseStem(newName)
+	}
+	// Affixes, and the characters names are finished with, only concern the
+	// files searched for, if any.
+	matched := !opts.searches() || opts.matches(oldName)
+	if (opts.Prefix != "" || opts.Suffix != "") && matched {
+		newName = AddAffixes(newName, opts.Prefix, opts.Suffix)
+	}
+	if opts.Redact != nil {
+		newName = Redact(newName, opts.Redact)
+	}
+	if matched {
+		newName = opts.finishName(newName)
+	}
+	if opts.AllowedChars != nil && matched {
+		var ok bool
+		var err error
+		newName, ok, err = EnforceAllowedChars(newName, opts.AllowedChars, opts.AllowFallback)
+		if err != nil {
+			return nil, "", &FileError{Old: path, Err: err}
+		}
+		if !ok {
+			return nil, SKIP_DISALLOWED_CHARS, nil
+		}
+	}
+	switch {
+	case newName == "":
+		return nil, SKIP_EMPTY_RESULT, nil
+	case newName == oldName && (opts.Template == nil && opts.Number == nil || opts.searches()):
+		return nil, SKIP_NO_MATCH, nil
+	}
+
+	var modTime, ctime time.Time
+	if opts.Template != nil && opts.Template.usesDates() ||
+		opts.Number != nil && opts.Number.Sort == NUMBER_SORT_MTIME {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, "", fmt.Errorf("get file(%q) info: %w", path, err)
+		}
+		modTime, ctime = info.ModTime(), changeTime(info)
+	}
+	var tags map[string]string
+	if opts.Template != nil && opts.Template.usesTags() {
+		var err error
+		if tags, err = ReadTags(path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var targetDir string
+	if opts.Output != "" {
+		targetDir = opts.Output
+	} else {
+		targetDir = path
+	}
+	return &candidate{
+		path: path, dir: filepath.Dir(targetDir), newName: newName, modTime: modTime,
+		changeTime: ctime, tags: tags,
+	}, "", nil
+}
+
+// filter returns the reason the file at path is skipped by the filters of
+// opts, or an empty string if it passes them.
+func (opts Options) filter(path string) string {
+	if !opts.IncludeTemp && IsTemp(filepath.Base(path)) {
+		return SKIP_TEMP
+	}
+	if _, ok := opts.anchoredPath(path); !ok {
+		return SKIP_NO_ANCHOR
+	}
+	if !opts.selected(path) {
+		return SKIP_GLOB_FILTERED
+	}
+	if fileExt := filepath.Ext(path); opts.FileType != "" && fileExt != "" {
+		if fileExt != opts.FileType {
+			return SKIP_EXT_FILTERED
+		}
+	}
+	if opts.TypeGroup != "" &&
+		!InTypeGroup(path, TypeGroups[opts.TypeGroup], opts.Sniff) {
+		return SKIP_EXT_FILTERED
+	}
+	return ""
+}
+
+// Select walks the tree of opts like NewPlan, but only returns the files
+// which pass its filters and, if Str is set, contain Str or a match of
+// Pattern, for actions which do not rename them. Files are ignored as by
+// NewPlan.
+func Select(opts Options, ignore ...string) ([]string, []SkippedFile, error) {
+	opts = opts.prepared()
+	var paths []string
+	var skipped []SkippedFile
+	err := filepath.WalkDir(
+		opts.Path,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case opts.canceled() != nil:
+				return opts.canceled()
+			case file.IsDir() && opts.skipDir(path):
+				return filepath.SkipDir
+			case file.IsDir(), ignored(file.Name(), ignore):
+				return nil
+			}
+			reason := opts.filter(path)
+			if reason == "" && opts.searches() && !opts.matches(file.Name()) {
+				reason = SKIP_NO_MATCH
+			}
+			if reason != "" {
+				skipped = append(skipped, SkippedFile{Path: path, Reason: reason})
+				return nil
+			}
+			paths = append(paths, path)
+			return nil
+		})
+	return paths, skipped, err
+}
+
+// canceled returns the error of Context once it is done.
+func (opts Options) canceled() error {
+	if opts.Context == nil {
+		return nil
+	}
+	return opts.Context.Err()
+}
+
+// skipDir reports whether the dir at path is not walked, as it is excluded
+// or its files are deeper than MaxDepth.
+func (opts Options) skipDir(path string) bool {
+	if path == opts.Path {
+		return false
+	}
+	if opts.MaxDepth > 0 && strings.Count(opts.relPath(path), "/")+1 >= opts.MaxDepth {
+		return true
+	}
+	return opts.excludedDir(path)
+}
+
+// searches reports whether names are searched for Str or Substitutions,
+// and left alone if none of them matches.
+func (opts Options) searches() bool {
+	return opts.Str != "" || len(opts.Substitutions) > 0
+}
+
+// matches reports whether name contains Str, or a match of Pattern if set,
+// or a match of any of Substitutions.
+func (opts Options) matches(name string) bool {
+	if opts.Str != "" && (Substitution{Str: opts.Str, Pattern: opts.Pattern}).matches(name) {
+		return true
+	}
+	return slices.ContainsFunc(opts.Substitutions, func(s Substitution) bool {
+		return s.matches(name)
+	})
+}
+
+// ignored reports whether name is an entry of ignore, or matches one as a
+// glob.
+func ignored(name string, ignore []string) bool {
+	return slices.ContainsFunc(ignore, func(pattern string) bool {
+		ok, _ := filepath.Match(pattern, name)
+		return ok || pattern == name
+	})
+}
+
+func searchString(pattern *regexp.Regexp, str, fileName string) string {
+	if pattern == nil {
+		return str
+	}
+	return pattern.FindString(fileName)
+}
+
+// dictReplacer returns the replacer of dict, which tries longer tokens first.
+func dictReplacer(dict map[string]string) *strings.Replacer {
+	// A replacer tries tokens in the order it is given them.
+	tokens := slices.SortedFunc(maps.Keys(dict), func(a, b string) int {
+		if c := cmp.Compare(len(b), len(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	oldnew := make([]string, 0, 2*len(tokens))
+	for _, token := range tokens {
+		oldnew = append(oldnew, token, dict[token])
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// CaptureValues returns the distinct texts, sorted, which the group-th group
+// of opts.Pattern captures in the names of the tree. Files are ignored as by
+// NewPlan.
+func CaptureValues(opts Options, group int, ignore ...string) ([]string, error) {
+	opts = opts.prepared()
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(
+		opts.Path,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case opts.canceled() != nil:
+				return opts.canceled()
+			case file.IsDir() && opts.skipDir(path):
+				return filepath.SkipDir
+			case file.IsDir(), ignored(file.Name(), ignore), !opts.selected(path):
+				return nil
+			}
+			for _, m := range opts.Pattern.FindAllStringSubmatchIndex(file.Name(), -1) {
+				if m[2*group] >= 0 {
+					seen[file.Name()[m[2*group]:m[2*group+1]]] = true
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+// RemapCaptures replaces the text which the group-th group of pattern
+// captures in every match in name with its value in remap, if it has one.
+func RemapCaptures(pattern *regexp.Regexp, name string, group int, remap map[string]string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range pattern.FindAllStringSubmatchIndex(name, -1) {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		value, ok := remap[name[start:end]]
+		if !ok {
+			continue
+		}
+		b.WriteString(name[last:start])
+		b.WriteString(value)
+		last = end
+	}
+	b.WriteString(name[last:])
+	return b.String()
+}
+
+// numberedGroupsBraced wraps the numbered group references of a replacement
+// in braces, so "$2_$1" refers to the groups 2 and 1 rather than to a group
+// named "2_", as regexp would expand it.
+func numberedGroupsBraced(replace string) string {
+	var b strings.Builder
+	for i := 0; i < len(replace); i++ {
+		if replace[i] != '$' || i+1 == len(replace) {
+			b.WriteByte(replace[i])
+			continue
+		}
+		if replace[i+1] == '$' {
+			b.WriteString("$$")
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(replace) && replace[j] >= '0' && replace[j] <= '9' {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString("${" + replace[i+1:j] + "}")
+		i = j - 1
+	}
+	return b.String()
+}
+
+// IsTemp reports whether name matches one of TempPatterns, ignoring case.
+func IsTemp(name string) bool {
+	return slices.ContainsFunc(TempPatterns, func(pattern string) bool {
+		ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(name))
+		return ok
+	})
+}
+
+// InTypeGroup reports whether the file at path belongs to group, by its
+// extension or, if sniff is set, by its detected content type.
+func InTypeGroup(path string, group TypeGroup, sniff bool) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if slices.Contains(group.Exts, ext) {
+		return true
+	}
+	if !sniff {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	contentType := http.DetectContentType(buf[:n])
+	for _, mime := range group.Mimes {
+		if strings.HasPrefix(contentType, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Swap swaps the parts of the name without its extension around the first
+// occurrence of sep. Names without sep are returned as they are.
+func Swap(name, sep string) string {
+	ext := filepath.Ext(name)
+	before, after, ok := strings.Cut(strings.TrimSuffix(name, ext), sep)
+	if !ok {
+		return name
+	}
+	return after + sep + before + ext
+}
+
+// ReverseStem reverses the characters of the name without its extension.
+func ReverseStem(name string) string {
+	ext := filepath.Ext(name)
+	runes := []rune(strings.TrimSuffix(name, ext))
+	slices.Reverse(runes)
+	return string(runes) + ext
+}
+
+// AddAffixes adds prefix to the start of name, and suffix to the end of it
+// before the extension, unless they are there already.
+func AddAffixes(name, prefix, suffix string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if !strings.HasPrefix(stem, prefix) {
+		stem = prefix + stem
+	}
+	if !strings.HasSuffix(stem, suffix) {
+		stem += suffix
+	}
+	return stem + ext
+}
+
+// Redact replaces every match of pattern in name with as many X characters as
+// the match has, so the masked names keep their alignment.
+func Redact(name string, pattern *regexp.Regexp) string {
+	return pattern.ReplaceAllStringFunc(name, func(match string) string {
+		return strings.Repeat("X", utf8.RuneCountInString(match))
+	})
+}
+
+// EnforceAllowedChars validates every character of name against allowed. The
+// returned bool is false when the file should be skipped. An empty fallback
+// is FALLBACK_REPLACE, and unknown ones are an error.
+func EnforceAllowedChars(name string, allowed *regexp.Regexp, fallback string,
+) (string, bool, error) {
+	switch fallback {
+	case "", FALLBACK_REPLACE, FALLBACK_FAIL, FALLBACK_SKIP:
+	default:
+		return "", false, fmt.Errorf("unknown allow-chars fallback: %q", fallback)
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if allowed.MatchString(string(r)) {
+			b.WriteRune(r)
+			continue
+		}
+		switch fallback {
+		case FALLBACK_FAIL:
+			return "", false, fmt.Errorf("%w: %q contains disallowed character %q", ErrInvalidName, name, r)
+		case FALLBACK_SKIP:
+			return "", false, nil
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String(), true, nil
+}
@@ -0,0 +1,964 @@
+package omitter
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// createTempFile is a helper to create a temporary file with the given content.
+func createTempFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create file %s: %v", path, err)
+	}
+	return path
+}
+
+// TestWalkerWithoutRegex verifies that NewPlan returns a proper mapping when regex is disabled.
+func TestWalkerWithoutRegex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create files.
+	file1 := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	file2 := createTempFile(t, tempDir, "example.txt", "dummy")
+
+	// Create options
+	opts := Options{Path: tempDir, Str: "target"}
+
+	// Plan with regex disabled (pattern is nil) and str "target".
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	pairs := plan.Pairs
+	// file1 should be processed because it contains "target".
+	if _, ok := pairs[file1]; !ok {
+		t.Errorf("expected file %s to be in pairs", file1)
+	}
+	// file2 should not be processed.
+	if _, ok := pairs[file2]; ok {
+		t.Errorf("did not expect file %s in pairs", file2)
+	}
+}
+
+// TestWalkerWithRegex verifies that NewPlan correctly uses a regex pattern.
+func TestWalkerWithRegex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create files.
+	file1 := createTempFile(t, tempDir, "example_target.txt", "dummy")
+	file2 := createTempFile(t, tempDir, "example.txt", "dummy")
+
+	// Compile regex pattern to match "_target" in the file name.
+	pattern, err := regexp.Compile("(_target)")
+	if err != nil {
+		t.Fatalf("failed to compile regex: %v", err)
+	}
+
+	// Create options
+	opts := Options{Path: tempDir, Str: "(_target)", Pattern: pattern}
+
+	// Here Str is still passed,
+	// but the searchString function uses the regex if provided.
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	pairs := plan.Pairs
+
+	// file1 should be processed because it matches the regex.
+	if _, ok := pairs[file1]; !ok {
+		t.Errorf("expected file %s to be in pairs", file1)
+	}
+	// file2 should not be processed.
+	if _, ok := pairs[file2]; ok {
+		t.Errorf("did not expect file %s in pairs", file2)
+	}
+
+	// Verify that the new file name is as expected.
+	expectedNewName := "example.txt" // "example_target.txt" with "_target" removed.
+	newPath, ok := pairs[file1]
+	if !ok {
+		t.Fatalf("file %s not found in pairs", file1)
+	}
+	if filepath.Base(newPath) != expectedNewName {
+		t.Errorf("expected new file name %q, got %q", expectedNewName, filepath.Base(newPath))
+	}
+}
+
+// TestWalkerWithRegex verifies that NewPlan correctly filters files type.
+func TestWalkerWitFileType(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create files.
+	file1 := createTempFile(t, tempDir, "file1.txt", "dummy")
+	file2 := createTempFile(t, tempDir, "file1.json", "dummy")
+	file3 := createTempFile(t, tempDir, "file2.json", "dummy")
+	file4 := createTempFile(t, tempDir, "nothing.json", "dummy")
+
+	// Create options
+	opts := Options{Path: tempDir, Str: "ile", FileType: ".json"}
+
+	// Plan with regex disabled (pattern is nil) and str "ile".
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	pairs := plan.Pairs
+	// file1 should not be processed because it contains ".txt" instead of ".json".
+	if _, ok := pairs[file1]; ok {
+		t.Errorf("did not expect file %s in pairs", file1)
+	}
+	// file2 should be processed.because it contains "ile" in file name and ".json" in file extension
+	if _, ok := pairs[file2]; !ok {
+		t.Errorf("expected file %s to be in pairs", file2)
+	}
+	// file3 should be processed.because it contains "ile" in file name and ".json" in file extension
+	if _, ok := pairs[file3]; !ok {
+		t.Errorf("expected file %s to be in pairs", file3)
+	}
+	// file4 should not be processed.
+	if _, ok := pairs[file4]; ok {
+		t.Errorf("did not expect file %s in pairs", file4)
+	}
+}
+
+// TestWalkerWithRegex verifies that resolveConflict correctly works when two files with the same name exist after changes are made.
+func TestCollisionResolution(t *testing.T) {
+	// Create a temporary directory.
+	tempDir, err := os.MkdirTemp("", "collision_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create two files that will produce the same new name when processed.
+	// Using regex "d.*d" on these file names:
+	// "aaa.json"   -> pattern "aaa" replaced by "bbb" produces "bbb.json"
+	// "aaaaaaa.json" -> pattern "aaaaaaa" replaced by "bbb" also produces "bbb.json"
+	_ = createTempFile(t, tempDir, "aaa.json", "dummy")
+	_ = createTempFile(t, tempDir, "aaaaaaa.json", "dummy")
+
+	// Compile the regex pattern to match the entire part from first a to last a.
+	pattern, err := regexp.Compile("a.*a")
+	if err != nil {
+		t.Fatalf("failed to compile regex: %v", err)
+	}
+
+	// Set up options with regex mode enabled.
+	opts := Options{
+		Path:    tempDir,
+		Str:     "a.*a",
+		Pattern: pattern,
+		Replace: "bbb", // Replacement string.
+	}
+
+	// Plan the mapping of old paths to new paths.
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	pairs := plan.Pairs
+
+	// We expect both files to be processed.
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 files to be processed, got %d", len(pairs))
+	}
+
+	// Collect the new file names.
+	newNames := make(map[string]bool)
+	for _, newPath := range pairs {
+		newNames[filepath.Base(newPath)] = true
+	}
+
+	// We expect one file to become "bbb.json" and the other to become "bbb.json".
+	if !newNames["bbb.json"] {
+		t.Errorf("expected 'bbb.json' in new names, got %v", newNames)
+	}
+	if !newNames["bbb_1.json"] {
+		t.Errorf("expected 'bbb_1.json' in new names, got %v", newNames)
+	}
+}
+
+// TestCollisionResolutionTimestamp verifies that a timestamp suffix tells the
+// conflicting file apart by the run time.
+func TestCollisionResolutionTimestamp(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "collision_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	_ = createTempFile(t, tempDir, "aaa.json", "dummy")
+	_ = createTempFile(t, tempDir, "aaaaaaa.json", "dummy")
+
+	opts := Options{
+		Path:    tempDir,
+		Str:     "a.*a",
+		Pattern: regexp.MustCompile("a.*a"),
+		Replace: "bbb",
+		ConflictSuffix: ConflictSuffix{
+			Format: SUFFIX_TIMESTAMP, Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+	}
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	newNames := make(map[string]bool)
+	for _, newPath := range plan.Pairs {
+		newNames[filepath.Base(newPath)] = true
+	}
+	if !newNames["bbb.json"] || !newNames["bbb_20240102T150405.json"] {
+		t.Errorf("expected 'bbb.json' and 'bbb_20240102T150405.json' in new names, got %v", newNames)
+	}
+}
+
+// TestCaptureGroupReplace verifies that regex replacements can refer to numbered and named groups.
+func TestCaptureGroupReplace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTempFile(t, tempDir, "report_2024-05.pdf", "dummy")
+	cases := []struct {
+		str, replace, expected string
+	}{
+		{`(\d{4})-(\d{2})`, "$2_$1", "report_05_2024.pdf"},
+		{`(?P<year>\d{4})-(?P<month>\d{2})`, "${month}-${year}", "report_05-2024.pdf"},
+		{`\d`, "#", "report_####-##.pdf"},
+		{`(\d{4})`, "$$1", "report_$1-05.pdf"},
+	}
+	for _, c := range cases {
+		plan, err := NewPlan(Options{
+			Path: tempDir, Str: c.str, Pattern: regexp.MustCompile(c.str), Replace: c.replace,
+		})
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		if got := filepath.Base(plan.Pairs[file]); got != c.expected {
+			t.Errorf("%q -> %q: expected %q, got %q", c.str, c.replace, c.expected, got)
+		}
+	}
+}
+
+// TestRemapCaptures verifies that captured values are replaced through the
+// remap table, and unmapped ones are kept.
+func TestRemapCaptures(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file1 := createTempFile(t, tempDir, "ACME-001_ACME-002.pdf", "dummy")
+	file2 := createTempFile(t, tempDir, "INIT-003.pdf", "dummy")
+	file3 := createTempFile(t, tempDir, "OLD-004.pdf", "dummy")
+	opts := Options{Path: tempDir, Str: `([A-Z]+)-\d+`, Pattern: regexp.MustCompile(`([A-Z]+)-\d+`)}
+
+	values, err := CaptureValues(opts, 1)
+	if err != nil {
+		t.Fatalf("capture values error: %v", err)
+	}
+	if !slices.Equal(values, []string{"ACME", "INIT", "OLD"}) {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	opts.Remap = map[string]string{"ACME": "ACM", "INIT": "INITECH"}
+	opts.RemapGroup = 1
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if filepath.Base(plan.Pairs[file1]) != "ACM-001_ACM-002.pdf" ||
+		filepath.Base(plan.Pairs[file2]) != "INITECH-003.pdf" {
+		t.Errorf("unexpected pairs: %v", plan.Pairs)
+	}
+	if _, ok := plan.Pairs[file3]; ok {
+		t.Errorf("expected %s to be kept", file3)
+	}
+}
+
+// TestDictReplace verifies that dict tokens are replaced longest first, in a
+// single pass.
+func TestDictReplace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file1 := createTempFile(t, tempDir, "SKU12_SKU123.jpg", "dummy")
+	file2 := createTempFile(t, tempDir, "other.jpg", "dummy")
+	plan, err := NewPlan(Options{Path: tempDir, Dict: map[string]string{
+		"SKU12":  "SKU123",
+		"SKU123": "chair",
+	}})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if filepath.Base(plan.Pairs[file1]) != "SKU123_chair.jpg" {
+		t.Errorf("unexpected pairs: %v", plan.Pairs)
+	}
+	if _, ok := plan.Pairs[file2]; ok {
+		t.Errorf("expected %s to be skipped", file2)
+	}
+}
+
+// TestSearchString verifies the behavior of searchString.
+func TestSearchString(t *testing.T) {
+	// When pattern is nil, it should simply return the str parameter.
+	result := searchString(nil, "target", "example_target.txt")
+	if result != "target" {
+		t.Errorf("expected 'target', got '%s'", result)
+	}
+
+	// With regex pattern provided.
+	pattern, err := regexp.Compile("target")
+	if err != nil {
+		t.Fatalf("failed to compile regex: %v", err)
+	}
+	result = searchString(pattern, "target", "example_target.txt")
+	if result != "target" {
+		t.Errorf("expected 'target', got '%s'", result)
+	}
+
+	// Test with a non-matching pattern.
+	pattern, err = regexp.Compile("nomatch")
+	if err != nil {
+		t.Fatalf("failed to compile regex: %v", err)
+	}
+	result = searchString(pattern, "nomatch", "example_target.txt")
+	if result != "" {
+		t.Errorf("expected empty string, got '%s'", result)
+	}
+}
+
+// TestEnforceAllowedChars verifies every fallback of the allowed characters check.
+func TestEnforceAllowedChars(t *testing.T) {
+	allowed := regexp.MustCompile("^(?:[A-Za-z0-9._-])$")
+
+	name, ok, err := EnforceAllowedChars("my file#1.txt", allowed, FALLBACK_REPLACE)
+	if err != nil || !ok {
+		t.Fatalf("expected replace to succeed, got ok=%v err=%v", ok, err)
+	}
+	if name != "my_file_1.txt" {
+		t.Errorf("expected %q, got %q", "my_file_1.txt", name)
+	}
+
+	if _, ok, err = EnforceAllowedChars("my file.txt", allowed, FALLBACK_SKIP); ok || err != nil {
+		t.Errorf("expected skip, got ok=%v err=%v", ok, err)
+	}
+
+	if _, _, err = EnforceAllowedChars("my file.txt", allowed, FALLBACK_FAIL); err == nil {
+		t.Error("expected an error for disallowed character")
+	}
+
+	name, ok, err = EnforceAllowedChars("clean.txt", allowed, FALLBACK_FAIL)
+	if err != nil || !ok || name != "clean.txt" {
+		t.Errorf("expected clean name to pass, got %q ok=%v err=%v", name, ok, err)
+	}
+
+	if _, _, err = EnforceAllowedChars("clean.txt", allowed, "rename"); err == nil {
+		t.Error("expected an error for an unknown fallback")
+	}
+}
+
+// TestPlanAllowedCharsMatchedOnly verifies that allowed characters are only
+// enforced on the files searched for.
+func TestPlanAllowedCharsMatchedOnly(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testallowed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	a := createTempFile(t, tempDir, "a-draft.txt", "dummy")
+	createTempFile(t, tempDir, "b#1.txt", "dummy")
+
+	plan, err := NewPlan(Options{
+		Path:          tempDir,
+		Str:           "draft",
+		Replace:       "final",
+		AllowedChars:  regexp.MustCompile("^(?:[A-Za-z0-9._-])$"),
+		AllowFallback: FALLBACK_FAIL,
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{a: filepath.Join(tempDir, "a-final.txt")}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	if plan.Pairs[a] != want[a] {
+		t.Errorf("expected %s to be renamed to %s, got %q", a, want[a], plan.Pairs[a])
+	}
+}
+
+// TestRedact verifies that matches are masked with the same number of characters.
+func TestRedact(t *testing.T) {
+	pattern := regexp.MustCompile(`\d{4}`)
+	result := Redact("card_1234_é5678.txt", pattern)
+	if result != "card_XXXX_éXXXX.txt" {
+		t.Errorf("expected %q, got %q", "card_XXXX_éXXXX.txt", result)
+	}
+
+	pattern = regexp.MustCompile(`é+`)
+	result = Redact("caféé.txt", pattern)
+	if result != "cafXX.txt" {
+		t.Errorf("expected %q, got %q", "cafXX.txt", result)
+	}
+}
+
+// TestSwap verifies that the parts around the first separator are swapped.
+func TestSwap(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Doe_John.pdf":    "John_Doe.pdf",
+		"Doe_John_CV.pdf": "John_CV_Doe.pdf",
+		"Doe.pdf":         "Doe.pdf",
+		"Doe_.pdf":        "_Doe.pdf",
+	} {
+		if result := Swap(name, "_"); result != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, result)
+		}
+	}
+}
+
+// TestReverseStem verifies that names are reversed by character, extension
+// aside.
+func TestReverseStem(t *testing.T) {
+	for name, expected := range map[string]string{
+		"abc.txt":  "cba.txt",
+		"café.txt": "éfac.txt",
+		"noext":    "txeon",
+	} {
+		if result := ReverseStem(name); result != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, result)
+		}
+	}
+}
+
+// TestWalkerProjectedConflicts verifies that names freed by renames in the same run are not conflicts.
+func TestWalkerProjectedConflicts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// "a.md" -> "aa.md" while "aa.md" -> "aaaa.md".
+	file1 := createTempFile(t, tempDir, "a.md", "first")
+	file2 := createTempFile(t, tempDir, "aa.md", "second")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "a", Replace: "aa"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	pairs := plan.Pairs
+	if pairs[file1] != file2 {
+		t.Errorf("expected %s to be renamed to %s, got %q", file1, file2, pairs[file1])
+	}
+	if filepath.Base(pairs[file2]) != "aaaa.md" {
+		t.Errorf("expected %s to be renamed to aaaa.md, got %q", file2, pairs[file2])
+	}
+
+	// The chain must be applied without clobbering any file.
+	if _, err = Rename(pairs, ExecOptions{}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(tempDir, "aaaa.md"))
+	if err != nil || string(b) != "second" {
+		t.Errorf("expected aaaa.md to hold %q, got %q (%v)", "second", b, err)
+	}
+	b, err = os.ReadFile(file2)
+	if err != nil || string(b) != "first" {
+		t.Errorf("expected aa.md to hold %q, got %q (%v)", "first", b, err)
+	}
+}
+
+// TestWalkerSkippedStay verifies that the names of skipped files are not
+// freed for other files of the run.
+func TestWalkerSkippedStay(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// "ax.txt" -> "ay.txt" while "ay.txt" -> "ay.tyt", which is taken.
+	createTempFile(t, tempDir, "ax.txt", "A")
+	file2 := createTempFile(t, tempDir, "ay.txt", "B")
+	createTempFile(t, tempDir, "ay.tyt", "C")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "x", Replace: "y", Count: 1, OnConflict: CONFLICT_SKIP})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 0 {
+		t.Errorf("expected every file to be skipped, got %v", plan.Pairs)
+	}
+	if _, err = Rename(plan.Pairs, ExecOptions{}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	b, err := os.ReadFile(file2)
+	if err != nil || string(b) != "B" {
+		t.Errorf("expected ay.txt to hold %q, got %q (%v)", "B", b, err)
+	}
+}
+
+// TestPlanFiles verifies that only the given files are planned, and that
+// the other files of the tree keep their names.
+func TestPlanFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	existing := createTempFile(t, tempDir, "f2_1.txt", "E")
+	file := createTempFile(t, tempDir, "f1_1.txt", "N")
+	createTempFile(t, tempDir, "f1_2.txt", "other")
+
+	plan, err := PlanFiles(Options{Path: tempDir, Str: "1", Replace: "2", Count: 1},
+		[]string{file, filepath.Join(tempDir, "gone.txt")})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{file: filepath.Join(tempDir, "f2_1_1.txt")}
+	if len(plan.Pairs) != len(want) || plan.Pairs[file] != want[file] {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	if _, err = Rename(plan.Pairs, ExecOptions{}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	b, err := os.ReadFile(existing)
+	if err != nil || string(b) != "E" {
+		t.Errorf("expected f2_1.txt to hold %q, got %q (%v)", "E", b, err)
+	}
+}
+
+// TestWalkerIgnoresGlobs verifies that files named after an ignored entry,
+// or matching it as a glob, are not scanned.
+func TestWalkerIgnoresGlobs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	a := createTempFile(t, tempDir, "a_target.txt", "dummy")
+	createTempFile(t, tempDir, "a_target.txt.orig", "{}")
+	createTempFile(t, tempDir, ".target-journal.json", "{}")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "target"}, ".target-journal.json", "*.orig")
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{a: filepath.Join(tempDir, "a_.txt")}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	if plan.Pairs[a] != want[a] {
+		t.Errorf("expected %s to be renamed to %s, got %q", a, want[a], plan.Pairs[a])
+	}
+}
+
+// TestWalkerCollapsedNames verifies that plain removals which bring two
+// names together never give them the same new path, and that both files
+// survive the run.
+func TestWalkerCollapsedNames(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	x := createTempFile(t, tempDir, "a_x.txt", "x")
+	y := createTempFile(t, tempDir, "a_y.txt", "y")
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_[xy]", Pattern: regexp.MustCompile("_[xy]")})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 2 || plan.Pairs[x] == plan.Pairs[y] {
+		t.Fatalf("expected two distinct new paths, got %v", plan.Pairs)
+	}
+	if plan.Pairs[x] != filepath.Join(tempDir, "a.txt") || plan.Pairs[y] != filepath.Join(tempDir, "a_1.txt") {
+		t.Errorf("expected a.txt and a_1.txt, got %v", plan.Pairs)
+	}
+	if _, err = Rename(plan.Pairs, ExecOptions{}); err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	for name, want := range map[string]string{"a.txt": "x", "a_1.txt": "y"} {
+		if b, err := os.ReadFile(filepath.Join(tempDir, name)); err != nil || string(b) != want {
+			t.Errorf("expected %s to hold %q, got %q (%v)", name, want, b, err)
+		}
+	}
+}
+
+// TestInTypeGroup verifies matching category shorthands by extension and by content.
+func TestInTypeGroup(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtype")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	photo := createTempFile(t, tempDir, "photo.JPG", "dummy")
+	noExt := createTempFile(t, tempDir, "scan", "\x89PNG\r\n\x1a\n0000")
+	text := createTempFile(t, tempDir, "notes.txt", "dummy")
+
+	if !InTypeGroup(photo, TypeGroups["images"], false) {
+		t.Errorf("expected %s to be an image", photo)
+	}
+	if InTypeGroup(text, TypeGroups["images"], true) {
+		t.Errorf("did not expect %s to be an image", text)
+	}
+	if InTypeGroup(noExt, TypeGroups["images"], false) {
+		t.Errorf("did not expect %s to be an image without sniffing", noExt)
+	}
+	if !InTypeGroup(noExt, TypeGroups["images"], true) {
+		t.Errorf("expected %s to be sniffed as an image", noExt)
+	}
+}
+
+// TestWalkerTransformWorkers verifies that the result does not depend on the number of transform workers.
+func TestWalkerTransformWorkers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testwalker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, name := range []string{"a1.txt", "a11.txt", "a111.txt", "b1.txt", "c.txt"} {
+		createTempFile(t, tempDir, name, "dummy")
+	}
+	pattern := regexp.MustCompile(`\d+`)
+
+	var expected map[string]string
+	for _, workers := range []int{1, 3, 0} {
+		plan, err := NewPlan(Options{
+			Path: tempDir, Str: `\d+`, Pattern: pattern, Replace: "9", Workers: workers,
+		})
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		pairs := plan.Pairs
+		if len(pairs) != 4 {
+			t.Fatalf("expected 4 files to be processed, got %v", pairs)
+		}
+		if expected == nil {
+			expected = pairs
+			continue
+		}
+		for k, v := range expected {
+			if pairs[k] != v {
+				t.Errorf("workers=%d: expected %s -> %s, got %q", workers, k, v, pairs[k])
+			}
+		}
+	}
+}
+
+// TestPlanSkipReasons verifies the reasons of skipped files.
+func TestPlanSkipReasons(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testskip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	matched := createTempFile(t, tempDir, "a_target.txt", "dummy")
+	noMatch := createTempFile(t, tempDir, "b.txt", "dummy")
+	filtered := createTempFile(t, tempDir, "c_target.json", "dummy")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_target", FileType: ".txt"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if _, ok := plan.Pairs[matched]; !ok {
+		t.Errorf("expected file %s to be in pairs", matched)
+	}
+
+	reasons := make(map[string]string)
+	for _, s := range plan.Skipped {
+		reasons[s.Path] = s.Reason
+	}
+	if reasons[noMatch] != SKIP_NO_MATCH {
+		t.Errorf("expected %s to be skipped as %q, got %q", noMatch, SKIP_NO_MATCH, reasons[noMatch])
+	}
+	if reasons[filtered] != SKIP_EXT_FILTERED {
+		t.Errorf("expected %s to be skipped as %q, got %q", filtered, SKIP_EXT_FILTERED, reasons[filtered])
+	}
+	if _, ok := reasons[matched]; ok {
+		t.Errorf("did not expect %s to be skipped", matched)
+	}
+}
+
+// TestConflictSuffix verifies the formats and placements of conflict suffixes.
+func TestConflictSuffix(t *testing.T) {
+	runTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		suffix   ConflictSuffix
+		expected string
+	}{
+		{ConflictSuffix{}, "bbb_2.json"},
+		{ConflictSuffix{Format: " (copy %d)"}, "bbb (copy 2).json"},
+		{ConflictSuffix{Format: "-%02d"}, "bbb-02.json"},
+		{ConflictSuffix{Format: ".%d", AfterExt: true}, "bbb.json.2"},
+		{ConflictSuffix{Format: SUFFIX_TIMESTAMP, Time: runTime}, "bbb_20240102T150405_2.json"},
+	}
+	for _, c := range cases {
+		if got := c.suffix.Apply("bbb.json", 2); got != c.expected {
+			t.Errorf("%+v: expected %q, got %q", c.suffix, c.expected, got)
+		}
+	}
+
+	for format, valid := range map[string]bool{
+		"_%d": true, "-%02d": true, SUFFIX_TIMESTAMP: true, "_copy": false, "%d_%d": false, "/%d": false,
+	} {
+		if ValidSuffixFormat(format) != valid {
+			t.Errorf("%q: expected valid=%v", format, valid)
+		}
+	}
+}
+
+// TestSelect verifies that Select returns the files passing the filters and
+// containing a match, without renaming them.
+func TestSelect(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testselect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	matched := createTempFile(t, tempDir, "a_target.txt", "dummy")
+	noMatch := createTempFile(t, tempDir, "b.txt", "dummy")
+	filtered := createTempFile(t, tempDir, "c_target.json", "dummy")
+
+	paths, skipped, err := Select(Options{Path: tempDir, Str: "_target", FileType: ".txt"})
+	if err != nil {
+		t.Fatalf("select error: %v", err)
+	}
+	if !slices.Equal(paths, []string{matched}) {
+		t.Errorf("expected [%s], got %v", matched, paths)
+	}
+	want := []SkippedFile{{noMatch, SKIP_NO_MATCH}, {filtered, SKIP_EXT_FILTERED}}
+	if !slices.Equal(skipped, want) {
+		t.Errorf("expected %v skipped, got %v", want, skipped)
+	}
+
+	paths, _, err = Select(Options{Path: tempDir})
+	if err != nil {
+		t.Fatalf("select error: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Errorf("expected every file without filters, got %v", paths)
+	}
+	if _, err = os.Stat(matched); err != nil {
+		t.Errorf("expected %s to keep its name: %v", matched, err)
+	}
+}
+
+// TestWalkerCounterparts verifies that taken names are kept with Counterparts.
+func TestWalkerCounterparts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testcounterparts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	original := createTempFile(t, tempDir, "a.jpg", "dummy")
+	derivative := createTempFile(t, tempDir, "a_small.jpg", "dummy")
+
+	opts := Options{Path: tempDir, Str: "_small.jpg", Replace: ".jpg", Counterparts: true}
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if plan.Pairs[derivative] != original {
+		t.Errorf("expected %s to be paired with %s, got %v", derivative, original, plan.Pairs)
+	}
+
+	opts.Counterparts = false
+	plan, err = NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if plan.Pairs[derivative] == original {
+		t.Errorf("expected the conflict with %s to be resolved", original)
+	}
+}
+
+// TestWalkerMaxDepth verifies that files deeper than MaxDepth are not walked.
+func TestWalkerMaxDepth(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testdepth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sub := filepath.Join(tempDir, "sub")
+	if err = os.MkdirAll(filepath.Join(sub, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	top := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	mid := createTempFile(t, sub, "b_x.txt", "dummy")
+	createTempFile(t, filepath.Join(sub, "nested"), "c_x.txt", "dummy")
+
+	for depth, want := range map[int][]string{1: {top}, 2: {top, mid}} {
+		plan, err := NewPlan(Options{Path: tempDir, Str: "_x", MaxDepth: depth})
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		got := slices.Sorted(maps.Keys(plan.Pairs))
+		if !slices.Equal(got, want) {
+			t.Errorf("depth %d: expected %v, got %v", depth, want, got)
+		}
+	}
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_x"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 3 {
+		t.Errorf("expected every file without a max depth, got %v", plan.Pairs)
+	}
+}
+
+// TestOnConflict verifies every conflict policy, and that AskConflict is
+// asked instead when set.
+func TestOnConflict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testconflict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	taken := createTempFile(t, tempDir, "a_y.txt", "dummy")
+
+	tests := []struct {
+		policy string
+		want   string
+		reason string
+	}{
+		{CONFLICT_SUFFIX, filepath.Join(tempDir, "a_y_1.txt"), ""},
+		{CONFLICT_SKIP, "", SKIP_CONFLICT},
+		{CONFLICT_OVERWRITE, taken, ""},
+	}
+	for _, tc := range tests {
+		plan, err := NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", OnConflict: tc.policy})
+		if err != nil {
+			t.Fatalf("%s: plan error: %v", tc.policy, err)
+		}
+		if plan.Pairs[file] != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.policy, tc.want, plan.Pairs[file])
+		}
+		if tc.reason != "" && (len(plan.Skipped) == 0 || plan.Skipped[len(plan.Skipped)-1].Reason != tc.reason) {
+			t.Errorf("%s: expected %s to be skipped as %q, got %v", tc.policy, file, tc.reason, plan.Skipped)
+		}
+	}
+	if _, err = NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", OnConflict: CONFLICT_FAIL}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected %v, got %v", ErrConflict, err)
+	}
+
+	var asked []string
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", AskConflict: func(path, target string) string {
+		asked = append(asked, path, target)
+		return CONFLICT_SKIP
+	}})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if !slices.Equal(asked, []string{file, taken}) || len(plan.Pairs) != 0 {
+		t.Errorf("expected to be asked about %s only and skip it, got %v and %v", file, asked, plan.Pairs)
+	}
+}
+
+// TestAddAffixes verifies that prefixes and suffixes are added once, with
+// suffixes before the extension.
+func TestAddAffixes(t *testing.T) {
+	tests := []struct {
+		name, prefix, suffix, want string
+	}{
+		{"report.pdf", "2024_", "_final", "2024_report_final.pdf"},
+		{"2024_report_final.pdf", "2024_", "_final", "2024_report_final.pdf"},
+		{"report", "", "_final", "report_final"},
+		{"archive.tar.gz", "old_", "", "old_archive.tar.gz"},
+	}
+	for _, tc := range tests {
+		if got := AddAffixes(tc.name, tc.prefix, tc.suffix); got != tc.want {
+			t.Errorf("AddAffixes(%q, %q, %q) = %q, want %q", tc.name, tc.prefix, tc.suffix, got, tc.want)
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "testaffixes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	matched := createTempFile(t, tempDir, "report.pdf", "dummy")
+	other := createTempFile(t, tempDir, "notes.txt", "dummy")
+	plan, err := NewPlan(Options{Path: tempDir, Str: "report", Replace: "report", Prefix: "2024_"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if want := filepath.Join(tempDir, "2024_report.pdf"); plan.Pairs[matched] != want {
+		t.Errorf("expected %s, got %s", want, plan.Pairs[matched])
+	}
+	if _, ok := plan.Pairs[other]; ok {
+		t.Errorf("did not expect %s without a match in pairs", other)
+	}
+}
+
+// TestTempFiles verifies that transient files are skipped unless IncludeTemp
+// is set.
+func TestTempFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtemp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	var temps []string
+	for _, name := range []string{"b_x.iso.part", "c_x.CRDOWNLOAD", "d_x.tmp", "~$e_x.docx", ".DS_Store"} {
+		temps = append(temps, createTempFile(t, tempDir, name, "dummy"))
+	}
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 1 || plan.Pairs[file] == "" {
+		t.Errorf("expected only %s to be renamed, got %v", file, plan.Pairs)
+	}
+	for _, temp := range temps {
+		if !slices.Contains(plan.Skipped, SkippedFile{Path: temp, Reason: SKIP_TEMP}) {
+			t.Errorf("expected %s to be skipped as temp", temp)
+		}
+	}
+
+	plan, err = NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", IncludeTemp: true})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 5 {
+		t.Errorf("expected the temp files to be renamed too, got %v", plan.Pairs)
+	}
+}
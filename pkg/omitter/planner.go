@@ -0,0 +1,47 @@
+package omitter
+
+import "context"
+
+// Op is an operation of a plan: a file and its new path.
+type Op = Pair
+
+// Planner plans the renaming of the tree of Options, skipping the files
+// named after an entry of Ignore as NewPlan does.
+type Planner struct {
+	Options Options
+	Ignore  []string
+}
+
+// Plan builds the whole plan, as NewPlan does.
+func (p Planner) Plan() (Plan, error) {
+	return NewPlan(p.Options, p.Ignore...)
+}
+
+// Stream sends the operations of the plan as soon as their new name is
+// known, as Stream does, for callers which show results while the tree is
+// still walked. Once the walk is over, both channels are closed, the error
+// channel holding its error first, if any. Canceling ctx stops the walk with
+// the error of ctx, whether the operations are still received or not.
+func (p Planner) Stream(ctx context.Context) (<-chan Op, <-chan error) {
+	ops := make(chan Op)
+	errs := make(chan error, 1)
+	opts := p.Options
+	opts.Context = ctx
+	go func() {
+		defer close(errs)
+		defer close(ops)
+		for op, err := range Stream(opts, p.Ignore...) {
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case ops <- op:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return ops, errs
+}
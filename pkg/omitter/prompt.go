@@ -0,0 +1,100 @@
+package omitter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Prompter asks the user questions. It is injected, so embedders and tests
+// can answer them instead of a terminal.
+type Prompter interface {
+	// Ask shows question and returns the answer, without surrounding
+	// spaces. The error is set once there are no more answers.
+	Ask(question string) (string, error)
+}
+
+// LinePrompter asks its questions on an io.Writer, and reads every answer as
+// a line of an io.Reader.
+type LinePrompter struct {
+	r   *bufio.Reader
+	out io.Writer
+}
+
+// NewPrompter returns the Prompter asking on out and reading from in, such as
+// the standard output and input.
+func NewPrompter(in io.Reader, out io.Writer) *LinePrompter {
+	return &LinePrompter{r: bufio.NewReader(in), out: out}
+}
+
+func (p *LinePrompter) Ask(question string) (string, error) {
+	fmt.Fprint(p.out, question)
+	s, err := p.r.ReadString('\n')
+	return strings.TrimSpace(s), err
+}
+
+// Confirm asks p question, and reports whether it was answered with yes.
+func Confirm(p Prompter, question string) bool {
+	s, err := p.Ask(question)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// AskConflict returns the Options.AskConflict asking p about every conflict.
+// It fails once there are no more answers, or if p is nil.
+func AskConflict(p Prompter) func(path, target string) string {
+	return func(path, target string) string {
+		return askConflictPolicy(p, fmt.Sprintf(
+			"%s -> %s is already taken. [s]uffix, s[k]ip, [o]verwrite or [f]ail? ", path, target))
+	}
+}
+
+// AskConflictPerDir returns the Options.AskConflict asking p once per dir, on
+// its first conflict, what to do with all of them.
+func AskConflictPerDir(p Prompter) func(path, target string) string {
+	policies := make(map[string]string)
+	return func(path, target string) string {
+		dir := filepath.Dir(target)
+		if policy, ok := policies[dir]; ok {
+			return policy
+		}
+		policy := askConflictPolicy(p, fmt.Sprintf(
+			"%s has conflicts, such as %s -> %s. [s]uffix, s[k]ip or [o]verwrite all of them, or [f]ail? ",
+			dir, filepath.Base(path), filepath.Base(target)))
+		policies[dir] = policy
+		return policy
+	}
+}
+
+// askConflictPolicy asks question until it is answered with a conflict
+// policy. It fails once there are no more answers.
+func askConflictPolicy(p Prompter, question string) string {
+	if p == nil {
+		return CONFLICT_FAIL
+	}
+	for {
+		s, err := p.Ask(question)
+		switch strings.ToLower(s) {
+		case "s", "suffix":
+			return CONFLICT_SUFFIX
+		case "k", "skip":
+			return CONFLICT_SKIP
+		case "o", "overwrite":
+			return CONFLICT_OVERWRITE
+		case "f", "fail":
+			return CONFLICT_FAIL
+		}
+		if err != nil {
+			return CONFLICT_FAIL
+		}
+	}
+}
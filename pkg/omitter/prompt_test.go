@@ -0,0 +1,117 @@
+package omitter
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfirm verifies that only yes answers confirm, and that running out of
+// answers does not.
+func TestConfirm(t *testing.T) {
+	var out strings.Builder
+	p := NewPrompter(strings.NewReader("y\nYes\nn\nmaybe\n"), &out)
+	for _, want := range []bool{true, true, false, false, false} {
+		if got := Confirm(p, "Proceed? "); got != want {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+	if n := strings.Count(out.String(), "Proceed? "); n != 5 {
+		t.Errorf("expected 5 questions, got %d", n)
+	}
+}
+
+// TestAskConflict verifies the answers about conflicts, and that running out
+// of them fails.
+func TestAskConflict(t *testing.T) {
+	ask := AskConflict(NewPrompter(strings.NewReader("k\nwhat\no\n"), io.Discard))
+	for _, want := range []string{CONFLICT_SKIP, CONFLICT_OVERWRITE, CONFLICT_FAIL} {
+		if got := ask("a_x.txt", "a.txt"); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+	if got := AskConflict(nil)("a_x.txt", "a.txt"); got != CONFLICT_FAIL {
+		t.Errorf("expected %s without a prompter, got %s", CONFLICT_FAIL, got)
+	}
+}
+
+// TestAskConflictPerDir verifies that conflicts are asked about once per dir.
+func TestAskConflictPerDir(t *testing.T) {
+	var out strings.Builder
+	ask := AskConflictPerDir(NewPrompter(strings.NewReader("k\no\n"), &out))
+	tests := []struct {
+		path, target, want string
+	}{
+		{"a/x_1.txt", "a/x.txt", CONFLICT_SKIP},
+		{"b/y_1.txt", "b/y.txt", CONFLICT_OVERWRITE},
+		{"a/z_1.txt", "a/z.txt", CONFLICT_SKIP},
+	}
+	for _, tc := range tests {
+		if got := ask(filepath.FromSlash(tc.path), filepath.FromSlash(tc.target)); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.want, got)
+		}
+	}
+	if n := strings.Count(out.String(), "has conflicts"); n != 2 {
+		t.Errorf("expected 2 questions, got %d", n)
+	}
+}
+
+// TestPlanPrompter verifies that the prompting conflict policies ask the
+// injected Prompter, and that conflicts fail without one.
+func TestPlanPrompter(t *testing.T) {
+	tempDir := t.TempDir()
+	a := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	createTempFile(t, tempDir, "a_y.txt", "dummy")
+	b := createTempFile(t, tempDir, "b_x.txt", "dummy")
+	createTempFile(t, tempDir, "b_y.txt", "dummy")
+
+	var out strings.Builder
+	plan, err := NewPlan(Options{
+		Path: tempDir, Str: "_x", Replace: "_y", OnConflict: CONFLICT_ASK_PER_DIR,
+		Prompter: NewPrompter(strings.NewReader("s\n"), &out),
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{
+		a: filepath.Join(tempDir, "a_y_1.txt"),
+		b: filepath.Join(tempDir, "b_y_1.txt"),
+	}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	for oldPath, newPath := range want {
+		if plan.Pairs[oldPath] != newPath {
+			t.Errorf("expected %s to be renamed to %s, got %q", oldPath, newPath, plan.Pairs[oldPath])
+		}
+	}
+	if n := strings.Count(out.String(), "has conflicts"); n != 1 {
+		t.Errorf("expected 1 question, got %d", n)
+	}
+
+	if _, err = NewPlan(Options{Path: tempDir, Str: "_x", Replace: "_y", OnConflict: CONFLICT_PROMPT}); err == nil {
+		t.Error("expected conflicts to fail without a prompter")
+	}
+}
+
+// TestPlanClock verifies that timestamp suffixes tell the time of the
+// injected clock.
+func TestPlanClock(t *testing.T) {
+	tempDir := t.TempDir()
+	a := createTempFile(t, tempDir, "a_x.txt", "dummy")
+	createTempFile(t, tempDir, "a_y.txt", "dummy")
+
+	c := &fakeClock{now: time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)}
+	plan, err := NewPlan(Options{
+		Path: tempDir, Str: "_x", Replace: "_y",
+		ConflictSuffix: ConflictSuffix{Format: SUFFIX_TIMESTAMP}, Clock: c,
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if want := filepath.Join(tempDir, "a_y_20240102T150405.txt"); plan.Pairs[a] != want {
+		t.Errorf("expected %s to be renamed to %s, got %q", a, want, plan.Pairs[a])
+	}
+}
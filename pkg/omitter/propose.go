@@ -0,0 +1,109 @@
+package omitter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Proposal is the proposed new name of a name given to ProposeNames.
+type Proposal struct {
+	Name string `json:"name"`
+	// New is empty if the name is skipped, for Reason.
+	New    string `json:"new,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ProposeNames plans the new names of names as NewPlan would for a tree
+// holding just these files, without any file system access, for callers
+// which keep their files elsewhere. Names are slash separated paths relative
+// to the root of the tree, Path if set, and new names are of the same form,
+// or relative to Output if set. Proposals are in the order of names, which
+// conflicts are resolved in. Options which need the files themselves are
+// refused: Sniff, templates with dates or tags, and numbering by mtime.
+func ProposeNames(names []string, opts Options) ([]Proposal, error) {
+	switch {
+	case opts.Sniff:
+		return nil, errors.New("sniffing needs the content of files")
+	case opts.Template != nil && (opts.Template.usesDates() || opts.Template.usesTags()):
+		return nil, errors.New("template dates and tags need the files")
+	case opts.Number != nil && opts.Number.Sort == NUMBER_SORT_MTIME:
+		return nil, errors.New("numbering by mtime needs the files")
+	}
+	// Anchors above the root would need the file system, so only dirs
+	// within names count.
+	anchor := opts.AnchorDir
+	opts.AnchorDir = ""
+	opts = opts.prepared()
+	opts.AnchorDir = anchor
+
+	paths := make([]string, len(names))
+	opts.names = make(map[string]bool, len(names))
+	for i, name := range names {
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+		paths[i] = filepath.Join(opts.Path, filepath.FromSlash(name))
+		if opts.names[paths[i]] {
+			return nil, fmt.Errorf("duplicate name %q", name)
+		}
+		opts.names[paths[i]] = true
+	}
+
+	reasons := make(map[string]string, len(names))
+	var candidates []candidate
+	for i, path := range paths {
+		reason := opts.walkReason(names[i])
+		if reason == "" {
+			var c *candidate
+			var err error
+			if c, reason, err = transform(opts, path, nil); err != nil {
+				return nil, err
+			}
+			if c != nil {
+				candidates = append(candidates, *c)
+				continue
+			}
+		}
+		reasons[path] = reason
+	}
+	pairs, skipped, err := opts.resolve(candidates)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range skipped {
+		reasons[s.Path] = s.Reason
+	}
+
+	proposals := make([]Proposal, len(names))
+	for i, path := range paths {
+		proposals[i] = Proposal{Name: names[i], Reason: reasons[path]}
+		newPath, ok := pairs[path]
+		switch {
+		case !ok:
+		case opts.Output != "":
+			proposals[i].New = filepath.Base(newPath)
+		default:
+			proposals[i].New = opts.relPath(newPath)
+		}
+	}
+	return proposals, nil
+}
+
+// walkReason returns the reason the file of name would not be reached by
+// walking the tree of opts, or an empty string if it would be.
+func (opts Options) walkReason(name string) string {
+	elems := strings.Split(name, "/")
+	if opts.MaxDepth > 0 && len(elems) > opts.MaxDepth {
+		return SKIP_TOO_DEEP
+	}
+	for i := 1; i < len(elems); i++ {
+		dir := filepath.Join(opts.Path, filepath.FromSlash(strings.Join(elems[:i], "/")))
+		if opts.excludedDir(dir) {
+			return SKIP_GLOB_FILTERED
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package omitter
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestProposeNames verifies that names are planned, skipped and told apart
+// among themselves, with no files behind them.
+func TestProposeNames(t *testing.T) {
+	names := []string{"docs/report_draft.txt", "docs/report.txt", "notes.txt", "vendor/lib_draft.go", "a/b/c/deep_draft.txt"}
+	got, err := ProposeNames(names, Options{
+		Path:     "/nonexistent",
+		Str:      "_draft",
+		Replace:  "_final",
+		Exclude:  []string{"vendor"},
+		MaxDepth: 3,
+	})
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	want := []Proposal{
+		{Name: "docs/report_draft.txt", New: "docs/report_final.txt"},
+		{Name: "docs/report.txt", Reason: SKIP_NO_MATCH},
+		{Name: "notes.txt", Reason: SKIP_NO_MATCH},
+		{Name: "vendor/lib_draft.go", Reason: SKIP_GLOB_FILTERED},
+		{Name: "a/b/c/deep_draft.txt", Reason: SKIP_TOO_DEEP},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Names in the list are taken, unless they are renamed away.
+	got, err = ProposeNames([]string{"a_x.txt", "a.txt", "b_x.txt", "b.txt", "b_1.txt"}, Options{Str: "_x.txt", Replace: ".txt"})
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	if got[0].New != "a_1.txt" || got[2].New != "b_2.txt" {
+		t.Errorf("expected conflicts to be suffixed, got %v", got)
+	}
+	got, err = ProposeNames([]string{"a.txt", "b.txt"}, Options{Template: mustParseTemplate(t, "{counter}{ext}")})
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	if got[0].New != "1.txt" || got[1].New != "2.txt" {
+		t.Errorf("expected counters, got %v", got)
+	}
+
+	for _, names := range [][]string{{"a.txt", "a.txt"}, {"../a.txt"}, {"/a.txt"}, {""}} {
+		if _, err := ProposeNames(names, Options{Str: "a"}); err == nil {
+			t.Errorf("expected an error for names %q", names)
+		}
+	}
+	if _, err := ProposeNames([]string{"a.txt"}, Options{TypeGroup: "images", Sniff: true}); err == nil {
+		t.Error("expected an error for sniffing")
+	}
+	if _, err := ProposeNames([]string{"a.txt"}, Options{Template: mustParseTemplate(t, "{date}{ext}")}); err == nil {
+		t.Error("expected an error for template dates")
+	}
+}
+
+func mustParseTemplate(t *testing.T, s string) *Template {
+	t.Helper()
+	tmpl, err := ParseTemplate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
@@ -0,0 +1,191 @@
+package omitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Rules are the renaming options of the omitter command, keyed by the names
+// of its flags, for bindings of the engine to other languages. Dict maps
+// tokens to their replacements itself, instead of naming a CSV file.
+type Rules struct {
+	Str                string            `json:"s"`
+	Regex              bool              `json:"r"`
+	Replace            string            `json:"replace"`
+	Occurrence         string            `json:"occurrence"`
+	Count              int               `json:"count"`
+	FileType           string            `json:"t"`
+	TypeGroup          string            `json:"type"`
+	Include            []string          `json:"include"`
+	Exclude            []string          `json:"exclude"`
+	AnchorDir          string            `json:"anchor-dir"`
+	MaxDepth           int               `json:"max-depth"`
+	Dict               map[string]string `json:"dict"`
+	Swap               string            `json:"swap"`
+	ReverseStem        bool              `json:"reverse-stem"`
+	Prefix             string            `json:"prefix"`
+	Suffix             string            `json:"suffix"`
+	Number             bool              `json:"number"`
+	NumberStart        int               `json:"number-start"`
+	NumberStep         int               `json:"number-step"`
+	NumberFormat       string            `json:"number-format"`
+	NumberSort         string            `json:"number-sort"`
+	Redact             string            `json:"redact"`
+	AllowChars         string            `json:"allow-chars"`
+	AllowCharsFallback string            `json:"allow-chars-fallback"`
+	ASCII              bool              `json:"ascii"`
+	Normalize          string            `json:"normalize"`
+	Sanitize           bool              `json:"sanitize"`
+	IncludeTemp        bool              `json:"include-temp"`
+	SanitizeChar       string            `json:"sanitize-char"`
+	Template           string            `json:"template"`
+	ConflictSuffix     string            `json:"conflict-suffix"`
+	SuffixPlacement    string            `json:"suffix-placement"`
+	OnConflict         string            `json:"on-conflict"`
+	Assert             string            `json:"assert"`
+}
+
+// DefaultRules are the rules of a run without flags.
+func DefaultRules() Rules {
+	return Rules{
+		NumberStart:        1,
+		NumberStep:         1,
+		NumberFormat:       DEFAULT_NUMBER_FORMAT,
+		NumberSort:         NUMBER_SORT_NAME,
+		AllowCharsFallback: FALLBACK_REPLACE,
+		SanitizeChar:       "_",
+		ConflictSuffix:     DEFAULT_CONFLICT_SUFFIX,
+		SuffixPlacement:    PLACEMENT_BEFORE_EXT,
+		OnConflict:         CONFLICT_SUFFIX,
+	}
+}
+
+// ParseRules parses rules in JSON, where missing keys keep their defaults,
+// and returns their options.
+func ParseRules(data []byte) (Options, error) {
+	r := DefaultRules()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return Options{}, fmt.Errorf("parse rules: %w", err)
+	}
+	return r.Options()
+}
+
+// Options validates r as the command does its flags, and returns the
+// options of r.
+func (r Rules) Options() (Options, error) {
+	if _, ok := TypeGroups[r.TypeGroup]; r.TypeGroup != "" && !ok {
+		return Options{}, fmt.Errorf("unknown type group: %q", r.TypeGroup)
+	}
+	for _, pattern := range append(slices.Clone(r.Include), r.Exclude...) {
+		if !ValidGlob(pattern) {
+			return Options{}, fmt.Errorf("invalid glob: %q", pattern)
+		}
+	}
+	switch {
+	case strings.ContainsAny(r.Prefix+r.Suffix, `/\`):
+		return Options{}, fmt.Errorf("prefix and suffix can not contain path separators")
+	case strings.ContainsAny(r.AnchorDir, `/\`):
+		return Options{}, fmt.Errorf("anchor dir must be a name, not a path: %q", r.AnchorDir)
+	case r.MaxDepth < 0:
+		return Options{}, fmt.Errorf("invalid max depth: %d", r.MaxDepth)
+	case !ValidNumberFormat(r.NumberFormat):
+		return Options{}, fmt.Errorf("invalid number format: %q", r.NumberFormat)
+	case r.NumberStep == 0:
+		return Options{}, fmt.Errorf("number step can not be 0")
+	case r.NumberSort != NUMBER_SORT_NAME && r.NumberSort != NUMBER_SORT_MTIME:
+		return Options{}, fmt.Errorf("unknown number sort: %q", r.NumberSort)
+	case !ValidSuffixFormat(r.ConflictSuffix):
+		return Options{}, fmt.Errorf("invalid conflict suffix: %q", r.ConflictSuffix)
+	case r.SuffixPlacement != PLACEMENT_BEFORE_EXT && r.SuffixPlacement != PLACEMENT_AFTER_EXT:
+		return Options{}, fmt.Errorf("unknown conflict suffix placement: %q", r.SuffixPlacement)
+	case !slices.Contains([]string{CONFLICT_SUFFIX, CONFLICT_SKIP, CONFLICT_OVERWRITE, CONFLICT_FAIL}, r.OnConflict):
+		return Options{}, fmt.Errorf("unknown conflict policy: %q", r.OnConflict)
+	case !slices.Contains([]string{FALLBACK_REPLACE, FALLBACK_FAIL, FALLBACK_SKIP}, r.AllowCharsFallback):
+		return Options{}, fmt.Errorf("unknown allow-chars fallback: %q", r.AllowCharsFallback)
+	}
+	for token, replacement := range r.Dict {
+		if token == "" {
+			return Options{}, fmt.Errorf("empty dict token")
+		}
+		if strings.ContainsAny(replacement, `/\`) {
+			return Options{}, fmt.Errorf("dict replacement %q contains a path separator", replacement)
+		}
+	}
+
+	opts := Options{
+		Str:           r.Str,
+		Replace:       r.Replace,
+		Count:         r.Count,
+		FileType:      r.FileType,
+		TypeGroup:     r.TypeGroup,
+		Include:       r.Include,
+		Exclude:       r.Exclude,
+		AnchorDir:     r.AnchorDir,
+		MaxDepth:      r.MaxDepth,
+		Dict:          r.Dict,
+		Swap:          r.Swap,
+		ReverseStem:   r.ReverseStem,
+		Prefix:        r.Prefix,
+		Suffix:        r.Suffix,
+		AllowFallback: r.AllowCharsFallback,
+		ASCII:         r.ASCII,
+		Normalize:     r.Normalize,
+		Sanitize:      r.Sanitize,
+		IncludeTemp:   r.IncludeTemp,
+		SanitizeChar:  r.SanitizeChar,
+		ConflictSuffix: ConflictSuffix{
+			Format:   r.ConflictSuffix,
+			AfterExt: r.SuffixPlacement == PLACEMENT_AFTER_EXT,
+		},
+		OnConflict: r.OnConflict,
+	}
+	if r.Count < 0 {
+		return Options{}, fmt.Errorf("count can not be negative")
+	}
+	if r.Normalize != "" && !ValidNormalForm(r.Normalize) {
+		return Options{}, fmt.Errorf("unknown normalization form: %q", r.Normalize)
+	}
+	var err error
+	if r.Occurrence != "" {
+		if opts.Occurrence, err = ParseOccurrence(r.Occurrence); err != nil {
+			return Options{}, err
+		}
+	}
+	if r.Regex {
+		if opts.Pattern, err = regexp.Compile(r.Str); err != nil {
+			return Options{}, fmt.Errorf("compile pattern: %w", err)
+		}
+	}
+	if r.AllowChars != "" {
+		if opts.AllowedChars, err = regexp.Compile("^(?:" + r.AllowChars + ")$"); err != nil {
+			return Options{}, fmt.Errorf("compile allowed chars: %w", err)
+		}
+	}
+	if r.Redact != "" {
+		if opts.Redact, err = regexp.Compile(r.Redact); err != nil {
+			return Options{}, fmt.Errorf("compile redact pattern: %w", err)
+		}
+	}
+	if r.Template != "" {
+		if opts.Template, err = ParseTemplate(r.Template); err != nil {
+			return Options{}, fmt.Errorf("parse template: %w", err)
+		}
+	}
+	if r.Assert != "" {
+		if opts.Assert, err = ParseAssertions(r.Assert); err != nil {
+			return Options{}, fmt.Errorf("parse assert: %w", err)
+		}
+	}
+	if r.Number {
+		opts.Number = &Numbering{
+			Start: r.NumberStart, Step: r.NumberStep, Format: r.NumberFormat, Sort: r.NumberSort,
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,35 @@
+package omitter
+
+import (
+	"testing"
+)
+
+// TestParseRules verifies that rules keep the defaults of the command for
+// missing keys, and are validated as its flags are.
+func TestParseRules(t *testing.T) {
+	opts, err := ParseRules([]byte(`{"r": true, "s": "^IMG_\\d+", "replace": "holiday_", "number": true, "number-format": "%03d"}`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got, err := ProposeNames([]string{"IMG_8842.jpg", "IMG_8843.jpg"}, opts)
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	if got[0].New != "holiday_001.jpg" || got[1].New != "holiday_002.jpg" {
+		t.Errorf("expected holiday_001.jpg and holiday_002.jpg, got %v", got)
+	}
+
+	for _, rules := range []string{
+		`{"bogus": true}`,
+		`{"r": true, "s": "("}`,
+		`{"on-conflict": "prompt"}`,
+		`{"number": true, "number-step": 0}`,
+		`{"include": ["[a"]}`,
+		`{"prefix": "a/"}`,
+		`{"dict": {"a": "b/c"}}`,
+	} {
+		if _, err := ParseRules([]byte(rules)); err == nil {
+			t.Errorf("expected an error for rules %s", rules)
+		}
+	}
+}
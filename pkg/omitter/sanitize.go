@@ -0,0 +1,58 @@
+package omitter
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// UNSAFE_CHARS are the characters which names can not contain on Windows or
+// exFAT, besides the control characters.
+const UNSAFE_CHARS string = `<>:"/\|?*`
+
+// reservedNames are the device names of Windows, which files can not be
+// named after, with any extension.
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// Sanitize makes name safe to use on Windows and exFAT: unsafe characters
+// are replaced with replacement, or removed if it is empty, trailing dots and
+// spaces are removed, and reserved names such as CON or nul.txt get
+// replacement, or an underscore, after their stem.
+func Sanitize(name, replacement string) string {
+	name = strings.NewReplacer(unsafeReplacements(replacement)...).Replace(name)
+	name = strings.TrimRight(name, ". ")
+
+	stem, ext, _ := strings.Cut(name, ".")
+	if slices.ContainsFunc(reservedNames, func(reserved string) bool {
+		return strings.EqualFold(strings.TrimRight(stem, " "), reserved)
+	}) {
+		name = stem + cmp.Or(replacement, "_")
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// unsafeReplacements returns the arguments of strings.NewReplacer replacing
+// every unsafe character with replacement.
+func unsafeReplacements(replacement string) []string {
+	var oldnew []string
+	for _, r := range UNSAFE_CHARS {
+		oldnew = append(oldnew, string(r), replacement)
+	}
+	for r := range rune(0x20) {
+		oldnew = append(oldnew, string(r), replacement)
+	}
+	return append(oldnew, "\x7f", replacement)
+}
+
+// ValidSanitizeChar reports whether s can replace unsafe characters, being
+// safe itself.
+func ValidSanitizeChar(s string) bool {
+	return Sanitize("a"+s+"a", "") == "a"+s+"a"
+}
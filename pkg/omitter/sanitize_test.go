@@ -0,0 +1,79 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSanitize verifies that unsafe characters, trailing dots and spaces and
+// reserved names are fixed, and safe names left alone.
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, replacement, want string
+	}{
+		{"report.txt", "_", "report.txt"},
+		{`a<b>c:d"e|f?g*h.txt`, "_", "a_b_c_d_e_f_g_h.txt"},
+		{"a:b\x01.txt", "", "ab.txt"},
+		{"notes. . ", "_", "notes"},
+		{"CON", "_", "CON_"},
+		{"nul.tar.gz", "-", "nul-.tar.gz"},
+		{"lpt1 .txt", "", "lpt1 _.txt"},
+		{"console.txt", "_", "console.txt"},
+		{"COM10.txt", "_", "COM10.txt"},
+		{"...", "_", ""},
+	}
+	for _, tc := range tests {
+		if got := Sanitize(tc.name, tc.replacement); got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+	for s, want := range map[string]bool{"_": true, "": true, "-": true, ":": false, "/": false, "\t": false} {
+		if ValidSanitizeChar(s) != want {
+			t.Errorf("%q: expected valid to be %v", s, want)
+		}
+	}
+}
+
+// TestPlanSanitize verifies that sanitizing applies to the names computed by
+// the other options, only for the files searched for, and renames unsafe
+// names on its own.
+func TestPlanSanitize(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testsanitize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	a := createTempFile(t, tempDir, "a_draft.txt", "dummy")
+	b := createTempFile(t, tempDir, "b?.txt", "dummy")
+	createTempFile(t, tempDir, "c.txt", "dummy")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: "_draft", Replace: ": final.", Sanitize: true, SanitizeChar: "_"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{a: filepath.Join(tempDir, "a_ final..txt")}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	for oldPath, newPath := range want {
+		if plan.Pairs[oldPath] != newPath {
+			t.Errorf("expected %s to be renamed to %s, got %q", oldPath, newPath, plan.Pairs[oldPath])
+		}
+	}
+
+	plan, err = NewPlan(Options{Path: tempDir, Sanitize: true, SanitizeChar: "_"})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want = map[string]string{b: filepath.Join(tempDir, "b_.txt")}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	for oldPath, newPath := range want {
+		if plan.Pairs[oldPath] != newPath {
+			t.Errorf("expected %s to be renamed to %s, got %q", oldPath, newPath, plan.Pairs[oldPath])
+		}
+	}
+}
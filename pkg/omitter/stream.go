@@ -0,0 +1,150 @@
+package omitter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"strings"
+)
+
+// errStopWalk ends a walk whose consumer stopped early.
+var errStopWalk = errors.New("stop walk")
+
+// Pair is a file to be renamed, copied or moved, and its new path.
+type Pair struct {
+	Old, New string
+}
+
+// Stream walks the tree of opts like NewPlan, but yields every pair as soon
+// as the new name is known instead of building the plan first, so memory does
+// not grow with the size of the tree, only with its depth and the size of its
+// dirs. Skipped files are not yielded.
+//
+// Names of files not walked yet are unknown, so conflicts are resolved
+// against the tree as it is: a name held by a file which is renamed away
+// later still counts as taken. Names yielded earlier in the stream count as
+// taken as well, whether the consumer applies them or not. They are kept
+// until the walk leaves their dir, except under Output, which every new name
+// goes to, so there memory grows with the files copied or moved. The first
+// new name violating Assert ends the stream with its error.
+func Stream(opts Options, ignore ...string) iter.Seq2[Pair, error] {
+	return func(yield func(Pair, error) bool) {
+		opts := opts.prepared()
+		// taken holds the new paths yielded in every dir the walk is in.
+		taken := make(map[string]map[string]bool)
+		counter := 0
+		err := filepath.WalkDir(
+			opts.Path,
+			func(path string, file fs.DirEntry, err error) error {
+				switch {
+				case err != nil:
+					return err
+				case opts.canceled() != nil:
+					return opts.canceled()
+				case file.IsDir() && opts.skipDir(path):
+					return filepath.SkipDir
+				}
+				release(taken, filepath.Dir(path), opts.Output)
+				if file.IsDir() || ignored(file.Name(), ignore) {
+					return nil
+				}
+				c, _, err := transform(opts, path, file)
+				if err != nil {
+					return err
+				}
+				if c == nil {
+					return nil
+				}
+				counter++
+				if err := opts.drawID(c); err != nil {
+					return err
+				}
+				var vacated map[string]bool
+				if opts.Output == "" {
+					vacated = map[string]bool{path: true}
+				}
+				if taken[c.dir] == nil {
+					taken[c.dir] = make(map[string]bool)
+				}
+				newPath, reason, err := finalPath(opts, *c, counter, taken[c.dir], vacated)
+				if err != nil {
+					return err
+				}
+				if reason != "" {
+					return nil
+				}
+				if err := CheckAssertions(map[string]string{path: newPath}, opts.Assert); err != nil {
+					return err
+				}
+				taken[c.dir][newPath] = true
+				if !yield(Pair{Old: path, New: newPath}, nil) {
+					return errStopWalk
+				}
+				return nil
+			})
+		if err != nil && !errors.Is(err, errStopWalk) {
+			yield(Pair{}, err)
+		}
+	}
+}
+
+// release drops the names taken in the dirs which the walk left, now that it
+// is in dir: the ones which do not hold it. The names of output are kept.
+func release(taken map[string]map[string]bool, dir, output string) {
+	for d := range taken {
+		if d != output && d != dir && !strings.HasPrefix(dir, d+string(filepath.Separator)) {
+			delete(taken, d)
+		}
+	}
+}
+
+// ApplyStream carries out action, which is one of RENAME, COPY or MOVE, for
+// every pair of the stream as soon as it is yielded. Files are processed one
+// at a time in the order of the stream; Order, Workers and the progress bar
+// need the whole plan, so they are not used.
+func ApplyStream(action string, pairs iter.Seq2[Pair, error], opts ExecOptions) (Result, error) {
+	res := Result{Action: action}
+	var op fileOp
+	switch action {
+	case RENAME:
+		op = renameOp
+	case COPY:
+		op = ExecOptions.copy
+	case MOVE:
+		op = ExecOptions.move
+	default:
+		return res, fmt.Errorf("unknown action: %q", action)
+	}
+
+	start := opts.now()
+	var errs []error
+	err := func() error {
+		for p, err := range pairs {
+			if err != nil {
+				return err
+			}
+			if err = opts.before(); err != nil {
+				return err
+			}
+			opStart := opts.now()
+			if err = opts.timed(op, p.Old, p.New); err != nil {
+				opts.stalled(p.Old, p.New, err)
+				err = &FileError{Old: p.Old, New: p.New, Err: err}
+				if opts.skipTimeout(err) {
+					errs = append(errs, err)
+					continue
+				}
+				return err
+			}
+			res.Count++
+			if err = opts.done(p.Old, p.New, opStart); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	res.Elapsed = opts.now().Sub(start)
+	return res, errors.Join(append(errs, err)...)
+}
@@ -0,0 +1,127 @@
+package omitter
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestStream verifies that streamed pairs match the plan when no name is
+// held by a file renamed later.
+func TestStream(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "teststream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	createTempFile(t, tempDir, "a_target.txt", "dummy")
+	createTempFile(t, tempDir, "a_TARGET.txt", "dummy")
+	createTempFile(t, tempDir, "b.txt", "dummy")
+	createTempFile(t, tempDir, "c_target.txt", "dummy")
+	opts := Options{Path: tempDir, Str: "_target"}
+
+	plan, err := NewPlan(opts)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	streamed := make(map[string]string)
+	for p, err := range Stream(opts) {
+		if err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		streamed[p.Old] = p.New
+	}
+	if !maps.Equal(streamed, plan.Pairs) {
+		t.Errorf("expected %v, got %v", plan.Pairs, streamed)
+	}
+}
+
+// TestApplyStream verifies that streamed pairs are renamed as they come, and
+// that names held by files renamed later are not overwritten.
+func TestApplyStream(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "teststream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file1 := createTempFile(t, tempDir, "a.md", "first")
+	file2 := createTempFile(t, tempDir, "aa.md", "second")
+	opts := Options{Path: tempDir, Str: "a", Replace: "aa"}
+
+	res, err := ApplyStream(RENAME, Stream(opts), ExecOptions{})
+	if err != nil {
+		t.Fatalf("apply error: %v", err)
+	}
+	if res.Count != 2 {
+		t.Errorf("expected 2 files renamed, got %d", res.Count)
+	}
+	// a.md finds aa.md still in place, and takes a suffix.
+	for name, content := range map[string]string{"aa_1.md": "first", "aaaa.md": "second"} {
+		b, err := os.ReadFile(filepath.Join(tempDir, name))
+		if err != nil || string(b) != content {
+			t.Errorf("expected %s to hold %q, got %q (%v)", name, content, b, err)
+		}
+	}
+	for _, f := range []string{file1, file2} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be renamed", f)
+		}
+	}
+}
+
+// TestRelease verifies that only the names of the dirs holding the walk,
+// and of the output dir, are kept.
+func TestRelease(t *testing.T) {
+	root := filepath.FromSlash("/tree")
+	output := filepath.FromSlash("/out")
+	taken := make(map[string]map[string]bool)
+	for _, dir := range []string{"/tree", "/tree/a", "/tree/a/b", "/tree/ab", "/out"} {
+		taken[filepath.FromSlash(dir)] = map[string]bool{}
+	}
+	release(taken, filepath.Join(root, "ab", "c"), output)
+	want := []string{filepath.FromSlash("/out"), root, filepath.Join(root, "ab")}
+	if got := slices.Sorted(maps.Keys(taken)); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestPlannerStream verifies that the operations sent by a planner are the
+// ones of its plan, and that canceling the context stops the walk.
+func TestPlannerStream(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a_target.txt", "b_target.txt", "c.txt", "d_target.txt"} {
+		createTempFile(t, tempDir, name, "dummy")
+	}
+	p := Planner{Options: Options{Path: tempDir, Str: "_target"}}
+	plan, err := p.Plan()
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	ops, errs := p.Stream(context.Background())
+	streamed := make(map[string]string)
+	for op := range ops {
+		streamed[op.Old] = op.New
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if !maps.Equal(streamed, plan.Pairs) {
+		t.Errorf("expected %v, got %v", plan.Pairs, streamed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ops, errs = p.Stream(ctx)
+	<-ops
+	cancel()
+	for range ops {
+	}
+	if err = <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the walk to be canceled, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package omitter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Substitution is a search and replace of Options.Substitutions, made in
+// names after Str.
+type Substitution struct {
+	// Str is the text to find, and Pattern, if set, its regex, in whose
+	// Replace $1 or ${name} refer to the groups of the match.
+	Str     string
+	Pattern *regexp.Regexp
+	Replace string
+	// Occurrence and Count, if set, select the matches which are replaced
+	// instead of those of Options.
+	Occurrence int
+	Count      int
+}
+
+// matches reports whether name contains Str, or a match of Pattern if set.
+func (s Substitution) matches(name string) bool {
+	if s.Pattern != nil {
+		return s.Pattern.MatchString(name)
+	}
+	return strings.Contains(name, s.Str)
+}
+
+// apply replaces the matches of s in name which occurrence and count
+// select, as described in Options, or the Occurrence and Count of s if set.
+func (s Substitution) apply(name string, occurrence, count int) string {
+	if s.Occurrence != 0 || s.Count > 0 {
+		occurrence, count = s.Occurrence, s.Count
+	}
+	if s.Pattern != nil {
+		return ReplaceMatches(s.Pattern, name, s.Replace, occurrence, count)
+	}
+	return ReplaceOccurrences(name, s.Str, s.Replace, occurrence, count)
+}
@@ -0,0 +1,55 @@
+package omitter
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestPlanSubstitutions verifies that substitutions are made in order, each
+// on the name the previous ones left, and that files matching any of them
+// are renamed.
+func TestPlanSubstitutions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testsubstitutions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	movie := createTempFile(t, tempDir, "Movie.2020.[1080p].x265", "dummy")
+	show := createTempFile(t, tempDir, "Show.x265", "dummy")
+	createTempFile(t, tempDir, "notes", "dummy")
+
+	plan, err := NewPlan(Options{Path: tempDir, Str: ".[1080p]", Substitutions: []Substitution{
+		{Str: ".x265"},
+		{Str: ".", Replace: " "},
+	}})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	want := map[string]string{
+		movie: filepath.Join(tempDir, "Movie 2020"),
+		show:  filepath.Join(tempDir, "Show"),
+	}
+	if len(plan.Pairs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, plan.Pairs)
+	}
+	for oldPath, newPath := range want {
+		if plan.Pairs[oldPath] != newPath {
+			t.Errorf("expected %s to become %s, got %s", oldPath, newPath, plan.Pairs[oldPath])
+		}
+	}
+
+	// In regex mode, the first pattern need not match.
+	plan, err = NewPlan(Options{
+		Path: tempDir, Str: "nothing", Pattern: regexp.MustCompile("nothing"),
+		Substitutions: []Substitution{{Str: `^(\w+)\.x265$`, Pattern: regexp.MustCompile(`^(\w+)\.x265$`), Replace: "${1}_hevc"}},
+	})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if len(plan.Pairs) != 1 || plan.Pairs[show] != filepath.Join(tempDir, "Show_hevc") {
+		t.Errorf("expected only %s to be renamed, got %v", show, plan.Pairs)
+	}
+}
@@ -0,0 +1,330 @@
+package omitter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Audio tags of {tag.NAME} placeholders.
+const (
+	TAG_ARTIST string = "artist"
+	TAG_ALBUM  string = "album"
+	TAG_TITLE  string = "title"
+	TAG_TRACK  string = "track"
+	TAG_YEAR   string = "year"
+	TAG_GENRE  string = "genre"
+)
+
+// maxTagsSize caps how much of a file is read looking for tags, as cover art
+// can make them large.
+const maxTagsSize = 16 << 20
+
+// errNoTags is returned by the parsers for data they do not recognize.
+var errNoTags = errors.New("no tags found")
+
+// id3Frames maps ID3v2.3 and v2.4 frames, and their v2.2 equivalents, to tags.
+var id3Frames = map[string]string{
+	"TPE1": TAG_ARTIST, "TP1": TAG_ARTIST,
+	"TALB": TAG_ALBUM, "TAL": TAG_ALBUM,
+	"TIT2": TAG_TITLE, "TT2": TAG_TITLE,
+	"TRCK": TAG_TRACK, "TRK": TAG_TRACK,
+	"TYER": TAG_YEAR, "TYE": TAG_YEAR, "TDRC": TAG_YEAR,
+	"TCON": TAG_GENRE, "TCO": TAG_GENRE,
+}
+
+// vorbisFields maps the Vorbis comments of FLAC and OGG files to tags.
+var vorbisFields = map[string]string{
+	"ARTIST":      TAG_ARTIST,
+	"ALBUM":       TAG_ALBUM,
+	"TITLE":       TAG_TITLE,
+	"TRACKNUMBER": TAG_TRACK,
+	"DATE":        TAG_YEAR,
+	"GENRE":       TAG_GENRE,
+}
+
+// ReadTags returns the tags of an MP3, FLAC or OGG file. Files of other
+// formats, or without recognizable tags, have none; an error is only returned
+// if the file can not be read.
+func ReadTags(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file(%q): %w", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, maxTagsSize))
+	magic, err := r.Peek(4)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read file(%q): %w", path, err)
+	}
+	var tags map[string]string
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		tags, err = readID3v2(r)
+	case bytes.Equal(magic, []byte("fLaC")):
+		tags, err = readFLAC(r)
+	case bytes.Equal(magic, []byte("OggS")):
+		tags, err = readOgg(r)
+	}
+	if len(tags) == 0 && (err == nil || errors.Is(err, errNoTags)) {
+		// Old MP3 files may only carry an ID3v1 tag at their end.
+		tags, err = readID3v1(f)
+	}
+	switch {
+	case errors.Is(err, errNoTags), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF):
+		return tags, nil
+	case err != nil:
+		return nil, fmt.Errorf("read tags of %q: %w", path, err)
+	}
+	return tags, nil
+}
+
+func readID3v2(r io.Reader) (map[string]string, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	version, flags := header[3], header[5]
+	if version < 2 || version > 4 {
+		return nil, errNoTags
+	}
+	body := make([]byte, syncsafe(header[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if flags&0x40 != 0 && version > 2 && len(body) >= 4 {
+		// Skip the extended header, whose size includes itself only in v2.4.
+		size := int(binary.BigEndian.Uint32(body)) + 4
+		if version == 4 {
+			size = syncsafe(body[:4])
+		}
+		body = body[min(size, len(body)):]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	tags := make(map[string]string)
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var size int
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+		default:
+			size = syncsafe(body[4:8])
+		}
+		body = body[headerLen:]
+		if size > len(body) {
+			break
+		}
+		if tag, ok := id3Frames[id]; ok && size > 0 {
+			if value := id3Text(body[:size]); value != "" {
+				tags[tag] = value
+			}
+		}
+		body = body[size:]
+	}
+	return tags, nil
+}
+
+// syncsafe decodes the 28-bit integers of ID3v2 headers.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Text decodes a text frame, of which only the first value is kept.
+func id3Text(frame []byte) string {
+	encoding, data := frame[0], frame[1:]
+	var s string
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(data) >= 2 {
+			switch {
+			case data[0] == 0xfe && data[1] == 0xff:
+				bigEndian, data = true, data[2:]
+			case data[0] == 0xff && data[1] == 0xfe:
+				bigEndian, data = false, data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[i:]))
+			}
+		}
+		s = string(utf16.Decode(units))
+	case 3:
+		s = string(data)
+	default:
+		s = latin1(data)
+	}
+	s, _, _ = strings.Cut(s, "\x00")
+	return strings.TrimSpace(s)
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func readID3v1(f io.ReadSeeker) (map[string]string, error) {
+	if _, err := f.Seek(-128, io.SeekEnd); err != nil {
+		// Shorter than the tag.
+		return nil, errNoTags
+	}
+	var tag [128]byte
+	if _, err := io.ReadFull(f, tag[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(tag[:], []byte("TAG")) {
+		return nil, errNoTags
+	}
+	tags := make(map[string]string)
+	for name, field := range map[string][]byte{
+		TAG_TITLE:  tag[3:33],
+		TAG_ARTIST: tag[33:63],
+		TAG_ALBUM:  tag[63:93],
+		TAG_YEAR:   tag[93:97],
+	} {
+		value, _, _ := strings.Cut(latin1(field), "\x00")
+		if value = strings.TrimSpace(value); value != "" {
+			tags[name] = value
+		}
+	}
+	// ID3v1.1 keeps the track in the last byte of the comment.
+	if tag[125] == 0 && tag[126] != 0 {
+		tags[TAG_TRACK] = fmt.Sprint(tag[126])
+	}
+	return tags, nil
+}
+
+func readFLAC(r io.Reader) (map[string]string, error) {
+	if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+		return nil, err
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		last, kind := header[0]&0x80 != 0, header[0]&0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if kind == 4 {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, err
+			}
+			return vorbisComments(block)
+		}
+		if last {
+			return nil, errNoTags
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readOgg reads the comments of Vorbis and Opus streams, carried by their
+// second packet.
+func readOgg(r io.Reader) (map[string]string, error) {
+	var packet []byte
+	packets := 0
+	for {
+		var header [27]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, errNoTags
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, err
+		}
+		for _, size := range segments {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			if packets == 1 {
+				packet = append(packet, data...)
+			}
+			// Segments shorter than 255 bytes end a packet.
+			if size < 255 {
+				if packets == 1 {
+					switch {
+					case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+						return vorbisComments(packet[7:])
+					case bytes.HasPrefix(packet, []byte("OpusTags")):
+						return vorbisComments(packet[8:])
+					}
+					return nil, errNoTags
+				}
+				packets++
+			}
+		}
+	}
+}
+
+// vorbisComments decodes a Vorbis comment block, which starts with the
+// vendor string.
+func vorbisComments(b []byte) (map[string]string, error) {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		size := binary.LittleEndian.Uint32(b)
+		if uint64(size) > uint64(len(b)-4) {
+			return nil, false
+		}
+		field := b[4 : 4+size]
+		b = b[4+size:]
+		return field, true
+	}
+	if _, ok := next(); !ok {
+		return nil, errNoTags
+	}
+	if len(b) < 4 {
+		return nil, errNoTags
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	tags := make(map[string]string)
+	for range count {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(string(comment), "=")
+		tag, known := vorbisFields[strings.ToUpper(key)]
+		if !ok || !known {
+			continue
+		}
+		if value = strings.TrimSpace(value); value != "" && tags[tag] == "" {
+			tags[tag] = value
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,111 @@
+package omitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// id3v23 builds an ID3v2.3 tag holding the given text frames.
+func id3v23(frames map[string]string) []byte {
+	var body bytes.Buffer
+	for id, value := range frames {
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(value)+1))
+		body.Write([]byte{0, 0, 3})
+		body.WriteString(value)
+	}
+	size := body.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body.Bytes()...)
+}
+
+// flacComments builds a FLAC stream whose last metadata block holds the
+// given Vorbis comments.
+func flacComments(comments ...string) []byte {
+	var block bytes.Buffer
+	le := func(n int) { binary.Write(&block, binary.LittleEndian, uint32(n)) }
+	le(len("vendor"))
+	block.WriteString("vendor")
+	le(len(comments))
+	for _, c := range comments {
+		le(len(c))
+		block.WriteString(c)
+	}
+	size := block.Len()
+	b := []byte("fLaC")
+	// An empty padding block comes first.
+	b = append(b, 1, 0, 0, 0)
+	b = append(b, 0x80|4, byte(size>>16), byte(size>>8), byte(size))
+	return append(b, block.Bytes()...)
+}
+
+// TestReadTags verifies the tags read out of MP3 and FLAC files.
+func TestReadTags(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mp3 := createTempFile(t, tempDir, "a.mp3", string(id3v23(map[string]string{
+		"TPE1": "Artist", "TIT2": "Song", "TRCK": "3/12", "TYER": "1999",
+	}))+"audio")
+	flac := createTempFile(t, tempDir, "b.flac", string(flacComments(
+		"ARTIST=Band", "album=Record", "TRACKNUMBER=7", "DATE=2001-02-03",
+	)))
+	plain := createTempFile(t, tempDir, "c.txt", "dummy")
+
+	for path, want := range map[string]map[string]string{
+		mp3:   {TAG_ARTIST: "Artist", TAG_TITLE: "Song", TAG_TRACK: "3/12", TAG_YEAR: "1999"},
+		flac:  {TAG_ARTIST: "Band", TAG_ALBUM: "Record", TAG_TRACK: "7", TAG_YEAR: "2001-02-03"},
+		plain: {},
+	} {
+		tags, err := ReadTags(path)
+		if err != nil {
+			t.Fatalf("read tags error: %v", err)
+		}
+		if len(tags) != len(want) {
+			t.Errorf("%s: expected tags %v, got %v", path, want, tags)
+		}
+		for k, v := range want {
+			if tags[k] != v {
+				t.Errorf("%s: expected %s %q, got %q", path, k, v, tags[k])
+			}
+		}
+	}
+}
+
+// TestNewPlanTags verifies that tag placeholders are normalized, and fall
+// back when tags are missing.
+func TestNewPlanTags(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mp3 := createTempFile(t, tempDir, "a.mp3", string(id3v23(map[string]string{
+		"TPE1": "AC/DC", "TIT2": "Song", "TRCK": "3/12",
+	})))
+	flac := createTempFile(t, tempDir, "b.flac", string(flacComments("TITLE=Other")))
+
+	tmpl, err := ParseTemplate("{tag.artist} - {tag.album:No Album} - {tag.track} {tag.title}{ext}")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	plan, err := NewPlan(Options{Path: tempDir, Template: tmpl})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if filepath.Base(plan.Pairs[mp3]) != "AC-DC - No Album - 03 Song.mp3" ||
+		filepath.Base(plan.Pairs[flac]) != "Unknown - No Album - Unknown Other.flac" {
+		t.Errorf("unexpected pairs: %v", plan.Pairs)
+	}
+	if _, err = ParseTemplate("{tag.composer}"); err == nil {
+		t.Error("expected an error for an unknown tag")
+	}
+}
@@ -0,0 +1,441 @@
+package omitter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholders of templates.
+const (
+	FIELD_NAME    string = "name"
+	FIELD_EXT     string = "ext"
+	FIELD_COUNTER string = "counter"
+	FIELD_DATE    string = "date"
+	FIELD_CTIME   string = "ctime"
+	FIELD_PARENT  string = "parent"
+	FIELD_TAG     string = "tag"
+	FIELD_UUID    string = "uuid"
+	FIELD_ULID    string = "ulid"
+)
+
+// defaultDateLayout is the layout of {date} and {ctime} placeholders without
+// one.
+const defaultDateLayout = "2006-01-02"
+
+// Formats of {counter:FORMAT} placeholders, besides decimal.
+const (
+	COUNTER_ROMAN       string = "roman"
+	COUNTER_ROMAN_UPPER string = "ROMAN"
+	COUNTER_ALPHA       string = "alpha"
+	COUNTER_ALPHA_UPPER string = "ALPHA"
+)
+
+// counterDigits are the zero digits of the locales counters can be written
+// in with {counter:LOCALE} or {counter:LOCALE:WIDTH}. The other nine follow
+// in order.
+var counterDigits = map[string]rune{
+	"arabic":     '٠',
+	"persian":    '۰',
+	"devanagari": '०',
+	"bengali":    '০',
+	"thai":       '๐',
+}
+
+// defaultTagFallback replaces missing tags of {tag.NAME} placeholders
+// without a fallback of their own.
+const defaultTagFallback = "Unknown"
+
+// Template builds new names out of literal text and placeholders in braces:
+// {name} is the name without its extension, {ext} the extension with its dot,
+// {counter} or {counter:WIDTH} the zero padded position of the file in the
+// run, also written as roman numerals, letters or in the digits of a locale
+// with {counter:FORMAT}, {date} or {date:LAYOUT} the modification time in a Go time layout,
+// {ctime} or {ctime:LAYOUT} the change time, or the creation time on Windows,
+// both shifted with an offset such as {date-1d} or {date+6h:15},
+// and {parent} the name of the dir holding the file. {tag.NAME} or
+// {tag.NAME:FALLBACK} is an audio tag of MP3, FLAC and OGG files, one of
+// artist, album, title, track, year and genre. {uuid} is a random version 4
+// UUID, and {ulid} a ULID of the time the plan was made, both drawn anew for
+// every file.
+type Template struct {
+	text  string
+	parts []templatePart
+}
+
+// templatePart is either a literal, or a field with its optional argument.
+type templatePart struct {
+	literal string
+	field   string
+	arg     string
+	width   int
+	tag     string
+	// format is the format of counters, decimal if empty.
+	format string
+	// offset is added to dates.
+	offset dateOffset
+}
+
+// dateOffset is a number of calendar days and a duration, which dates are
+// shifted by.
+type dateOffset struct {
+	days int
+	d    time.Duration
+}
+
+// templateVars are the values placeholders expand to.
+type templateVars struct {
+	name       string
+	parent     string
+	counter    int
+	modTime    time.Time
+	changeTime time.Time
+	tags       map[string]string
+	// id are the random bits of {uuid} and {ulid}, and idTime the time of
+	// {ulid}.
+	id     [16]byte
+	idTime time.Time
+}
+
+// ParseTemplate parses a template such as "{date}_{counter:3}{ext}".
+func ParseTemplate(s string) (*Template, error) {
+	t := Template{text: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in template %q", s)
+		}
+		field, arg, _ := strings.Cut(rest[open+1:open+end], ":")
+		var width int
+		var tag, format string
+		var offset dateOffset
+		if name, ok := strings.CutPrefix(field, FIELD_TAG+"."); ok {
+			field, tag = FIELD_TAG, name
+		}
+		for _, date := range []string{FIELD_DATE, FIELD_CTIME} {
+			if rest, ok := strings.CutPrefix(field, date); ok && rest != "" {
+				var err error
+				if offset, err = parseDateOffset(rest); err != nil {
+					return nil, err
+				}
+				field = date
+			}
+		}
+		switch field {
+		case FIELD_NAME, FIELD_EXT, FIELD_PARENT, FIELD_UUID, FIELD_ULID:
+			if arg != "" {
+				return nil, fmt.Errorf("placeholder {%s} takes no argument", field)
+			}
+		case FIELD_COUNTER:
+			var err error
+			if format, width, err = parseCounterArg(arg); err != nil {
+				return nil, err
+			}
+		case FIELD_DATE, FIELD_CTIME:
+			if arg == "" {
+				arg = defaultDateLayout
+			}
+		case FIELD_TAG:
+			switch tag {
+			case TAG_ARTIST, TAG_ALBUM, TAG_TITLE, TAG_TRACK, TAG_YEAR, TAG_GENRE:
+			default:
+				return nil, fmt.Errorf("unknown tag {%s.%s}", FIELD_TAG, tag)
+			}
+			if arg == "" {
+				arg = defaultTagFallback
+			}
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s}", field)
+		}
+		t.parts = append(t.parts, templatePart{
+			field: field, arg: arg, width: width, tag: tag, format: format, offset: offset,
+		})
+		rest = rest[open+end+1:]
+	}
+	for _, p := range t.parts {
+		if strings.ContainsAny(p.literal, `/\`) || strings.ContainsAny(p.arg, `/\`) {
+			return nil, fmt.Errorf("template %q contains a path separator", s)
+		}
+	}
+	return &t, nil
+}
+
+// String returns the template as it was written.
+func (t *Template) String() string {
+	return t.text
+}
+
+// usesTags reports whether expanding t needs the audio tags of files.
+func (t *Template) usesTags() bool {
+	for _, p := range t.parts {
+		if p.field == FIELD_TAG {
+			return true
+		}
+	}
+	return false
+}
+
+// usesDates reports whether expanding t needs the dates of files.
+func (t *Template) usesDates() bool {
+	for _, p := range t.parts {
+		if p.field == FIELD_DATE || p.field == FIELD_CTIME {
+			return true
+		}
+	}
+	return false
+}
+
+// usesIDs reports whether expanding t needs random bits.
+func (t *Template) usesIDs() bool {
+	for _, p := range t.parts {
+		if p.field == FIELD_UUID || p.field == FIELD_ULID {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns the name built out of the template for v.
+func (t *Template) expand(v templateVars) string {
+	ext := filepath.Ext(v.name)
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case FIELD_NAME:
+			b.WriteString(strings.TrimSuffix(v.name, ext))
+		case FIELD_EXT:
+			b.WriteString(ext)
+		case FIELD_PARENT:
+			b.WriteString(v.parent)
+		case FIELD_COUNTER:
+			b.WriteString(formatCounter(v.counter, p.format, p.width))
+		case FIELD_DATE:
+			b.WriteString(p.offset.add(v.modTime).Format(p.arg))
+		case FIELD_CTIME:
+			b.WriteString(p.offset.add(v.changeTime).Format(p.arg))
+		case FIELD_TAG:
+			value := tagValue(p.tag, v.tags[p.tag])
+			if value == "" {
+				value = p.arg
+			}
+			b.WriteString(value)
+		case FIELD_UUID:
+			b.WriteString(formatUUID(v.id))
+		case FIELD_ULID:
+			b.WriteString(formatULID(v.idTime, v.id))
+		}
+	}
+	return b.String()
+}
+
+// formatUUID writes id as a version 4 UUID, in lower case, with the version
+// and variant bits set.
+func formatUUID(id [16]byte) string {
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	h := hex.EncodeToString(id[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// crockford is the alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// formatULID writes a ULID: the milliseconds of t since the Unix epoch in
+// 48 bits, followed by the first 80 bits of id, in 26 characters of
+// Crockford's base32.
+func formatULID(t time.Time, id [16]byte) string {
+	ms := uint64(t.UnixMilli())
+	hi := ms<<16 | uint64(id[0])<<8 | uint64(id[1])
+	lo := binary.BigEndian.Uint64(id[2:10])
+	b := make([]byte, 26)
+	for i := range b {
+		var v uint64
+		switch shift := uint(5 * (25 - i)); {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		default:
+			v = lo>>shift | hi<<(64-shift)
+		}
+		b[i] = crockford[v&31]
+	}
+	return string(b)
+}
+
+// tagValue normalizes the value of tag for use in a name: tracks are the
+// zero padded number before any "/total", years drop the rest of the date,
+// and path separators become dashes.
+func tagValue(tag, value string) string {
+	switch tag {
+	case TAG_TRACK:
+		value, _, _ = strings.Cut(value, "/")
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			value = fmt.Sprintf("%02d", n)
+		}
+	case TAG_YEAR:
+		if len(value) > 4 {
+			value = value[:4]
+		}
+	}
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '-'
+		case r < ' ':
+			return -1
+		}
+		return r
+	}, value)
+	return strings.TrimSpace(value)
+}
+
+// parseCounterArg parses the argument of a {counter} placeholder: a width, a
+// format, or the locale of its digits with an optional width.
+func parseCounterArg(arg string) (string, int, error) {
+	if arg == "" {
+		return "", 0, nil
+	}
+	format, widthArg, hasWidth := strings.Cut(arg, ":")
+	if width, err := strconv.Atoi(format); err == nil && !hasWidth {
+		if width < 1 {
+			return "", 0, fmt.Errorf("invalid counter width %q", arg)
+		}
+		return "", width, nil
+	}
+	switch format {
+	case COUNTER_ROMAN, COUNTER_ROMAN_UPPER, COUNTER_ALPHA, COUNTER_ALPHA_UPPER:
+		if hasWidth {
+			return "", 0, fmt.Errorf("counter format %q takes no width", format)
+		}
+		return format, 0, nil
+	}
+	if _, ok := counterDigits[format]; !ok {
+		return "", 0, fmt.Errorf("invalid counter format %q", arg)
+	}
+	if !hasWidth {
+		return format, 0, nil
+	}
+	width, err := strconv.Atoi(widthArg)
+	if err != nil || width < 1 {
+		return "", 0, fmt.Errorf("invalid counter width %q", widthArg)
+	}
+	return format, width, nil
+}
+
+// formatCounter writes n in format, padded with zeros to width.
+func formatCounter(n int, format string, width int) string {
+	switch format {
+	case COUNTER_ROMAN:
+		return strings.ToLower(roman(n))
+	case COUNTER_ROMAN_UPPER:
+		return roman(n)
+	case COUNTER_ALPHA:
+		return alpha(n)
+	case COUNTER_ALPHA_UPPER:
+		return strings.ToUpper(alpha(n))
+	}
+	s := fmt.Sprintf("%0*d", width, n)
+	zero, ok := counterDigits[format]
+	if !ok {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		return zero + r - '0'
+	}, s)
+}
+
+// romanNumerals are the values of roman numerals, largest first, including
+// the subtractive pairs.
+var romanNumerals = []struct {
+	value   int
+	numeral string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+	{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// roman writes n in roman numerals. As there is no numeral for zero, and
+// none above 3999 in the standard form, those are written in decimal.
+func roman(n int) string {
+	if n < 1 || n > 3999 {
+		return strconv.Itoa(n)
+	}
+	var b strings.Builder
+	for _, r := range romanNumerals {
+		for n >= r.value {
+			b.WriteString(r.numeral)
+			n -= r.value
+		}
+	}
+	return b.String()
+}
+
+// alpha writes n as letters the way spreadsheets name columns: a to z, then
+// aa, ab and so on.
+func alpha(n int) string {
+	if n < 1 {
+		return strconv.Itoa(n)
+	}
+	var b []byte
+	for n > 0 {
+		n--
+		b = append(b, byte('a'+n%26))
+		n /= 26
+	}
+	slices.Reverse(b)
+	return string(b)
+}
+
+// parseDateOffset parses the offset of a date placeholder, such as "-1d",
+// "+6h" or "-1d12h": a sign, optional calendar days, and a Go duration.
+func parseDateOffset(s string) (dateOffset, error) {
+	var o dateOffset
+	if len(s) < 2 {
+		return o, fmt.Errorf("invalid date offset %q", s)
+	}
+	sign := 1
+	switch s[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return o, fmt.Errorf("invalid date offset %q", s)
+	}
+	rest := s[1:]
+	if days, after, ok := strings.Cut(rest, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return o, fmt.Errorf("invalid date offset %q", s)
+		}
+		o.days, rest = sign*n, after
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return o, fmt.Errorf("invalid date offset %q", s)
+		}
+		o.d = time.Duration(sign) * d
+	}
+	return o, nil
+}
+
+// add shifts t by the offset. Days are calendar days, so they keep the time
+// of day across daylight saving changes.
+func (o dateOffset) add(t time.Time) time.Time {
+	return t.AddDate(0, 0, o.days).Add(o.d)
+}
@@ -0,0 +1,187 @@
+package omitter
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseTemplate verifies that invalid templates are rejected.
+func TestParseTemplate(t *testing.T) {
+	for tmpl, valid := range map[string]bool{
+		"{name}_{counter:3}{ext}":      true,
+		"{date:20060102}-{parent}.txt": true,
+		"plain.txt":                    true,
+		"{ctime:20060102}_{name}{ext}": true,
+		"{name":                        false,
+		"{size}":                       false,
+		"{counter:x}":                  false,
+		"{date-1d12h:2006-01-02}":      true,
+		"{ctime+6h}":                   true,
+		"{date-}":                      false,
+		"{date-1x}":                    false,
+		"{counter:roman}":              true,
+		"{counter:persian:3}":          true,
+		"{counter:roman:3}":            false,
+		"{counter:persian:x}":          false,
+		"{ext:upper}":                  false,
+		"sub/{name}":                   false,
+		"{uuid}{ext}":                  true,
+		"{ulid}_{name}{ext}":           true,
+		"{uuid:4}":                     false,
+	} {
+		if _, err := ParseTemplate(tmpl); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%v, got error %v", tmpl, valid, err)
+		}
+	}
+}
+
+// TestFormatCounter verifies the formats of counters.
+func TestFormatCounter(t *testing.T) {
+	cases := []struct {
+		n      int
+		format string
+		width  int
+		want   string
+	}{
+		{7, "", 3, "007"},
+		{1994, COUNTER_ROMAN_UPPER, 0, "MCMXCIV"},
+		{14, COUNTER_ROMAN, 0, "xiv"},
+		{1, COUNTER_ALPHA, 0, "a"},
+		{26, COUNTER_ALPHA, 0, "z"},
+		{27, COUNTER_ALPHA_UPPER, 0, "AA"},
+		{703, COUNTER_ALPHA, 0, "aaa"},
+		{12, "persian", 3, "۰۱۲"},
+		{305, "arabic", 0, "٣٠٥"},
+	}
+	for _, c := range cases {
+		if got := formatCounter(c.n, c.format, c.width); got != c.want {
+			t.Errorf("%d in %q: expected %q, got %q", c.n, c.format, c.want, got)
+		}
+	}
+}
+
+// TestDateOffset verifies that dates are shifted by their offset, in the
+// time zone of the options.
+func TestDateOffset(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtemplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTempFile(t, tempDir, "scan.pdf", "dummy")
+	modTime := time.Date(2024, 3, 1, 1, 30, 0, 0, time.UTC)
+	if err = os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("{date-1d:2006-01-02}_{date+2h:15}{ext}")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	plan, err := NewPlan(Options{Path: tempDir, Template: tmpl, Location: time.UTC})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if got := filepath.Base(plan.Pairs[file]); got != "2024-02-29_03.pdf" {
+		t.Errorf("expected %q, got %q", "2024-02-29_03.pdf", got)
+	}
+}
+
+// TestNewPlanTemplate verifies that new names are built from the template before conflicts are resolved.
+func TestNewPlanTemplate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testtemplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	albumDir := filepath.Join(tempDir, "album")
+	if err = os.Mkdir(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file1 := createTempFile(t, albumDir, "IMG_1.jpg", "dummy")
+	file2 := createTempFile(t, albumDir, "IMG_2.jpg", "dummy")
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	for _, f := range []string{file1, file2} {
+		if err = os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpl, err := ParseTemplate("{parent}_{counter:3}{ext}")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	plan, err := NewPlan(Options{Path: tempDir, Template: tmpl})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if filepath.Base(plan.Pairs[file1]) != "album_001.jpg" ||
+		filepath.Base(plan.Pairs[file2]) != "album_002.jpg" {
+		t.Errorf("unexpected pairs: %v", plan.Pairs)
+	}
+
+	// Equal dates conflict, and get the default suffix.
+	tmpl, err = ParseTemplate("{date}{ext}")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	plan, err = NewPlan(Options{Path: tempDir, Template: tmpl})
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if filepath.Base(plan.Pairs[file1]) != "2024-05-06.jpg" ||
+		filepath.Base(plan.Pairs[file2]) != "2024-05-06_1.jpg" {
+		t.Errorf("unexpected pairs: %v", plan.Pairs)
+	}
+}
+
+// TestTemplateIDs verifies that {uuid} and {ulid} are well formed, differ
+// from file to file, and are the same for the same seed and time.
+func TestTemplateIDs(t *testing.T) {
+	id := [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if got := formatUUID(id); got != "ffffffff-ffff-4fff-bfff-ffffffffffff" {
+		t.Errorf("expected the version and variant bits to be set, got %s", got)
+	}
+	if got := formatULID(time.UnixMilli(1469918176385), [16]byte{}); got != "01ARYZ6S410000000000000000" {
+		t.Errorf("unexpected ulid %s", got)
+	}
+	if got := formatULID(time.UnixMilli(1<<48-1), id); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("unexpected ulid %s", got)
+	}
+
+	tempDir := t.TempDir()
+	file1 := createTempFile(t, tempDir, "a.txt", "dummy")
+	file2 := createTempFile(t, tempDir, "b.txt", "dummy")
+	tmpl, err := ParseTemplate("{uuid}_{ulid}{ext}")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	plan := func() Plan {
+		t.Helper()
+		opts := Options{
+			Path: tempDir, Template: tmpl,
+			Clock: &fakeClock{now: time.UnixMilli(1469918176385)},
+			Rand:  rand.NewChaCha8([32]byte{1}),
+		}
+		p, err := NewPlan(opts)
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		return p
+	}
+	first, second := plan(), plan()
+	name1, name2 := filepath.Base(first.Pairs[file1]), filepath.Base(first.Pairs[file2])
+	if name1 == name2 || len(name1) != len("ffffffff-ffff-4fff-bfff-ffffffffffff_01ARYZ6S410000000000000000.txt") {
+		t.Errorf("expected two distinct ids, got %s and %s", name1, name2)
+	}
+	if name1[37:47] != "01ARYZ6S41" {
+		t.Errorf("expected the ulid to hold the time of the plan, got %s", name1)
+	}
+	if first.Pairs[file1] != second.Pairs[file1] || first.Pairs[file2] != second.Pairs[file2] {
+		t.Errorf("expected the same names for the same seed, got %v and %v", first.Pairs, second.Pairs)
+	}
+}
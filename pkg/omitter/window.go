@@ -0,0 +1,74 @@
+package omitter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily span of time, which may wrap around midnight. Both ends
+// are durations since midnight.
+type Window struct {
+	from, to time.Duration
+}
+
+// ParseWindow parses a time window formatted as "HH:MM-HH:MM".
+func ParseWindow(s string) (*Window, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q", s)
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(fromStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid window start %q: %w", fromStr, err)
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(toStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid window end %q: %w", toStr, err)
+	}
+	return &Window{from: sinceMidnight(from), to: sinceMidnight(to)}, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// untilOpen returns how long it takes from t until the window opens, which
+// is zero if it is open.
+func (w *Window) untilOpen(t time.Time) time.Duration {
+	now := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	var open bool
+	if w.from <= w.to {
+		open = now >= w.from && now < w.to
+	} else {
+		open = now >= w.from || now < w.to
+	}
+	if open {
+		return 0
+	}
+	if now < w.from {
+		return w.from - now
+	}
+	return 24*time.Hour - now + w.from
+}
+
+// Wait blocks until the window is open, on the system clock if c is nil. A
+// nil window is always open.
+func (w *Window) Wait(c Clock) {
+	if w == nil {
+		return
+	}
+	if c == nil {
+		c = SystemClock{}
+	}
+	now := c.Now()
+	d := w.untilOpen(now)
+	if d == 0 {
+		return
+	}
+	fmt.Printf("\nOutside of the time window, pausing until %s.\n",
+		now.Add(d).Format("15:04"))
+	c.Sleep(d)
+}
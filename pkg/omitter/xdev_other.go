@@ -0,0 +1,39 @@
+//go:build !windows
+
+package omitter
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// crossDevice reports whether err is the one of renaming a file to another
+// file system.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// sameDevice reports whether the files at a and b are on the same file
+// system, as far as it can be told.
+func sameDevice(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	stA, okA := infoA.Sys().(*syscall.Stat_t)
+	stB, okB := infoB.Sys().(*syscall.Stat_t)
+	return !okA || !okB || stA.Dev == stB.Dev, nil
+}
+
+// keepOwner gives path the owner and group of info, where it is permitted.
+func keepOwner(path string, info fs.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Lchown(path, int(st.Uid), int(st.Gid))
+	}
+}
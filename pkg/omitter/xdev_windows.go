@@ -0,0 +1,36 @@
+package omitter
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned for renames to
+// another volume.
+const errorNotSameDevice syscall.Errno = 17
+
+// crossDevice reports whether err is the one of renaming a file to another
+// volume.
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// sameDevice reports whether the files at a and b are on the same volume.
+func sameDevice(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB)), nil
+}
+
+// keepOwner does nothing, as owners are part of the security descriptors of
+// files on Windows.
+func keepOwner(string, fs.FileInfo) {}
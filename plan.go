@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// buildPlan reads the plan of cfg, or walks the tree for it, and skips the
+// files the checks of cfg keep, exiting if they fail. It returns the snapshot
+// of -changed-since as well.
+func buildPlan(cfg config, pattern *regexp.Regexp, actionName string) (omitter.Plan, snapshot) {
+	var err error
+	var p omitter.Plan
+	if cfg.planIn != "" {
+		p.Pairs, err = readPlan(cfg.planIn, cfg.options.path, cfg.planFilter)
+		if err != nil {
+			fmt.Println("read plan:", err)
+			os.Exit(1)
+		}
+		abortOnViolations(omitter.CheckAssertions(p.Pairs, cfg.assertions))
+	} else {
+		// Interrupts only stop the walk, and terminate prompts as usual.
+		ctx, stop := interruptible(cfg.deadline)
+		planOpts := cfg.planOptions(pattern)
+		planOpts.Context = ctx
+		p, err = omitter.NewPlan(planOpts, ignoredNames...)
+		stop()
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			printRunError("walk dir", err)
+			os.Exit(exitCode(err))
+		}
+		if errors.Is(err, omitter.ErrConflict) {
+			fmt.Println("Aborted:", err)
+			os.Exit(exitConflict)
+		}
+		abortOnViolations(err)
+		if err != nil {
+			fmt.Println("walk dir:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+	pairs := p.Pairs
+	if cfg.withSkipOpen {
+		open, err := openFiles(slices.Collect(maps.Keys(pairs)))
+		if err != nil {
+			fmt.Println("check open files:", err)
+			os.Exit(2)
+		}
+		skipKept(&p, open, SKIP_OPEN_FILE)
+	}
+	var snap snapshot
+	if cfg.changedSince != "" {
+		snap, err = loadSnapshot(cfg.changedSince)
+		if err != nil {
+			fmt.Println("load snapshot:", err)
+			os.Exit(1)
+		}
+		unchanged, err := snap.unchanged(cfg.options.path, slices.Collect(maps.Keys(pairs)))
+		if err != nil {
+			fmt.Println("compare snapshot:", err)
+			os.Exit(2)
+		}
+		// Most files are usually unchanged, so they are not listed one by one.
+		for _, path := range dropPairs(pairs, unchanged) {
+			reason := SKIP_NOT_CHANGED
+			if !unchanged[path] {
+				reason = SKIP_TARGET_KEPT
+			}
+			p.Skipped = append(p.Skipped, omitter.SkippedFile{Path: path, Reason: reason})
+		}
+	}
+	if protected := protectedFiles(pairs, actionName); len(protected) > 0 {
+		paths := slices.Sorted(maps.Keys(protected))
+		if cfg.protected == PROTECTED_FAIL {
+			for _, path := range paths {
+				fmt.Println(protected[path])
+			}
+			fmt.Println("Aborted.")
+			os.Exit(2)
+		}
+		keep := make(map[string]bool, len(protected))
+		for _, path := range paths {
+			keep[path] = true
+		}
+		skipKept(&p, keep, SKIP_PROTECTED)
+	}
+
+	if cfg.skipReport != "" {
+		if err = writeSkipReport(cfg.skipReport, p.Skipped); err != nil {
+			fmt.Println("write skip report:", err)
+			os.Exit(2)
+		}
+	}
+
+	if cfg.withStrict {
+		if skipped := strictSkips(p.Skipped); len(skipped) > 0 {
+			for _, f := range skipped {
+				fmt.Printf("Skipped %s: %s\n", f.Path, f.Reason)
+			}
+			fmt.Printf("Aborted: %d matched file(s) would be skipped.\n", len(skipped))
+			os.Exit(exitCode(skipped[0].Err()))
+		}
+	}
+
+	if cfg.options.expectPerDir != "" {
+		low, high, err := parseRange(cfg.options.expectPerDir)
+		if err != nil {
+			fmt.Println("parse expect-per-dir:", err)
+			os.Exit(1)
+		}
+		violations, err := checkPerDir(cfg.options.path, pairs, low, high)
+		if err != nil {
+			fmt.Println("check matches per dir:", err)
+			os.Exit(2)
+		}
+		if len(violations) > 0 {
+			for _, v := range violations {
+				fmt.Println(v)
+			}
+			fmt.Println("Aborted.")
+			os.Exit(2)
+		}
+	}
+
+	if cfg.options.checkHardlinks != "" && actionName != omitter.COPY {
+		aliases, err := findHardlinks(cfg.options.checkHardlinks, pairs)
+		if err != nil {
+			fmt.Println("check hard links:", err)
+			os.Exit(2)
+		}
+		for path, links := range aliases {
+			fmt.Printf("Warning: %s has %d other hard link(s) which will keep the old name:\n", path, len(links))
+			for _, link := range links {
+				fmt.Printf("  %s\n", link)
+			}
+		}
+	}
+	return p, snap
+}
+
+// protectedFiles describes every file of pairs which can not be processed by
+// actionName because of its attributes, or the ones of its dirs.
+func protectedFiles(pairs map[string]string, actionName string) map[string]string {
+	dirs := make(map[string]string)
+	dirProtection := func(dir string) string {
+		p, ok := dirs[dir]
+		if !ok {
+			p = protection(dir)
+			dirs[dir] = p
+		}
+		return p
+	}
+	protected := make(map[string]string)
+	for oldName, newName := range pairs {
+		// Renaming and moving remove the source from its dir, every action
+		// creates the destination in its dir.
+		if actionName != omitter.COPY {
+			if p := protection(oldName); p != "" {
+				protected[oldName] = fmt.Sprintf("%s is %s", oldName, p)
+				continue
+			}
+			if p := dirProtection(filepath.Dir(oldName)); p != "" {
+				protected[oldName] = fmt.Sprintf("%s is in %s dir %s", oldName, p, filepath.Dir(oldName))
+				continue
+			}
+		}
+		if p := dirProtection(filepath.Dir(newName)); p != "" {
+			protected[oldName] = fmt.Sprintf("%s would be written to %s dir %s", oldName, p, filepath.Dir(newName))
+		}
+	}
+	return protected
+}
+
+// dropPairs removes the files of keep from pairs, along with every file which
+// would be renamed to a kept file, and returns the removed ones sorted.
+func dropPairs(pairs map[string]string, keep map[string]bool) []string {
+	kept := maps.Clone(keep)
+	var dropped []string
+	for changed := true; changed; {
+		changed = false
+		for oldName, newName := range pairs {
+			if kept[oldName] || kept[newName] {
+				delete(pairs, oldName)
+				kept[oldName] = true
+				dropped = append(dropped, oldName)
+				changed = true
+			}
+		}
+	}
+	slices.Sort(dropped)
+	return dropped
+}
+
+// abortOnViolations lists the new names which violate an assertion and
+// aborts the run, if err is an *omitter.AssertionError.
+func abortOnViolations(err error) {
+	var assertErr *omitter.AssertionError
+	if !errors.As(err, &assertErr) {
+		return
+	}
+	for _, v := range assertErr.Violations {
+		fmt.Printf("%s -> %s: violates %s\n", v.Path, v.New, v.Assertion)
+	}
+	fmt.Printf("Aborted: %d new name(s) violate the assertions.\n", len(assertErr.Violations))
+	os.Exit(exitCode(err))
+}
+
+// strictReasons are the reasons of skipping files which matched, and so
+// should have been processed, as opposed to the ones of the filters.
+var strictReasons = []string{
+	omitter.SKIP_EMPTY_RESULT, omitter.SKIP_DISALLOWED_CHARS, omitter.SKIP_CONFLICT,
+	SKIP_OPEN_FILE, SKIP_TARGET_KEPT, SKIP_PROTECTED,
+}
+
+// strictSkips returns the files of skipped which -strict fails on, sorted by
+// path.
+func strictSkips(skipped []omitter.SkippedFile) []omitter.SkippedFile {
+	var strict []omitter.SkippedFile
+	for _, f := range skipped {
+		if slices.Contains(strictReasons, f.Reason) {
+			strict = append(strict, f)
+		}
+	}
+	slices.SortFunc(strict, func(a, b omitter.SkippedFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return strict
+}
+
+// skipCounts describes how many files of skipped there are for every reason,
+// as in "conflict: 2, open_file: 1".
+func skipCounts(skipped []omitter.SkippedFile) string {
+	counts := make(map[string]int)
+	for _, f := range skipped {
+		counts[f.Reason]++
+	}
+	var parts []string
+	for _, reason := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%s: %d", reason, counts[reason]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// skipKept drops the files of keep from the plan, as skipped for reason, and
+// the files which would be renamed onto them as skipped for SKIP_TARGET_KEPT.
+func skipKept(p *omitter.Plan, keep map[string]bool, reason string) {
+	for _, path := range dropPairs(p.Pairs, keep) {
+		r := reason
+		if !keep[path] {
+			r = SKIP_TARGET_KEPT
+		}
+		fmt.Printf("Skipping %s: %s\n", path, r)
+		p.Skipped = append(p.Skipped, omitter.SkippedFile{Path: path, Reason: r})
+	}
+}
+
+// readOnlyMounts describes every read-only mount which would make file
+// operations of pairs fail, and how many of them each one blocks.
+func readOnlyMounts(pairs map[string]string, actionName string) []string {
+	readOnly := make(map[string]bool)
+	blocked := make(map[string]int)
+	examples := make(map[string]string)
+	check := func(dir, oldName string) bool {
+		ro, ok := readOnly[dir]
+		if !ok {
+			ro = isReadOnly(dir)
+			readOnly[dir] = ro
+		}
+		if ro {
+			mount := mountPoint(dir)
+			blocked[mount]++
+			if _, ok := examples[mount]; !ok {
+				examples[mount] = oldName
+			}
+		}
+		return ro
+	}
+	for oldName, newName := range pairs {
+		// Renaming and moving remove the source from its dir, copying and
+		// moving create the destination in its dir.
+		if actionName != omitter.COPY && check(filepath.Dir(oldName), oldName) {
+			continue
+		}
+		if actionName != omitter.RENAME {
+			check(filepath.Dir(newName), oldName)
+		}
+	}
+
+	var messages []string
+	for _, mount := range slices.Sorted(maps.Keys(blocked)) {
+		messages = append(messages, fmt.Sprintf(
+			"%s is mounted read-only, which blocks %d %s operation(s) (e.g. %s)",
+			mount, blocked[mount], actionName, examples[mount],
+		))
+	}
+	return messages
+}
+
+func writeSkipReport(path string, skipped []omitter.SkippedFile) error {
+	if skipped == nil {
+		skipped = []omitter.SkippedFile{}
+	}
+	b, err := json.MarshalIndent(skipped, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal skipped files: %w", err)
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// parseRange parses "N", "N..M", "N.." and "..M". An open high end is -1.
+func parseRange(s string) (int, int, error) {
+	lowStr, highStr, isRange := strings.Cut(s, "..")
+	if !isRange {
+		highStr = lowStr
+	}
+	low, high := 0, -1
+	var err error
+	if lowStr != "" {
+		if low, err = strconv.Atoi(lowStr); err != nil || low < 0 {
+			return 0, 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if highStr != "" {
+		if high, err = strconv.Atoi(highStr); err != nil || high < low {
+			return 0, 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	return low, high, nil
+}
+
+// checkPerDir counts the matches in every dir under root directly holding
+// files, and describes each dir whose count falls outside low..high.
+func checkPerDir(root string, pairs map[string]string, low, high int) ([]string, error) {
+	counts := make(map[string]int)
+	for oldName := range pairs {
+		counts[filepath.Dir(oldName)]++
+	}
+	var violations []string
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case !file.IsDir():
+				return nil
+			}
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(entries, func(e fs.DirEntry) bool { return !e.IsDir() }) {
+				return nil
+			}
+			n := counts[filepath.Clean(path)]
+			if n < low || (high >= 0 && n > high) {
+				violations = append(violations, fmt.Sprintf(
+					"%s: %d match(es), expected %s", path, n, formatRange(low, high),
+				))
+			}
+			return nil
+		})
+	return violations, err
+}
+
+func formatRange(low, high int) string {
+	if high < 0 {
+		return fmt.Sprintf("at least %d", low)
+	}
+	return fmt.Sprintf("%d..%d", low, high)
+}
+
+type inode struct {
+	dev, ino uint64
+}
+
+// findHardlinks maps every file of pairs having more than one hard link to the
+// other paths under root linking to the same inode. Those paths keep the old
+// name after the rename.
+func findHardlinks(root string, pairs map[string]string) (map[string][]string, error) {
+	linked := make(map[inode]string)
+	for oldName := range pairs {
+		info, err := os.Lstat(oldName)
+		if err != nil {
+			return nil, fmt.Errorf("get file(%q) info: %w", oldName, err)
+		}
+		dev, ino, nlink, ok := fileID(info)
+		if ok && nlink > 1 {
+			linked[inode{dev, ino}] = oldName
+		}
+	}
+
+	aliases := make(map[string][]string)
+	if len(linked) == 0 {
+		return aliases, nil
+	}
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case !file.Type().IsRegular():
+				return nil
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			dev, ino, _, ok := fileID(info)
+			if !ok {
+				return nil
+			}
+			oldName, ok := linked[inode{dev, ino}]
+			if !ok || sameFile(oldName, path) {
+				return nil
+			}
+			aliases[oldName] = append(aliases[oldName], path)
+			return nil
+		})
+	return aliases, err
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
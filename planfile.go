@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// planHeader is the first row of plan files.
+var planHeader = []string{"old", "new"}
+
+// jsonPlan is a plan written by -plan-out to a .json file, which records the
+// size and hash of every file as well, so the run can be checked by verify
+// once it was carried out.
+type jsonPlan struct {
+	// Root is the absolute path dir, against which the paths of Files are
+	// resolved.
+	Root   string          `json:"root"`
+	Action string          `json:"action"`
+	Files  []jsonPlanEntry `json:"files"`
+}
+
+type jsonPlanEntry struct {
+	Old  string `json:"old"`
+	New  string `json:"new"`
+	Size int64  `json:"size"`
+	Hash string `json:"sha256,omitempty"`
+}
+
+// isJSONPlan reports whether the plan at path is a JSON plan rather than a
+// CSV one.
+func isJSONPlan(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// writeJSONPlan writes pairs to a JSON plan, with paths relative to root,
+// and the size and SHA-256 of every file, which are read to be hashed.
+func writeJSONPlan(path, root, action string, pairs map[string]string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	p := jsonPlan{Root: abs, Action: action, Files: []jsonPlanEntry{}}
+	for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+		oldRel, err := filepath.Rel(root, oldName)
+		if err != nil {
+			return err
+		}
+		newRel, err := filepath.Rel(root, pairs[oldName])
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(oldName)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(oldName)
+		if err != nil {
+			return err
+		}
+		p.Files = append(p.Files, jsonPlanEntry{
+			Old: filepath.ToSlash(oldRel), New: filepath.ToSlash(newRel), Size: info.Size(), Hash: hash,
+		})
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// loadJSONPlan reads the JSON plan at path.
+func loadJSONPlan(path string) (jsonPlan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return jsonPlan{}, err
+	}
+	var p jsonPlan
+	if err = json.Unmarshal(b, &p); err != nil {
+		return jsonPlan{}, fmt.Errorf("parse plan(%q): %w", path, err)
+	}
+	return p, nil
+}
+
+// resolvePlanPath resolves a path of a plan: relative paths are relative
+// to root, absolute ones are kept.
+func resolvePlanPath(root, p string) string {
+	p = filepath.FromSlash(p)
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(root, p)
+}
+
+// planName returns path relative to root, slash separated, as filters of
+// plans match it, or path itself if it is not under root.
+func planName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writePlan writes pairs to a CSV file of old,new rows, with paths relative
+// to root so the plan can be applied to a copy of the tree elsewhere.
+func writePlan(path, root string, pairs map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err = w.Write(planHeader); err != nil {
+		return err
+	}
+	for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+		oldRel, err := filepath.Rel(root, oldName)
+		if err != nil {
+			return err
+		}
+		newRel, err := filepath.Rel(root, pairs[oldName])
+		if err != nil {
+			return err
+		}
+		if err = w.Write([]string{filepath.ToSlash(oldRel), filepath.ToSlash(newRel)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// regexPrefix marks the patterns of -only and -skip which are regexes rather
+// than globs.
+const regexPrefix = "re:"
+
+// planFilter selects the files of a plan to carry out, by their old path
+// relative to the root of the plan. The zero value selects every file.
+type planFilter struct {
+	only, skip []func(name string) bool
+}
+
+// add adds pattern to the patterns of only, or of skip if skip is set. It is
+// a glob, as of -include, or a regex if prefixed with "re:".
+func (f *planFilter) add(pattern string, skip bool) error {
+	var match func(string) bool
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		match = re.MatchString
+	} else {
+		if !omitter.ValidGlob(pattern) {
+			return fmt.Errorf("invalid glob %q", pattern)
+		}
+		match = func(name string) bool {
+			return omitter.MatchGlob(pattern, name)
+		}
+	}
+	if skip {
+		f.skip = append(f.skip, match)
+	} else {
+		f.only = append(f.only, match)
+	}
+	return nil
+}
+
+// set reports whether f leaves any file out.
+func (f planFilter) set() bool {
+	return len(f.only) > 0 || len(f.skip) > 0
+}
+
+// keeps reports whether the file of name, a slash separated path relative to
+// the root of the plan, is carried out: it matches a pattern of only, if
+// any, and none of skip.
+func (f planFilter) keeps(name string) bool {
+	matches := func(match func(string) bool) bool {
+		return match(name)
+	}
+	return (len(f.only) == 0 || slices.ContainsFunc(f.only, matches)) &&
+		!slices.ContainsFunc(f.skip, matches)
+}
+
+// readPlan reads a plan written by writePlan or writeJSONPlan, possibly
+// edited since, and returns its pairs with paths resolved against root, of
+// the files filter keeps. The plan is refused if a file is missing, listed
+// twice, or would be renamed onto another file. Files left out are not
+// checked, so slices of a plan can be carried out one after the other.
+func readPlan(path, root string, filter planFilter) (map[string]string, error) {
+	// Rows are numbered as lines of CSV files, header included, and as
+	// files of JSON ones.
+	var rows [][]string
+	first := 1
+	if isJSONPlan(path) {
+		p, err := loadJSONPlan(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range p.Files {
+			rows = append(rows, []string{entry.Old, entry.New})
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = 2
+		if rows, err = r.ReadAll(); err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 && slices.Equal(rows[0], planHeader) {
+			rows, first = rows[1:], 2
+		}
+	}
+	resolve := func(p string) string {
+		return resolvePlanPath(root, p)
+	}
+
+	pairs := make(map[string]string, len(rows))
+	targets := make(map[string]bool, len(rows))
+	for i, row := range rows {
+		if row[0] == "" || row[1] == "" {
+			return nil, fmt.Errorf("row %d: empty path", i+first)
+		}
+		oldName, newName := resolve(row[0]), resolve(row[1])
+		if oldName == newName || !filter.keeps(planName(root, oldName)) {
+			continue
+		}
+		if _, ok := pairs[oldName]; ok {
+			return nil, fmt.Errorf("row %d: duplicate file %q", i+first, row[0])
+		}
+		if targets[newName] {
+			return nil, fmt.Errorf("row %d: duplicate new path %q", i+first, row[1])
+		}
+		if _, err := os.Lstat(oldName); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+first, err)
+		}
+		pairs[oldName] = newName
+		targets[newName] = true
+	}
+	if err := checkOverwrites(pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// checkOverwrites returns an error if two files of pairs have the same new
+// path, or one would be renamed onto an existing file which is not renamed
+// away itself.
+func checkOverwrites(pairs map[string]string) error {
+	targets := make(map[string]string, len(pairs))
+	for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+		newName := pairs[oldName]
+		if other, ok := targets[newName]; ok {
+			return fmt.Errorf("%q and %q would both be renamed to %q", other, oldName, newName)
+		}
+		targets[newName] = oldName
+		_, vacated := pairs[newName]
+		if _, err := os.Lstat(newName); err == nil && !vacated {
+			return fmt.Errorf("%q would be renamed onto the existing %q", oldName, newName)
+		}
+	}
+	return nil
+}
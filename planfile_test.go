@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPlanFile verifies that a written plan is read back, and that edited
+// plans with conflicts are refused.
+func TestPlanFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := createTempFile(t, dir, "a_x.txt", "")
+	b := createTempFile(t, dir, "b, x.txt", "")
+	pairs := map[string]string{
+		a: filepath.Join(dir, "a.txt"),
+		b: filepath.Join(dir, "b.txt"),
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.csv")
+	if err = writePlan(planPath, dir, pairs); err != nil {
+		t.Fatalf("write plan error: %v", err)
+	}
+	got, err := readPlan(planPath, dir, planFilter{})
+	if err != nil {
+		t.Fatalf("read plan error: %v", err)
+	}
+	if len(got) != len(pairs) || got[a] != pairs[a] || got[b] != pairs[b] {
+		t.Errorf("expected %v, got %v", pairs, got)
+	}
+
+	createTempFile(t, dir, "c.txt", "")
+	for _, plan := range []string{
+		"old,new\na_x.txt,c.txt\n",
+		"a_x.txt,a.txt\na_x.txt,b.txt\n",
+		"a_x.txt,a.txt\n\"b, x.txt\",a.txt\n",
+		"missing.txt,a.txt\n",
+	} {
+		if err = os.WriteFile(planPath, []byte(plan), 0644); err != nil {
+			t.Fatalf("failed to write plan: %v", err)
+		}
+		if _, err = readPlan(planPath, dir, planFilter{}); err == nil {
+			t.Errorf("expected an error for plan %q", strings.TrimSpace(plan))
+		}
+	}
+}
+
+// TestPlanFilter verifies that -only and -skip select the files of a plan by
+// their old path, and that the files left out are not checked, so slices of
+// a plan can be carried out one after the other.
+func TestPlanFilter(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"photos", "docs"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	photo := createTempFile(t, dir, "photos/a_x.jpg", "")
+	doc := createTempFile(t, dir, "docs/b_x.txt", "")
+	raw := createTempFile(t, dir, "photos/c_x.raw", "")
+	planPath := filepath.Join(t.TempDir(), "plan.csv")
+	plan := "photos/a_x.jpg,photos/a.jpg\ndocs/b_x.txt,docs/b.txt\nphotos/c_x.raw,photos/c.raw\n"
+	if err := os.WriteFile(planPath, []byte(plan), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var f planFilter
+	if err := f.add("photos/**", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.add(`re:\.raw$`, true); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readPlan(planPath, dir, f)
+	if err != nil {
+		t.Fatalf("read plan error: %v", err)
+	}
+	if len(got) != 1 || got[photo] == "" {
+		t.Errorf("expected only %s, got %v", photo, got)
+	}
+	if err = os.Rename(photo, got[photo]); err != nil {
+		t.Fatal(err)
+	}
+
+	f = planFilter{}
+	if err = f.add("photos/**", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = readPlan(planPath, dir, f); err != nil {
+		t.Fatalf("read plan error: %v", err)
+	}
+	if len(got) != 1 || got[doc] == "" || got[raw] != "" {
+		t.Errorf("expected only %s, got %v", doc, got)
+	}
+	if err = f.add("re:(", false); err == nil {
+		t.Error("expected an invalid regex to be refused")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// planCommand runs the plan subcommand named by the first of args.
+func planCommand(args []string) {
+	if len(args) == 0 || args[0] != "merge" {
+		fmt.Println("usage: omitter plan merge [-o merged.json] a.json b.json...")
+		os.Exit(1)
+	}
+	planMerge(args[1:])
+}
+
+// planMerge combines JSON plans of -plan-out into one, so batches prepared
+// apart can be carried out as a single run. Plans which would get in the
+// way of each other are refused, with every conflict listed, and the exit
+// code is 4.
+func planMerge(args []string) {
+	flags := flag.NewFlagSet("plan merge", flag.ExitOnError)
+	output := flags.String("o", "", "write the merged plan to this JSON file. default is the standard output")
+	// Flags may follow the plans, as in "plan merge a.json b.json -o c.json".
+	var paths []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		paths = append(paths, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(paths) < 2 || *output != "" && !isJSONPlan(*output) {
+		flags.Usage()
+		os.Exit(1)
+	}
+	plans := make([]jsonPlan, len(paths))
+	for i, path := range paths {
+		if !isJSONPlan(path) {
+			fmt.Printf("only JSON plans can be merged: %q\n", path)
+			os.Exit(1)
+		}
+		var err error
+		if plans[i], err = loadJSONPlan(path); err != nil {
+			fmt.Println("load plan:", err)
+			os.Exit(1)
+		}
+	}
+
+	merged, conflicts, err := mergePlans(paths, plans)
+	if err != nil {
+		fmt.Println("merge plans:", err)
+		os.Exit(1)
+	}
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			fmt.Println("conflict:", conflict)
+		}
+		os.Exit(exitConflict)
+	}
+	b, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		fmt.Println("merge plans:", err)
+		os.Exit(2)
+	}
+	b = append(b, '\n')
+	if *output == "" {
+		os.Stdout.Write(b)
+		return
+	}
+	if err = os.WriteFile(*output, b, 0o644); err != nil {
+		fmt.Println("write plan:", err)
+		os.Exit(2)
+	}
+	fmt.Printf("Merged %d file(s) of %d plan(s) into %s, rooted at %s.\n",
+		len(merged.Files), len(plans), *output, merged.Root)
+}
+
+// mergedEntry is an entry of a merged plan, with its paths resolved, and the
+// plan it comes from.
+type mergedEntry struct {
+	entry    jsonPlanEntry
+	old, new string
+	plan     string
+}
+
+// mergePlans merges plans, read from paths, into a plan rooted at the
+// nearest dir holding all their roots. Files listed in several plans with
+// the same new path are merged into one. It returns the conflicts instead
+// if a file gets different new paths, two files the same one, or one is
+// renamed onto a file another plan renames away, which that plan did not
+// expect.
+func mergePlans(paths []string, plans []jsonPlan) (jsonPlan, []string, error) {
+	var root string
+	byOld := make(map[string]mergedEntry)
+	byNew := make(map[string]mergedEntry)
+	var conflicts []string
+	for i, p := range plans {
+		if p.Action != plans[0].Action {
+			return jsonPlan{}, nil, fmt.Errorf("%q is a %s plan, but %q a %s one",
+				paths[i], p.Action, paths[0], plans[0].Action)
+		}
+		if !filepath.IsAbs(p.Root) {
+			return jsonPlan{}, nil, fmt.Errorf("root of %q is not absolute: %q", paths[i], p.Root)
+		}
+		root = commonDir(root, p.Root)
+		for _, entry := range p.Files {
+			e := mergedEntry{
+				entry: entry, plan: paths[i],
+				old: resolvePlanPath(p.Root, entry.Old), new: resolvePlanPath(p.Root, entry.New),
+			}
+			if other, ok := byOld[e.old]; ok {
+				if other.new != e.new {
+					conflicts = append(conflicts, fmt.Sprintf("%q goes to %q in %s, but to %q in %s",
+						e.old, other.new, other.plan, e.new, e.plan))
+				}
+				continue
+			}
+			if other, ok := byNew[e.new]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%q of %s and %q of %s both go to %q",
+					other.old, other.plan, e.old, e.plan, e.new))
+				continue
+			}
+			byOld[e.old], byNew[e.new] = e, e
+		}
+	}
+	// Within a plan, files renamed onto one renamed away are planned that
+	// way, but across plans the other one was not expected to move.
+	for _, newName := range slices.Sorted(maps.Keys(byNew)) {
+		e := byNew[newName]
+		if other, ok := byOld[e.new]; ok && other.plan != e.plan {
+			conflicts = append(conflicts, fmt.Sprintf("%q of %s goes to %q, which %s renames to %q",
+				e.old, e.plan, e.new, other.plan, other.new))
+		}
+	}
+	if len(conflicts) > 0 {
+		return jsonPlan{}, conflicts, nil
+	}
+
+	merged := jsonPlan{Root: root, Action: plans[0].Action, Files: []jsonPlanEntry{}}
+	for _, oldName := range slices.Sorted(maps.Keys(byOld)) {
+		e := byOld[oldName]
+		oldRel, err := filepath.Rel(root, e.old)
+		if err != nil {
+			return jsonPlan{}, nil, err
+		}
+		newRel, err := filepath.Rel(root, e.new)
+		if err != nil {
+			return jsonPlan{}, nil, err
+		}
+		e.entry.Old, e.entry.New = filepath.ToSlash(oldRel), filepath.ToSlash(newRel)
+		merged.Files = append(merged.Files, e.entry)
+	}
+	return merged, nil, nil
+}
+
+// commonDir returns the nearest dir holding both a and b, or b if a is
+// empty.
+func commonDir(a, b string) string {
+	b = filepath.Clean(b)
+	if a == "" {
+		return b
+	}
+	for {
+		if a == b || strings.HasPrefix(b, strings.TrimSuffix(a, string(filepath.Separator))+string(filepath.Separator)) {
+			return a
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+}
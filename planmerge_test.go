@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// TestMergePlans verifies that plans of different roots are merged under
+// their common dir, and that plans getting in the way of each other are
+// refused with every conflict.
+func TestMergePlans(t *testing.T) {
+	root := t.TempDir()
+	a := jsonPlan{Root: filepath.Join(root, "a"), Action: omitter.RENAME, Files: []jsonPlanEntry{
+		{Old: "x_old.txt", New: "x.txt", Size: 1, Hash: "h1"},
+	}}
+	b := jsonPlan{Root: filepath.Join(root, "b", "c"), Action: omitter.RENAME, Files: []jsonPlanEntry{
+		{Old: "y_old.txt", New: "y.txt", Size: 2},
+		{Old: "../../a/x_old.txt", New: "../../a/x.txt", Size: 1, Hash: "h1"},
+	}}
+	merged, conflicts, err := mergePlans([]string{"a.json", "b.json"}, []jsonPlan{a, b})
+	if err != nil || len(conflicts) > 0 {
+		t.Fatalf("merge error: %v %v", err, conflicts)
+	}
+	want := []jsonPlanEntry{
+		{Old: "a/x_old.txt", New: "a/x.txt", Size: 1, Hash: "h1"},
+		{Old: "b/c/y_old.txt", New: "b/c/y.txt", Size: 2},
+	}
+	if merged.Root != root || len(merged.Files) != len(want) ||
+		merged.Files[0] != want[0] || merged.Files[1] != want[1] {
+		t.Errorf("expected %v under %s, got %v under %s", want, root, merged.Files, merged.Root)
+	}
+
+	c := jsonPlan{Root: filepath.Join(root, "a"), Action: omitter.RENAME, Files: []jsonPlanEntry{
+		{Old: "x_old.txt", New: "x2.txt"},
+		{Old: "z.txt", New: "x.txt"},
+		{Old: "x.txt", New: "w.txt"},
+	}}
+	if _, conflicts, err = mergePlans([]string{"a.json", "c.json"}, []jsonPlan{a, c}); err != nil {
+		t.Fatalf("merge error: %v", err)
+	}
+	if len(conflicts) != 3 {
+		t.Errorf("expected 3 conflicts, got %q", conflicts)
+	}
+
+	c.Action = omitter.COPY
+	if _, _, err = mergePlans([]string{"a.json", "c.json"}, []jsonPlan{a, c}); err == nil {
+		t.Error("expected plans of different actions to be refused")
+	}
+}
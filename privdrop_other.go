@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// lookupPrivileges fails, as services pick their account on this platform.
+func lookupPrivileges(userName, groupName string) (uid, gid int, groups []int, err error) {
+	return -1, -1, nil, errors.New("-user and -group are only supported on Unix, set the account of the service instead")
+}
+
+// dropPrivileges does nothing, as lookupPrivileges fails on this platform.
+func dropPrivileges(uid, gid int, groups []int) error {
+	return nil
+}
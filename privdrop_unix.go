@@ -0,0 +1,69 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupPrivileges resolves userName and groupName, names or ids as taken by
+// lookupOwner, to the ids dropPrivileges switches to. Without a group, the
+// primary group of the user is used, along with its supplementary groups;
+// with one, the supplementary groups are dropped. Left out ids are -1.
+func lookupPrivileges(userName, groupName string) (uid, gid int, groups []int, err error) {
+	owner := userName
+	if groupName != "" {
+		owner += ":" + groupName
+	}
+	if uid, gid, err = lookupOwner(owner); err != nil {
+		return -1, -1, nil, err
+	}
+	if userName != "" && groupName == "" {
+		u, err := user.LookupId(strconv.Itoa(uid))
+		if err != nil {
+			return -1, -1, nil, err
+		}
+		gid, _ = strconv.Atoi(u.Gid)
+		ids, err := u.GroupIds()
+		if err != nil {
+			return -1, -1, nil, fmt.Errorf("groups of %s: %w", u.Username, err)
+		}
+		for _, id := range ids {
+			if n, err := strconv.Atoi(id); err == nil {
+				groups = append(groups, n)
+			}
+		}
+	}
+	if gid != -1 && groups == nil {
+		groups = []int{gid}
+	}
+	return uid, gid, groups, nil
+}
+
+// dropPrivileges switches the process to uid, gid and groups, as returned by
+// lookupPrivileges. The ids are changed for every thread, and can not be got
+// back.
+func dropPrivileges(uid, gid int, groups []int) error {
+	var err error
+	if gid != -1 {
+		if err = syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("set groups: %w", err)
+		}
+		if err = syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("set group: %w", err)
+		}
+	}
+	if uid != -1 {
+		if err = syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("set user: %w", err)
+		}
+		if os.Getuid() != uid || os.Geteuid() != uid {
+			return fmt.Errorf("still running as user %d", os.Geteuid())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// Inode flags set by chattr, as in linux/fs.h.
+const (
+	fsImmutableFl = 0x00000010
+	fsAppendFl    = 0x00000020
+)
+
+// protection describes the attribute which keeps path from being renamed or
+// removed, or returns an empty string if there is none.
+func protection(path string) string {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		// Unreadable files are reported by the file operations themselves.
+		return ""
+	}
+	defer unix.Close(fd)
+	flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		// The filesystem has no inode flags.
+		return ""
+	}
+	switch {
+	case flags&fsImmutableFl != 0:
+		return "immutable"
+	case flags&fsAppendFl != 0:
+		return "append-only"
+	}
+	return ""
+}
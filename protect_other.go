@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package main
+
+// protection can not tell protected files apart on this platform, so they
+// are reported by the file operations themselves.
+func protection(path string) string {
+	return ""
+}
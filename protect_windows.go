@@ -0,0 +1,23 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// protection describes the attribute which keeps path from being renamed or
+// removed, or returns an empty string if there is none.
+func protection(path string) string {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return ""
+	}
+	attrs, err := windows.GetFileAttributes(name)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case attrs&windows.FILE_ATTRIBUTE_SYSTEM != 0:
+		return "system"
+	case attrs&windows.FILE_ATTRIBUTE_READONLY != 0:
+		return "read-only"
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// isReadOnly reports whether dir is on a read-only filesystem.
+func isReadOnly(dir string) bool {
+	return errors.Is(unix.Access(dir, unix.W_OK), unix.EROFS)
+}
+
+// mountPoint returns the mount point of the filesystem holding dir, or dir
+// itself if it is unknown.
+func mountPoint(dir string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return dir
+	}
+	return unix.ByteSliceToString(st.Mntonname[:])
+}
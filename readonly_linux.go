@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// isReadOnly reports whether dir is on a read-only filesystem.
+func isReadOnly(dir string) bool {
+	return errors.Is(unix.Access(dir, unix.W_OK), unix.EROFS)
+}
+
+// mountPoint returns the mount point of the filesystem holding dir, or dir
+// itself if it is unknown.
+func mountPoint(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return dir
+	}
+	defer f.Close()
+
+	best := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mount := fields[4]
+		if (abs == mount || strings.HasPrefix(abs, strings.TrimSuffix(mount, "/")+"/")) &&
+			len(mount) > len(best) {
+			best = mount
+		}
+	}
+	if best == "" {
+		return dir
+	}
+	return best
+}
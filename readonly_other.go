@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+// isReadOnly can not tell read-only filesystems apart on this platform, so
+// they are reported by the file operations themselves.
+func isReadOnly(dir string) bool {
+	return false
+}
+
+func mountPoint(dir string) string {
+	return dir
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// run plans the renames of cfg, and carries them out once reviewed.
+func run(cfg config, pattern *regexp.Regexp) {
+	var cacheKey string
+	if cfg.withConformCache {
+		cacheKey = conformanceKey(cfg.planOptions(pattern))
+		if conformsCached(cacheKey) {
+			fmt.Println("Already conforms, nothing to do (cached).")
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	if cfg.withScanSummary {
+		summary, err := scanTree(cfg.options.path)
+		if err != nil {
+			fmt.Println("scan dir:", err)
+			os.Exit(2)
+		}
+		printScanSummary(summary)
+		if cfg.withInteractive {
+			if !omitter.Confirm(cfg.prompter, "Continue planning?(y/n) ") {
+				fmt.Println("Aborted.")
+				return
+			}
+		}
+	}
+
+	// Prompting needs the whole plan, which is buffered then.
+	if cfg.withStream && !cfg.withInteractive && !cfg.withConfirmEach && !cfg.withTUI {
+		stream(cfg, pattern)
+		return
+	}
+
+	actionName := getActionName(cfg.options.output, cfg.options.transmissionType)
+	p, snap := buildPlan(cfg, pattern, actionName)
+	pairs := p.Pairs
+	if len(pairs) == 0 {
+		// Names only conform if no matched file was skipped on the way.
+		skipped := strictSkips(p.Skipped)
+		if cfg.withConformCache && len(skipped) == 0 {
+			if err := cacheConformance(cacheKey, cfg.options.path); err != nil {
+				fmt.Println("cache conformance:", err)
+			}
+		}
+		updateSnapshot(cfg, snap)
+		if cfg.format == FORMAT_JSON {
+			printReport(planReport(pairs, actionName), cfg.tags)
+			if len(skipped) > 0 {
+				return
+			}
+			os.Exit(exitNothingToDo)
+		}
+		if len(skipped) > 0 {
+			fmt.Printf("Nothing to %s, %d matched file(s) were skipped: %s.\n",
+				actionName, len(skipped), skipCounts(skipped))
+			return
+		}
+		fmt.Println("Already conforms, nothing to do.")
+		os.Exit(exitNothingToDo)
+	}
+
+	pairs, ok := confirmPlan(cfg, pattern, pairs, actionName)
+	if !ok {
+		return
+	}
+	timer := execute(cfg, pairs, actionName)
+	updateSnapshot(cfg, snap)
+	finish(cfg, pairs, actionName, timer)
+}
+
+// confirmPlan shows the plan before it is carried out, as set in cfg, and lets the
+// user confirm or edit it. It returns the pairs to carry out, and false if
+// there are none, as on dry runs.
+func confirmPlan(cfg config, pattern *regexp.Regexp, pairs map[string]string, actionName string,
+) (map[string]string, bool) {
+	var err error
+	if blocked := readOnlyMounts(pairs, actionName); len(blocked) > 0 {
+		for _, b := range blocked {
+			fmt.Println(b)
+		}
+		fmt.Println("Aborted.")
+		os.Exit(2)
+	}
+
+	if cfg.withEstimate {
+		if actionName == omitter.RENAME {
+			fmt.Println("Renaming transfers no data, nothing to estimate.")
+		} else {
+			est, err := estimateTransfer(pairs)
+			if err != nil {
+				fmt.Println("estimate:", err)
+				os.Exit(2)
+			}
+			printEstimate(est)
+		}
+	}
+
+	if cfg.withSummaryDirs {
+		printDirSummary(dirSummary(pairs))
+	}
+
+	if cfg.planOut != "" && isJSONPlan(cfg.planOut) {
+		if err = writeJSONPlan(cfg.planOut, cfg.options.path, actionName, pairs); err != nil {
+			fmt.Println("write plan:", err)
+			os.Exit(2)
+		}
+	} else if cfg.planOut != "" {
+		if err = writePlan(cfg.planOut, cfg.options.path, pairs); err != nil {
+			fmt.Println("write plan:", err)
+			os.Exit(2)
+		}
+	}
+	if cfg.withDryRun && cfg.format == FORMAT_JSON {
+		printReport(planReport(pairs, actionName), cfg.tags)
+		return nil, false
+	}
+	if cfg.withDryRun {
+		fmt.Printf("Found %d file(s) to %s!\n", len(pairs), actionName)
+		switch {
+		case cfg.groupByCapture > 0:
+			printCaptureGroups(pairs, captureGroups(pairs, pattern, cfg.groupByCapture))
+		case cfg.withVerbose:
+			for k, v := range pairs {
+				fmt.Printf("%s -> %s\n", k, v)
+			}
+		}
+		return nil, false
+	}
+	if cfg.withInteractive {
+		question := fmt.Sprintf("Found %d file(s) to %s. Proceed?(y/n) ", len(pairs), actionName)
+		if !omitter.Confirm(cfg.prompter, question) {
+			fmt.Println("Aborted.")
+			return nil, false
+		}
+	}
+
+	if cfg.withConfirmEach {
+		pairs = confirmEach(pairs, cfg.prompter)
+		if len(pairs) == 0 {
+			fmt.Println("Nothing to do.")
+			return nil, false
+		}
+	}
+
+	if cfg.withTUI {
+		var apply bool
+		pairs, apply, err = runReview(pairs, cfg.options.path, matchSpans(pattern, cfg.options.str))
+		if err != nil {
+			fmt.Println("review plan:", err)
+			os.Exit(2)
+		}
+		if !apply {
+			fmt.Println("Aborted.")
+			return nil, false
+		}
+		if len(pairs) == 0 {
+			fmt.Println("Nothing to do.")
+			return nil, false
+		}
+		// Edited names are held to the assertions as well.
+		abortOnViolations(omitter.CheckAssertions(pairs, cfg.assertions))
+	}
+	return pairs, true
+}
+
+// updateSnapshot records the tree as it is after the run for the next
+// -changed-since.
+func updateSnapshot(cfg config, snap snapshot) {
+	if cfg.changedSince == "" || cfg.withDryRun {
+		return
+	}
+	s, err := takeSnapshot(cfg.options.path, snap, journalName, filepath.Base(cfg.changedSince))
+	if err == nil {
+		err = saveSnapshot(cfg.changedSince, s)
+	}
+	if err != nil {
+		fmt.Println("save snapshot:", err)
+		os.Exit(2)
+	}
+}
+
+func canProceed() bool {
+	r := bufio.NewReader(os.Stdin)
+	s, err := r.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// confirmEach asks p about every pair, grouped by directory, and returns the
+// accepted ones. Besides y/n, "a" accepts the rest of the current directory,
+// "A" accepts everything left and "q" rejects everything left.
+func confirmEach(pairs map[string]string, p omitter.Prompter) map[string]string {
+	keys := slices.SortedFunc(maps.Keys(pairs), func(a, b string) int {
+		if c := strings.Compare(filepath.Dir(a), filepath.Dir(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	accepted := make(map[string]string)
+	acceptDir, acceptAll := "", false
+	for i, oldName := range keys {
+		dir := filepath.Dir(oldName)
+		if acceptAll || dir == acceptDir {
+			accepted[oldName] = pairs[oldName]
+			continue
+		}
+
+		s, err := p.Ask(fmt.Sprintf("[%d/%d, %d left] %s -> %s (y/n/a/A/q) ",
+			i+1, len(keys), len(keys)-i-1, oldName, pairs[oldName]))
+		if err != nil && s == "" {
+			break
+		}
+		switch s {
+		case "y", "Y", "yes":
+			accepted[oldName] = pairs[oldName]
+		case "a":
+			accepted[oldName] = pairs[oldName]
+			acceptDir = dir
+		case "A":
+			accepted[oldName] = pairs[oldName]
+			acceptAll = true
+		case "q", "Q":
+			return accepted
+		}
+	}
+	return accepted
+}
+
+// askRemap asks p for the new text of every value of the remapped capture
+// group. Values answered with an empty line are kept.
+func askRemap(values []string, p omitter.Prompter) map[string]string {
+	remap := make(map[string]string)
+	fmt.Printf("Found %d distinct value(s), enter the new text of each or nothing to keep it:\n", len(values))
+	for i, value := range values {
+		s, err := p.Ask(fmt.Sprintf("[%d/%d] %q -> ", i+1, len(values), value))
+		if s != "" {
+			remap[value] = s
+		}
+		if err != nil {
+			break
+		}
+	}
+	return remap
+}
+
+// scanSummary describes the size of a tree.
+type scanSummary struct {
+	files   int
+	dirs    int
+	bytes   int64
+	depth   int
+	exts    map[string]int
+	elapsed time.Duration
+}
+
+func scanTree(root string) (scanSummary, error) {
+	summary := scanSummary{exts: make(map[string]int)}
+	start := time.Now()
+	root = filepath.Clean(root)
+	err := filepath.WalkDir(
+		root,
+		func(path string, file fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if rel != "." {
+				summary.depth = max(summary.depth, strings.Count(rel, string(filepath.Separator))+1)
+			}
+			if file.IsDir() {
+				summary.dirs++
+				return nil
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			summary.files++
+			summary.bytes += info.Size()
+			summary.exts[strings.ToLower(filepath.Ext(path))]++
+			return nil
+		})
+	summary.elapsed = time.Since(start)
+	return summary, err
+}
+
+func printScanSummary(summary scanSummary) {
+	fmt.Printf("Scanned %d file(s) in %d dir(s), %d byte(s), %d level(s) deep.\n",
+		summary.files, summary.dirs, summary.bytes, summary.depth)
+	exts := slices.SortedFunc(maps.Keys(summary.exts), func(a, b string) int {
+		if c := cmp.Compare(summary.exts[b], summary.exts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	for i, ext := range exts {
+		if i == 10 {
+			fmt.Printf("  ... and %d more extension(s)\n", len(exts)-i)
+			break
+		}
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Printf("  %-10s %d\n", name, summary.exts[ext])
+	}
+	// Planning walks the tree once more, so the scan is a fair estimate.
+	fmt.Printf("Estimated planning time: %s.\n", summary.elapsed.Round(time.Millisecond))
+}
+
+// dirSummary counts the files of pairs by the dir they are in.
+func dirSummary(pairs map[string]string) map[string]int {
+	counts := make(map[string]int)
+	for oldName := range pairs {
+		counts[filepath.Dir(oldName)]++
+	}
+	return counts
+}
+
+func printDirSummary(counts map[string]int) {
+	fmt.Printf("Affected %d dir(s):\n", len(counts))
+	for _, dir := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Printf("  %6d  %s\n", counts[dir], dir)
+	}
+}
+
+// captureGroups sorts the files of pairs by the value the group of pattern
+// captures in their name.
+func captureGroups(pairs map[string]string, pattern *regexp.Regexp, group int) map[string][]string {
+	groups := make(map[string][]string)
+	for oldName := range pairs {
+		var value string
+		if m := pattern.FindStringSubmatch(filepath.Base(oldName)); m != nil {
+			value = m[group]
+		}
+		groups[value] = append(groups[value], oldName)
+	}
+	for _, files := range groups {
+		slices.Sort(files)
+	}
+	return groups
+}
+
+func printCaptureGroups(pairs map[string]string, groups map[string][]string) {
+	for _, value := range slices.Sorted(maps.Keys(groups)) {
+		fmt.Printf("%q: %d file(s)\n", value, len(groups[value]))
+		for _, oldName := range groups[value] {
+			fmt.Printf("  %s -> %s\n", oldName, pairs[oldName])
+		}
+	}
+}
+
+// estimateSampleSize is the most data copied to measure the throughput.
+const estimateSampleSize = 32 << 20
+
+// transferEstimate is the predicted cost of copying or moving pairs.
+type transferEstimate struct {
+	bytes     int64
+	rate      float64
+	duration  time.Duration
+	available uint64
+	// availableErr is set if the free space is unknown.
+	availableErr error
+}
+
+// estimateTransfer sums the size of the files of pairs, and measures the
+// throughput by copying a sample of the biggest one next to its target.
+func estimateTransfer(pairs map[string]string) (transferEstimate, error) {
+	var est transferEstimate
+	var biggest, targetDir string
+	var biggestSize int64 = -1
+	for oldName, newName := range pairs {
+		info, err := os.Stat(oldName)
+		if err != nil {
+			return est, fmt.Errorf("get file(%q) info: %w", oldName, err)
+		}
+		est.bytes += info.Size()
+		if info.Size() > biggestSize {
+			biggest, biggestSize = oldName, info.Size()
+			targetDir = filepath.Dir(newName)
+		}
+	}
+	if biggest == "" {
+		return est, nil
+	}
+	est.available, est.availableErr = freeSpace(targetDir)
+
+	in, err := os.Open(biggest)
+	if err != nil {
+		return est, fmt.Errorf("open source file: %w", err)
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(targetDir, ".omitter-estimate-*")
+	if err != nil {
+		return est, fmt.Errorf("create sample file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	start := time.Now()
+	n, err := io.Copy(out, io.LimitReader(in, estimateSampleSize))
+	if err != nil {
+		return est, fmt.Errorf("copy sample: %w", err)
+	}
+	if err = out.Sync(); err != nil {
+		return est, fmt.Errorf("sync sample: %w", err)
+	}
+	elapsed := time.Since(start)
+	if n > 0 && elapsed > 0 {
+		est.rate = float64(n) / elapsed.Seconds()
+		est.duration = time.Duration(float64(est.bytes) / est.rate * float64(time.Second))
+	}
+	return est, nil
+}
+
+func printEstimate(est transferEstimate) {
+	if est.rate > 0 {
+		fmt.Printf("Estimated %s to transfer %d byte(s) at %.1f MB/s.\n",
+			est.duration.Round(time.Second), est.bytes, est.rate/1e6)
+	} else {
+		fmt.Printf("%d byte(s) to transfer.\n", est.bytes)
+	}
+	if est.availableErr != nil {
+		fmt.Println("Free space is unknown:", est.availableErr)
+		return
+	}
+	fmt.Printf("%d byte(s) needed, %d byte(s) available.\n", est.bytes, est.available)
+	if uint64(est.bytes) > est.available {
+		fmt.Println("Warning: not enough free space at the destination.")
+	}
+}
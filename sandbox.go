@@ -0,0 +1,68 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// confine restricts the writes of the watcher to sandboxDirs with -sandbox,
+// and then drops its privileges to -user and -group, so a rule file gone
+// wrong can not touch the rest of the system. Reads are left alone.
+func confine(cfg config) error {
+	uid, gid, groups := -1, -1, []int(nil)
+	if cfg.runUser != "" || cfg.runGroup != "" {
+		var err error
+		if uid, gid, groups, err = lookupPrivileges(cfg.runUser, cfg.runGroup); err != nil {
+			return fmt.Errorf("drop privileges: %w", err)
+		}
+	}
+	if cfg.withSandbox && !sandboxed() {
+		dirs := sandboxDirs(cfg)
+		// The dirs have to exist to be allowed, and could not be made later.
+		// The ones made here are given to the user the watcher drops to.
+		for _, dir := range dirs {
+			if _, err := os.Stat(dir); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("sandbox: %w", err)
+			}
+			if uid != -1 || gid != -1 {
+				if err := os.Lchown(dir, uid, gid); err != nil {
+					return fmt.Errorf("sandbox: %w", err)
+				}
+			}
+		}
+		if err := restrictWrites(dirs); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+	if err := dropPrivileges(uid, gid, groups); err != nil {
+		return fmt.Errorf("drop privileges: %w", err)
+	}
+	return nil
+}
+
+// sandboxDirs returns the absolute dirs the watcher writes to: path dir, and
+// the dirs of -output, -backup, -journal-dir and -watch-events.
+func sandboxDirs(cfg config) []string {
+	dirs := []string{cfg.options.path, cfg.options.output, cfg.backupDir, cfg.journalDir}
+	if cfg.watchEvents != "" {
+		dirs = append(dirs, filepath.Dir(cfg.watchEvents))
+	}
+	var abs []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if a, err := filepath.Abs(dir); err == nil {
+			dir = a
+		}
+		abs = append(abs, filepath.Clean(dir))
+	}
+	slices.SortFunc(abs, cmp.Compare)
+	return slices.Compact(abs)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// landlockWrites are the Landlock rights to change the file system, which
+// are only granted beneath the dirs of restrictWrites.
+const landlockWrites = unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+	unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_SYM | unix.LANDLOCK_ACCESS_FS_REFER
+
+// sandboxedEnv is set for omitter when it is run again by restrictWrites,
+// already confined.
+const sandboxedEnv = "OMITTER_SANDBOXED"
+
+// restrictWrites confines every thread of the process with Landlock, so it
+// can only change files beneath dirs. Version 2 of Landlock is needed, as
+// the first one refuses to move files between dirs.
+func restrictWrites(dirs []string) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return fmt.Errorf("landlock is not available: %w", errno)
+	}
+	if abi < 2 {
+		return errors.New("landlock of this kernel is too old, 5.19 or later is needed")
+	}
+	access := uint64(landlockWrites)
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	attr := unix.LandlockRulesetAttr{Access_fs: access}
+	ruleset, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("create ruleset: %w", errno)
+	}
+	defer unix.Close(int(ruleset))
+
+	for _, dir := range dirs {
+		fd, err := unix.Open(dir, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", dir, err)
+		}
+		rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+		_, _, errno = unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, ruleset,
+			unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+		unix.Close(fd)
+		if errno != 0 {
+			return fmt.Errorf("allow %s: %w", dir, errno)
+		}
+	}
+
+	// Landlock confines the calling thread only, and the runtime has started
+	// others already. Without cgo, they are confined all at once, but with
+	// it, only this thread is, which then runs omitter again in its place,
+	// confined from the start.
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0)
+	if errno == 0 {
+		if _, _, errno = syscall.AllThreadsSyscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+			return fmt.Errorf("restrict: %w", errno)
+		}
+		return nil
+	}
+	if errno != syscall.ENOTSUP {
+		return fmt.Errorf("set no new privileges: %w", errno)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	runtime.LockOSThread()
+	if err = unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no new privileges: %w", err)
+	}
+	if _, _, errno = unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("restrict: %w", errno)
+	}
+	env := append(os.Environ(), sandboxedEnv+"=1")
+	return fmt.Errorf("run confined: %w", syscall.Exec(exe, os.Args, env))
+}
+
+// sandboxed reports whether omitter was run again by restrictWrites, and
+// is confined already.
+func sandboxed() bool {
+	return os.Getenv(sandboxedEnv) != ""
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// restrictWrites unveils the whole file system read only, but for dirs, and
+// pledges the process to what the watcher needs.
+func restrictWrites(dirs []string) error {
+	if err := unix.Unveil("/", "r"); err != nil {
+		return fmt.Errorf("unveil: %w", err)
+	}
+	for _, dir := range dirs {
+		if err := unix.Unveil(dir, "rwc"); err != nil {
+			return fmt.Errorf("unveil %s: %w", dir, err)
+		}
+	}
+	if err := unix.UnveilBlock(); err != nil {
+		return fmt.Errorf("unveil: %w", err)
+	}
+	if err := unix.PledgePromises("stdio rpath wpath cpath fattr chown flock inet dns"); err != nil {
+		return fmt.Errorf("pledge: %w", err)
+	}
+	return nil
+}
+
+// sandboxed reports false, as unveil confines the process in place.
+func sandboxed() bool {
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !openbsd
+
+package main
+
+import "errors"
+
+// restrictWrites fails, as there is no sandbox omitter knows on this
+// platform.
+func restrictWrites(dirs []string) error {
+	return errors.New("-sandbox is only supported on Linux, with Landlock, and on OpenBSD")
+}
+
+// sandboxed reports false, as there is no sandbox on this platform.
+func sandboxed() bool {
+	return false
+}
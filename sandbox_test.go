@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestSandboxDirs verifies that the watcher is let write to path dir and to
+// the dirs of the flags it writes to, each absolute and listed once.
+func TestSandboxDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	var cfg config
+	cfg.options.path = tempDir
+	cfg.options.output = filepath.Join(tempDir, "out")
+	cfg.journalDir = tempDir + string(filepath.Separator)
+	cfg.watchEvents = filepath.Join(tempDir, "logs", "events.csv")
+
+	want := []string{tempDir, filepath.Join(tempDir, "logs"), filepath.Join(tempDir, "out")}
+	if dirs := sandboxDirs(cfg); !slices.Equal(dirs, want) {
+		t.Errorf("expected %v, got %v", want, dirs)
+	}
+
+	cfg = config{}
+	cfg.options.path = "in"
+	dirs := sandboxDirs(cfg)
+	if len(dirs) != 1 || !filepath.IsAbs(dirs[0]) || filepath.Base(dirs[0]) != "in" {
+		t.Errorf("expected path dir made absolute, got %v", dirs)
+	}
+}
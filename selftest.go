@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files of a selftest fixture.
+const (
+	fixtureTree     = "tree.txt"
+	fixtureRules    = "rules.yaml"
+	fixtureExpected = "expected.txt"
+)
+
+// selftest runs the fixtures of a dir, one per subdir: the files listed in
+// tree.txt are created in a temp dir, omitter is run against it with the
+// flags of rules.yaml, a config file, and the resulting tree is compared to
+// the listing of expected.txt.
+func selftest(args []string) {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	fixtures := flags.String("fixtures", "", "dir of fixtures, one per subdir with tree.txt, rules.yaml and expected.txt")
+	withUpdate := flags.Bool("update", false, "write the resulting trees to expected.txt instead of comparing them")
+	withVerbose := flags.Bool("v", false, "print the output of every run, not only of failed ones")
+	flags.Parse(args)
+	if *fixtures == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	entries, err := os.ReadDir(*fixtures)
+	if err != nil {
+		fmt.Println("read fixtures:", err)
+		os.Exit(1)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println("find executable:", err)
+		os.Exit(2)
+	}
+	var total, failed int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		total++
+		diff, output, err := runFixture(exe, filepath.Join(*fixtures, entry.Name()), *withUpdate)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", entry.Name(), err)
+		case len(diff) > 0:
+			failed++
+			fmt.Printf("FAIL %s:\n", entry.Name())
+			for _, line := range diff {
+				fmt.Printf("  %s\n", line)
+			}
+		case *withUpdate:
+			fmt.Printf("updated %s\n", entry.Name())
+		default:
+			fmt.Printf("ok   %s\n", entry.Name())
+		}
+		if len(output) > 0 && (*withVerbose || err != nil || len(diff) > 0) {
+			for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+				fmt.Printf("    | %s\n", line)
+			}
+		}
+	}
+	if total == 0 {
+		fmt.Printf("no fixtures in %q\n", *fixtures)
+		os.Exit(1)
+	}
+	fmt.Printf("%d of %d fixture(s) passed.\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(2)
+	}
+}
+
+// runFixture builds the tree of the fixture at dir, runs exe with its rules
+// against it, and returns how the resulting tree differs from the expected
+// one, along with the output of the run. With update, the resulting tree is
+// written as the expected one instead.
+func runFixture(exe, dir string, update bool) ([]string, []byte, error) {
+	tree, err := readListing(filepath.Join(dir, fixtureTree))
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := os.MkdirTemp("", "omitter-selftest")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(root)
+	if err = buildTree(root, tree); err != nil {
+		return nil, nil, fmt.Errorf("build tree: %w", err)
+	}
+
+	output, err := exec.Command(exe, "-config", filepath.Join(dir, fixtureRules), "-p", root).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == exitNothingToDo {
+		err = nil
+	}
+	if err != nil {
+		return nil, output, fmt.Errorf("run: %w", err)
+	}
+	got, err := listTree(root, journalName)
+	if err != nil {
+		return nil, output, fmt.Errorf("list tree: %w", err)
+	}
+	expected := filepath.Join(dir, fixtureExpected)
+	if update {
+		return nil, output, os.WriteFile(expected, []byte(strings.Join(got, "\n")+"\n"), 0o644)
+	}
+	want, err := readListing(expected)
+	if err != nil {
+		return nil, output, err
+	}
+	return diffListings(want, got), output, nil
+}
+
+// readListing reads a listing of a tree: one slash separated path per line,
+// relative to its root, where dirs end with a slash. Blank lines and lines
+// starting with # are ignored.
+func readListing(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var listing []string
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !fs.ValidPath(strings.TrimSuffix(line, "/")) || line == "/" {
+			return nil, fmt.Errorf("%s:%d: invalid path %q", path, n, line)
+		}
+		listing = append(listing, line)
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(listing)
+	return slices.Compact(listing), nil
+}
+
+// buildTree creates the dirs and the empty files of listing under root.
+func buildTree(root string, listing []string) error {
+	for _, entry := range listing {
+		path := filepath.Join(root, filepath.FromSlash(entry))
+		if strings.HasSuffix(entry, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTree returns the listing of the tree at root, of its files and its
+// empty dirs, except the files named in ignore.
+func listTree(root string, ignore ...string) ([]string, error) {
+	var listing []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !d.IsDir() {
+			if !slices.Contains(ignore, d.Name()) {
+				listing = append(listing, rel)
+			}
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			listing = append(listing, rel+"/")
+		}
+		return nil
+	})
+	slices.Sort(listing)
+	return listing, err
+}
+
+// diffListings returns the paths of want missing from got, prefixed with -,
+// and the paths of got not in want, prefixed with +.
+func diffListings(want, got []string) []string {
+	var diff []string
+	for _, path := range want {
+		if !slices.Contains(got, path) {
+			diff = append(diff, "- "+path)
+		}
+	}
+	for _, path := range got {
+		if !slices.Contains(want, path) {
+			diff = append(diff, "+ "+path)
+		}
+	}
+	return diff
+}
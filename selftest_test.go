@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestSelftestListing verifies that a tree built from a listing is listed
+// back the same, and that listings are diffed both ways.
+func TestSelftestListing(t *testing.T) {
+	dir := t.TempDir()
+	listingPath := filepath.Join(dir, fixtureTree)
+	content := "# photos\nb/IMG_1.jpg\n\na.txt\nempty/\na.txt\n"
+	if err := os.WriteFile(listingPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listing, err := readListing(listingPath)
+	if err != nil {
+		t.Fatalf("read listing error: %v", err)
+	}
+	want := []string{"a.txt", "b/IMG_1.jpg", "empty/"}
+	if !slices.Equal(listing, want) {
+		t.Errorf("expected %v, got %v", want, listing)
+	}
+
+	root := filepath.Join(dir, "root")
+	if err = buildTree(root, listing); err != nil {
+		t.Fatalf("build tree error: %v", err)
+	}
+	createTempFile(t, root, journalName, "")
+	got, err := listTree(root, journalName)
+	if err != nil {
+		t.Fatalf("list tree error: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	diff := diffListings(want, []string{"a.txt", "b/holiday_1.jpg", "empty/"})
+	if !slices.Equal(diff, []string{"- b/IMG_1.jpg", "+ b/holiday_1.jpg"}) {
+		t.Errorf("unexpected diff %v", diff)
+	}
+
+	if err = os.WriteFile(listingPath, []byte("../escape.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readListing(listingPath); err == nil {
+		t.Error("expected an error for a path outside the tree")
+	}
+}
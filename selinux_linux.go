@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// selinuxXattr holds the SELinux security context of a file.
+const selinuxXattr = "security.selinux"
+
+// preserveSELinux gives dst the SELinux context of src. A copy would
+// otherwise get the default context of its new dir, which may deny access to
+// the services using the file.
+func preserveSELinux(src, dst string) error {
+	label, err := getXattr(src, selinuxXattr)
+	if err != nil {
+		if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+			// Either unlabeled, or SELinux is not in use.
+			return nil
+		}
+		return err
+	}
+	if err = setXattr(dst, selinuxXattr, label); err != nil && !errors.Is(err, unix.ENOTSUP) {
+		return err
+	}
+	return nil
+}
+
+// restorecon resets the SELinux context of dst to the default of the policy
+// for its new path.
+func restorecon(_, dst string) error {
+	out, err := exec.Command("restorecon", dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("restorecon: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// preserveSELinux does nothing, as SELinux is only found on linux.
+func preserveSELinux(src, dst string) error {
+	return nil
+}
+
+func restorecon(src, dst string) error {
+	return errors.New("restorecon is only supported on linux")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Scopes of the services of service install, on Linux.
+const (
+	SCOPE_SYSTEM string = "system"
+	SCOPE_USER   string = "user"
+)
+
+// serviceContext is done once the service manager asks the watcher to stop,
+// on Windows, where services are not sent signals.
+var serviceContext, stopService = context.WithCancel(context.Background())
+
+// validServiceName matches the names services can be given, which are the
+// names of systemd units as well.
+var validServiceName = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// pathFlags are the flags of a run whose values are paths, which are made
+// absolute for services, as they do not run in the current dir.
+var pathFlags = []string{
+	"p", "config", "output", "dict", "backup", "journal-dir", "watch-events", "sign-key",
+}
+
+// service describes a watcher to be run by the service manager.
+type service struct {
+	name  string
+	scope string
+	// exe is the absolute path of omitter, and args the flags of the run.
+	exe  string
+	args []string
+}
+
+// serviceCommand registers the watcher as a systemd unit or a Windows
+// service, removes it, or tells its status, by the first of args:
+//
+//	omitter service install [-name NAME] [-scope system|user] -- -p DIR ...
+//	omitter service uninstall|status [-name NAME] [-scope system|user]
+//
+// The flags after -- are the flags of the run, to which -watch is added.
+func serviceCommand(args []string) {
+	if len(args) == 0 || !slices.Contains([]string{"install", "uninstall", "status"}, args[0]) {
+		fmt.Println("usage: omitter service install|uninstall|status [-name NAME] [-scope system|user] [-- RUN FLAGS]")
+		os.Exit(1)
+	}
+	command := args[0]
+	flags := flag.NewFlagSet("service "+command, flag.ExitOnError)
+	name := flags.String("name", "omitter", "name of the service")
+	scope := flags.String("scope", SCOPE_SYSTEM, "on Linux, install a system unit, or a unit of the current user")
+	flags.Parse(args[1:])
+	if !validServiceName.MatchString(*name) || *scope != SCOPE_SYSTEM && *scope != SCOPE_USER {
+		flags.Usage()
+		os.Exit(1)
+	}
+	s := service{name: *name, scope: *scope}
+
+	var err error
+	switch command {
+	case "install":
+		if flags.NArg() == 0 {
+			fmt.Println("service install needs the flags of the run after --, such as -- -p /srv/inbox -s _draft")
+			os.Exit(1)
+		}
+		if s.exe, err = os.Executable(); err == nil {
+			s.args, err = serviceArgs(flags.Args())
+		}
+		if err != nil {
+			fmt.Println("service install:", err)
+			os.Exit(1)
+		}
+		if err = installService(s); err != nil {
+			fmt.Println("service install:", err)
+			os.Exit(2)
+		}
+		fmt.Printf("Installed and started the %s service.\n", s.name)
+	case "uninstall":
+		if err = uninstallService(s); err != nil {
+			fmt.Println("service uninstall:", err)
+			os.Exit(2)
+		}
+		fmt.Printf("Stopped and removed the %s service.\n", s.name)
+	case "status":
+		status, err := serviceStatus(s)
+		if err != nil {
+			fmt.Println("service status:", err)
+			os.Exit(2)
+		}
+		fmt.Printf("%s: %s\n", s.name, status)
+	}
+}
+
+// serviceArgs returns the flags of a run as a service: with -watch, and the
+// values of pathFlags made absolute.
+func serviceArgs(args []string) ([]string, error) {
+	args = slices.Clone(args)
+	watching := false
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if name == "watch" {
+			watching = true
+		}
+		if !slices.Contains(pathFlags, name) {
+			continue
+		}
+		if !hasValue {
+			i++
+			if i == len(args) {
+				return nil, fmt.Errorf("flag -%s needs a value", name)
+			}
+			value = args[i]
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, err
+		}
+		if hasValue {
+			args[i] = "-" + name + "=" + abs
+		} else {
+			args[i] = abs
+		}
+	}
+	if !watching {
+		args = append([]string{"-watch"}, args...)
+	}
+	return args, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitPath returns the path of the systemd unit of s.
+func unitPath(s service) (string, error) {
+	dir := "/etc/systemd/system"
+	if s.scope == SCOPE_USER {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(config, "systemd", "user")
+	}
+	return filepath.Join(dir, s.name+".service"), nil
+}
+
+// systemdUnit returns the unit running the watcher of s, restarted if it
+// fails.
+func systemdUnit(s service) string {
+	words := []string{systemdQuote(s.exe)}
+	for _, arg := range s.args {
+		words = append(words, systemdQuote(arg))
+	}
+	target := "multi-user.target"
+	if s.scope == SCOPE_USER {
+		target = "default.target"
+	}
+	return fmt.Sprintf(`[Unit]
+Description=omitter watcher %s
+After=local-fs.target network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=%s
+`, s.name, strings.Join(words, " "), target)
+}
+
+// systemdQuote quotes s as a word of a command line of a unit, where % starts
+// specifiers and $ variables.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+// systemctl runs systemctl with args in the scope of s, and returns its
+// output.
+func systemctl(s service, args ...string) (string, error) {
+	if s.scope == SCOPE_USER {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// installService writes the unit of s, then enables and starts it.
+func installService(s service) error {
+	path, err := unitPath(s)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); err == nil {
+		return fmt.Errorf("%q exists already, uninstall it first", path)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, []byte(systemdUnit(s)), 0o644); err != nil {
+		return err
+	}
+	if _, err = systemctl(s, "daemon-reload"); err != nil {
+		return err
+	}
+	_, err = systemctl(s, "enable", "--now", s.name+".service")
+	return err
+}
+
+// uninstallService stops and disables the unit of s, and removes it.
+func uninstallService(s service) error {
+	path, err := unitPath(s)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s is not installed", s.name)
+	}
+	if _, err = systemctl(s, "disable", "--now", s.name+".service"); err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		return err
+	}
+	_, err = systemctl(s, "daemon-reload")
+	return err
+}
+
+// serviceStatus tells whether the unit of s is installed, enabled and
+// running.
+func serviceStatus(s service) (string, error) {
+	path, err := unitPath(s)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "not installed", nil
+	}
+	// is-enabled and is-active exit with 1 and 3 for disabled and inactive
+	// units, with their state as output all the same.
+	state := func(query string) string {
+		args := []string{query, s.name + ".service"}
+		if s.scope == SCOPE_USER {
+			args = append([]string{"--user"}, args...)
+		}
+		out, _ := exec.Command("systemctl", args...).Output()
+		return strings.TrimSpace(string(out))
+	}
+	return fmt.Sprintf("%s, %s, unit %s", state("is-enabled"), state("is-active"), path), nil
+}
+
+// serveWatch runs the watcher, which systemd stops with SIGTERM like any
+// process.
+func serveWatch(watch func()) {
+	watch()
+}
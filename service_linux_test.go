@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSystemdUnit verifies that the unit runs omitter with its flags quoted,
+// and that user units are wanted by the session of the user.
+func TestSystemdUnit(t *testing.T) {
+	s := service{
+		name: "inbox", scope: SCOPE_SYSTEM, exe: "/usr/local/bin/omitter",
+		args: []string{"-watch", "-p", "/srv/my inbox", "-template", "{date:%Y}$HOME\"x\""},
+	}
+	unit := systemdUnit(s)
+	want := `ExecStart="/usr/local/bin/omitter" "-watch" "-p" "/srv/my inbox" "-template" "{date:%%Y}$$HOME\"x\""`
+	if !strings.Contains(unit, want+"\n") {
+		t.Errorf("expected %q in the unit, got:\n%s", want, unit)
+	}
+	if !strings.Contains(unit, "WantedBy=multi-user.target") {
+		t.Errorf("expected a system unit, got:\n%s", unit)
+	}
+	s.scope = SCOPE_USER
+	if unit = systemdUnit(s); !strings.Contains(unit, "WantedBy=default.target") {
+		t.Errorf("expected a user unit, got:\n%s", unit)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+// errNoServiceManager is returned where omitter does not know the service
+// manager, such as launchd.
+var errNoServiceManager = errors.New("services are only supported with systemd and on Windows")
+
+func installService(service) error {
+	return errNoServiceManager
+}
+
+func uninstallService(service) error {
+	return errNoServiceManager
+}
+
+func serviceStatus(service) (string, error) {
+	return "", errNoServiceManager
+}
+
+func serveWatch(watch func()) {
+	watch()
+}
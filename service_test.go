@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestServiceArgs verifies that services watch, with the paths of their
+// flags made absolute, in both forms of flags.
+func TestServiceArgs(t *testing.T) {
+	abs := func(path string) string {
+		t.Helper()
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return abs
+	}
+	got, err := serviceArgs([]string{"-p", "inbox", "-s", "_draft", "--config=rules.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-watch", "-p", abs("inbox"), "-s", "_draft", "-config=" + abs("rules.yaml")}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, err = serviceArgs([]string{"-watch", "-s", "x"}); err != nil || got[0] != "-watch" || len(got) != 3 {
+		t.Errorf("expected -watch to be kept once, got %q (%v)", got, err)
+	}
+	if _, err = serviceArgs([]string{"-s", "x", "-p"}); err == nil {
+		t.Error("expected an error for a path flag without a value")
+	}
+}
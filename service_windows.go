@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStates names the states of services.
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "starting",
+	svc.StopPending:     "stopping",
+	svc.Running:         "running",
+	svc.ContinuePending: "resuming",
+	svc.PausePending:    "pausing",
+	svc.Paused:          "paused",
+}
+
+// installService registers s as a service started with Windows, and starts
+// it. Services of the user scope do not exist on Windows.
+func installService(s service) error {
+	if s.scope == SCOPE_USER {
+		return fmt.Errorf("services can only be installed for the system on Windows")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if existing, err := m.OpenService(s.name); err == nil {
+		existing.Close()
+		return fmt.Errorf("%s exists already, uninstall it first", s.name)
+	}
+	ws, err := m.CreateService(s.name, s.exe, mgr.Config{
+		DisplayName: s.name,
+		Description: "omitter watcher " + strings.Join(s.args, " "),
+		StartType:   mgr.StartAutomatic,
+	}, s.args...)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	return ws.Start()
+}
+
+// uninstallService stops the service of s, and removes it.
+func uninstallService(s service) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	ws, err := m.OpenService(s.name)
+	if err != nil {
+		return fmt.Errorf("%s is not installed: %w", s.name, err)
+	}
+	defer ws.Close()
+	status, err := ws.Control(svc.Stop)
+	for err == nil && status.State != svc.Stopped {
+		time.Sleep(100 * time.Millisecond)
+		status, err = ws.Query()
+	}
+	return ws.Delete()
+}
+
+// serviceStatus tells whether the service of s is installed and running.
+func serviceStatus(s service) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer m.Disconnect()
+	ws, err := m.OpenService(s.name)
+	if err != nil {
+		return "not installed", nil
+	}
+	defer ws.Close()
+	status, err := ws.Query()
+	if err != nil {
+		return "", err
+	}
+	return serviceStates[status.State], nil
+}
+
+// serveWatch runs the watcher, under the service manager if it started the
+// process, which asks services to stop rather than interrupt them.
+func serveWatch(watch func()) {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		watch()
+		return
+	}
+	if err := svc.Run("", watchHandler{watch: watch}); err != nil {
+		fmt.Println("run service:", err)
+		os.Exit(2)
+	}
+}
+
+// watchHandler runs the watcher as a service.
+type watchHandler struct {
+	watch func()
+}
+
+func (h watchHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.watch()
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stopService()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
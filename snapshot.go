@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// snapshotEntry is the state of a file when the snapshot was taken.
+type snapshotEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+}
+
+// snapshot maps the paths of a tree, relative to its root, to the state of
+// their files.
+type snapshot map[string]snapshotEntry
+
+// loadSnapshot reads the snapshot at path. A missing file is an empty
+// snapshot, in which every file counts as changed.
+func loadSnapshot(path string) (snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return snapshot{}, nil
+		}
+		return nil, err
+	}
+	var s snapshot
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse snapshot(%q): %w", path, err)
+	}
+	return s, nil
+}
+
+// unchanged returns the paths under root of which the size and the hash are
+// the same as in the snapshot.
+func (s snapshot) unchanged(root string, paths []string) (map[string]bool, error) {
+	same := make(map[string]bool)
+	for _, path := range paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		entry, ok := s[filepath.ToSlash(rel)]
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		// Only files of the same size are worth hashing.
+		if info.Size() != entry.Size {
+			continue
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if hash == entry.Hash {
+			same[path] = true
+		}
+	}
+	return same, nil
+}
+
+// takeSnapshot records the files under root, except the ones named in
+// ignore. Hashes of files with the same path, size and modification time as
+// in prev are taken from it instead of reading the files again.
+func takeSnapshot(root string, prev snapshot, ignore ...string) (snapshot, error) {
+	s := make(snapshot)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || slices.Contains(ignore, d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry := snapshotEntry{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		if old, ok := prev[rel]; ok && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) {
+			entry.Hash = old.Hash
+		} else if entry.Hash, err = hashFile(path); err != nil {
+			return err
+		}
+		s[rel] = entry
+		return nil
+	})
+	return s, err
+}
+
+func saveSnapshot(path string, s snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	return os.WriteFile(path, b, 0o644)
+}
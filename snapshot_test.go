@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSnapshotUnchanged verifies that only files of the same size and hash as
+// in the snapshot are reported as unchanged, and that a saved snapshot is
+// loaded back.
+func TestSnapshotUnchanged(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	same := createTempFile(t, dir, "same.txt", "abc")
+	edited := createTempFile(t, dir, "edited.txt", "abc")
+	grown := createTempFile(t, dir, "grown.txt", "abc")
+	createTempFile(t, dir, journalName, "{}")
+
+	snapPath := filepath.Join(t.TempDir(), "snapshot.json")
+	snap, err := loadSnapshot(snapPath)
+	if err != nil || len(snap) != 0 {
+		t.Fatalf("expected an empty snapshot, got %v, %v", snap, err)
+	}
+	snap, err = takeSnapshot(dir, snap, journalName)
+	if err != nil {
+		t.Fatalf("take snapshot error: %v", err)
+	}
+	if len(snap) != 3 {
+		t.Errorf("expected 3 files, got %v", snap)
+	}
+	if err = saveSnapshot(snapPath, snap); err != nil {
+		t.Fatalf("save snapshot error: %v", err)
+	}
+	if snap, err = loadSnapshot(snapPath); err != nil {
+		t.Fatalf("load snapshot error: %v", err)
+	}
+
+	createTempFile(t, dir, "edited.txt", "xyz")
+	createTempFile(t, dir, "grown.txt", "abcd")
+	added := createTempFile(t, dir, "added.txt", "abc")
+	unchanged, err := snap.unchanged(dir, []string{same, edited, grown, added})
+	if err != nil {
+		t.Fatalf("compare snapshot error: %v", err)
+	}
+	if len(unchanged) != 1 || !unchanged[same] {
+		t.Errorf("expected only %s unchanged, got %v", same, unchanged)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+func syncNames(args []string) {
+	flags := flag.NewFlagSet("sync-names", flag.ExitOnError)
+	source := flags.String("source", "", "replica with the names to mirror")
+	mirror := flags.String("mirror", "", "replica to rename")
+	withDryRun := flags.Bool("d", false, "dry run")
+	withVerbose := flags.Bool("v", false, "verbose")
+	flags.Parse(args)
+	if *source == "" || *mirror == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	pairs, err := mirrorPairs(*source, *mirror)
+	if err != nil {
+		fmt.Println("match replicas:", err)
+		os.Exit(2)
+	}
+	if *withDryRun {
+		fmt.Printf("Found %d file(s) to rename!\n", len(pairs))
+		if *withVerbose {
+			for k, v := range pairs {
+				fmt.Printf("%s -> %s\n", k, v)
+			}
+		}
+		return
+	}
+
+	start := time.Now()
+	for _, newName := range pairs {
+		if err = os.MkdirAll(filepath.Dir(newName), 0o755); err != nil {
+			fmt.Println("create dir:", err)
+			os.Exit(2)
+		}
+	}
+	n, err := omitter.Rename(pairs, omitter.ExecOptions{})
+	if err != nil {
+		fmt.Println("Renaming:", err)
+		fmt.Printf("%d file(s) were renamed.\n", n)
+		os.Exit(2)
+	}
+	if *withVerbose {
+		fmt.Printf("Renamed %d file(s) in %s.\n", n, time.Since(start))
+	}
+}
+
+// mirrorPairs matches the files of mirror with the files of source by content
+// hash, and maps every mirrored file whose relative path differs to the path
+// it has in source. Contents appearing more than once in source are ambiguous
+// and left alone, as are targets which already exist in mirror.
+func mirrorPairs(source, mirror string) (map[string]string, error) {
+	sizes := make(map[int64]bool)
+	names := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	err := filepath.WalkDir(
+		source,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case !file.Type().IsRegular():
+				return nil
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			if _, ok := names[sum]; ok {
+				ambiguous[sum] = true
+			}
+			rel, err := filepath.Rel(source, path)
+			if err != nil {
+				return err
+			}
+			names[sum] = rel
+			sizes[info.Size()] = true
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("walk source: %w", err)
+	}
+
+	pairs := make(map[string]string)
+	taken := make(map[string]bool)
+	err = filepath.WalkDir(
+		mirror,
+		func(path string, file fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case !file.Type().IsRegular():
+				return nil
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			if !sizes[info.Size()] {
+				return nil
+			}
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			rel, ok := names[sum]
+			if !ok || ambiguous[sum] {
+				return nil
+			}
+			newPath := filepath.Join(mirror, rel)
+			if newPath == path || taken[newPath] {
+				return nil
+			}
+			if _, err := os.Lstat(newPath); err == nil {
+				return nil
+			}
+			taken[newPath] = true
+			pairs[path] = newPath
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("walk mirror: %w", err)
+	}
+	return pairs, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash file(%q): %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
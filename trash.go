@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// trashOverwritten moves the files which carrying out pairs with actionName
+// would overwrite to the trash of the OS, if the conflict policy lets the
+// run overwrite files, unless -no-trash is set, so they can be restored from
+// there. Files which are processed themselves, such as copies onto files
+// which are copied too, are left in place. It returns the path in the trash
+// of every file moved there, even if it fails.
+func trashOverwritten(cfg config, pairs map[string]string, actionName string) (map[string]string, error) {
+	trashed := make(map[string]string)
+	if cfg.withNoTrash || !overwrites(cfg) {
+		return trashed, nil
+	}
+	for _, path := range overwrittenFiles(pairs, actionName) {
+		dest, err := trashFile(path)
+		if err != nil {
+			return trashed, fmt.Errorf("%q: %w", path, err)
+		}
+		trashed[path] = dest
+	}
+	if cfg.withVerbose {
+		for _, path := range slices.Sorted(maps.Keys(trashed)) {
+			fmt.Printf("Moved %s to the trash at %s\n", path, trashed[path])
+		}
+	}
+	return trashed, nil
+}
+
+// overwrites reports whether the conflict policy of cfg lets runs overwrite
+// files: -on-conflict overwrite, or the policies asking whether to.
+func overwrites(cfg config) bool {
+	switch cfg.options.onConflict {
+	case omitter.CONFLICT_OVERWRITE, omitter.CONFLICT_PROMPT, omitter.CONFLICT_ASK_PER_DIR:
+		return true
+	default:
+		return false
+	}
+}
+
+// restoreTrashed moves the files of trashed, as returned by
+// trashOverwritten, back from the trash, once a rolled back run freed their
+// paths again.
+func restoreTrashed(trashed map[string]string) error {
+	var errs []error
+	for _, path := range slices.Sorted(maps.Keys(trashed)) {
+		if _, err := os.Lstat(path); err == nil {
+			errs = append(errs, fmt.Errorf("%q is taken, restore it from %s", path, trashed[path]))
+			continue
+		}
+		if err := untrashFile(path, trashed[path]); err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// numbered returns name for n of zero, and name.n otherwise, for picking free
+// names in the trash.
+func numbered(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, n)
+}
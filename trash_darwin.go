@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// trashFile moves the file at path to ~/.Trash, or to the .Trashes dir of
+// its volume if it is on another one, as Finder does. It returns the new path
+// of the file.
+func trashFile(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	trash := filepath.Join(home, ".Trash")
+	if !sameFileSystem(abs, home) {
+		trash = filepath.Join(mountPoint(filepath.Dir(abs)), ".Trashes", strconv.Itoa(os.Getuid()))
+	}
+	if err = os.MkdirAll(trash, 0o700); err != nil {
+		return "", fmt.Errorf("create trash: %w", err)
+	}
+	for n := 0; ; n++ {
+		dest := filepath.Join(trash, numbered(filepath.Base(abs), n))
+		if _, err = os.Lstat(dest); errors.Is(err, os.ErrNotExist) {
+			return dest, os.Rename(abs, dest)
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// untrashFile moves the file which trashFile moved to dest back to path.
+func untrashFile(path, dest string) error {
+	return os.Rename(dest, path)
+}
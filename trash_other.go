@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+// trashFile fails, as there is no trash on this platform. Use -no-trash.
+func trashFile(path string) (string, error) {
+	return "", errors.New("no trash on this platform, use -no-trash")
+}
+
+// untrashFile fails, as there is no trash on this platform.
+func untrashFile(path, dest string) error {
+	return errors.New("no trash on this platform")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// TestTrashFile verifies that trashed files keep their name, numbered if it
+// is taken in the trash, along with the path they are restored to.
+func TestTrashFile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the trash of the user is only redirected on linux")
+	}
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	tempDir := t.TempDir()
+
+	for i, want := range []string{"a b.txt", "a b.txt.1"} {
+		path := createTempFile(t, tempDir, "a b.txt", "dummy")
+		dest, err := trashFile(path)
+		if err != nil {
+			t.Fatalf("trash %d: %v", i, err)
+		}
+		if dest != filepath.Join(data, "Trash", "files", want) {
+			t.Errorf("expected %s in the trash, got %s", want, dest)
+		}
+		if _, err = os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved away, got %v", path, err)
+		}
+		info, err := os.ReadFile(filepath.Join(data, "Trash", "info", want+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(info), "\nPath="+strings.ReplaceAll(path, " ", "%20")+"\n") {
+			t.Errorf("expected the trash info to point to %s, got %q", path, info)
+		}
+	}
+}
+
+// TestTrashOverwritten verifies that only the existing files which would be
+// replaced are moved to the trash, under a policy which overwrites files,
+// none with -no-trash, and that they can be restored from there.
+func TestTrashOverwritten(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the trash of the user is only redirected on linux")
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tempDir := t.TempDir()
+	a := createTempFile(t, tempDir, "a.txt", "a")
+	b := createTempFile(t, tempDir, "b.txt", "b")
+	c := createTempFile(t, tempDir, "c.txt", "c")
+	pairs := map[string]string{a: b, b: c}
+
+	var cfg config
+	cfg.options.onConflict = omitter.CONFLICT_OVERWRITE
+	for _, cfg := range []config{{withNoTrash: true, options: cfg.options}, {}} {
+		if _, err := trashOverwritten(cfg, pairs, omitter.RENAME); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(c); err != nil {
+			t.Errorf("did not expect %s to be trashed with %+v: %v", c, cfg, err)
+		}
+	}
+	trashed, err := trashOverwritten(cfg, pairs, omitter.RENAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(c); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be trashed, got %v", c, err)
+	}
+	if _, err := os.Lstat(b); err != nil {
+		t.Errorf("did not expect %s, which is renamed itself, to be trashed: %v", b, err)
+	}
+
+	if err = restoreTrashed(trashed); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+	if content, err := os.ReadFile(c); err != nil || string(content) != "c" {
+		t.Errorf("expected %s to be restored, got %q (%v)", c, content, err)
+	}
+	info := filepath.Join(filepath.Dir(filepath.Dir(trashed[c])), "info", filepath.Base(trashed[c])+".trashinfo")
+	if _, err := os.Lstat(info); !os.IsNotExist(err) {
+		t.Errorf("expected the trash info of %s to be removed, got %v", c, err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import "os"
+
+// sameFileSystem reports whether a and b are on the same file system.
+func sameFileSystem(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	devA, _, _, okA := fileID(infoA)
+	devB, _, _, okB := fileID(infoB)
+	return okA && okB && devA == devB
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+var procSHFileOperation = windows.NewLazySystemDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// shFileOpStruct is SHFILEOPSTRUCTW. It is packed on 32-bit Windows, which
+// only moves the fields after fFlags, all of them left zero.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// trashFile moves the file at path to the Recycle Bin, from where Explorer
+// can restore it. The Recycle Bin does not tell where the file went, so the
+// returned path is always "Recycle Bin".
+func trashFile(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// pFrom is a list of paths, terminated by an extra null.
+	from, err := windows.UTF16FromString(abs)
+	if err != nil {
+		return "", err
+	}
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &append(from, 0)[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	if r, _, _ := procSHFileOperation.Call(uintptr(unsafe.Pointer(&op))); r != 0 {
+		return "", fmt.Errorf("move to the Recycle Bin: error 0x%x", r)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return "", fmt.Errorf("moving to the Recycle Bin was aborted")
+	}
+	return "Recycle Bin", nil
+}
+
+// untrashFile fails, as the Recycle Bin does not tell where trashFile moved
+// the file. It has to be restored from Explorer.
+func untrashFile(path, dest string) error {
+	return errors.New("restore it from the Recycle Bin")
+}
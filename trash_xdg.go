@@ -0,0 +1,120 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// trashFile moves the file at path to the trash of the freedesktop.org
+// specification, with a .trashinfo file recording where it was, so file
+// managers can restore it. Files on other file systems than the home dir are
+// moved to the trash dir at the top of theirs. It returns the new path of
+// the file.
+func trashFile(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	trash, err := homeTrash()
+	if err != nil {
+		return "", err
+	}
+	// The home trash records absolute paths, the others paths relative to
+	// the top dir of their file system.
+	origin := abs
+	if !sameFileSystem(abs, trash) {
+		top := mountPoint(filepath.Dir(abs))
+		if trash, err = topTrash(top); err != nil {
+			return "", err
+		}
+		if origin, err = filepath.Rel(top, abs); err != nil {
+			return "", err
+		}
+	}
+	for _, dir := range []string{"files", "info"} {
+		if err = os.MkdirAll(filepath.Join(trash, dir), 0o700); err != nil {
+			return "", fmt.Errorf("create trash: %w", err)
+		}
+	}
+
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: origin}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	for n := 0; ; n++ {
+		name := numbered(filepath.Base(abs), n)
+		dest := filepath.Join(trash, "files", name)
+		if _, err = os.Lstat(dest); err == nil {
+			continue
+		}
+		// The info file is created exclusively first, which reserves the
+		// name against other programs trashing at the same time.
+		infoPath := filepath.Join(trash, "info", name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("write trash info: %w", err)
+		}
+		_, err = f.WriteString(info)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err == nil {
+			err = os.Rename(abs, dest)
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// untrashFile moves the file which trashFile moved to dest back to path, and
+// removes its .trashinfo file.
+func untrashFile(path, dest string) error {
+	if err := os.Rename(dest, path); err != nil {
+		return err
+	}
+	info := filepath.Join(filepath.Dir(filepath.Dir(dest)), "info", filepath.Base(dest)+".trashinfo")
+	if err := os.Remove(info); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove trash info: %w", err)
+	}
+	return nil
+}
+
+// homeTrash returns the trash dir of the user, creating it if needed.
+func homeTrash() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	trash := filepath.Join(data, "Trash")
+	if err := os.MkdirAll(trash, 0o700); err != nil {
+		return "", fmt.Errorf("create trash: %w", err)
+	}
+	return trash, nil
+}
+
+// topTrash returns the trash dir of the user at top: .Trash/$uid if the
+// admin set up a shared .Trash dir with the sticky bit, which is not a
+// symlink, or .Trash-$uid otherwise.
+func topTrash(top string) (string, error) {
+	uid := strconv.Itoa(os.Getuid())
+	shared := filepath.Join(top, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		return filepath.Join(shared, uid), nil
+	}
+	return filepath.Join(top, ".Trash-"+uid), nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Keys of the review, besides the printable ones.
+const (
+	KEY_UP        string = "up"
+	KEY_DOWN      string = "down"
+	KEY_PAGE_UP   string = "pgup"
+	KEY_PAGE_DOWN string = "pgdn"
+	KEY_HOME      string = "home"
+	KEY_END       string = "end"
+	KEY_ENTER     string = "enter"
+	KEY_ESC       string = "esc"
+	KEY_BACKSPACE string = "backspace"
+	KEY_CTRL_C    string = "ctrl-c"
+)
+
+// ANSI escape sequences of the review screen.
+const (
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l"
+	ansiMainScreen = "\x1b[?25h\x1b[?1049l"
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiHighlight  = "\x1b[1;33m"
+	ansiInverse    = "\x1b[7m"
+	ansiReset      = "\x1b[0m"
+)
+
+const reviewHelp = "↑/↓ move  space toggle  a toggle all  e edit  enter apply  q quit"
+
+// reviewItem is a file of the plan under review.
+type reviewItem struct {
+	oldName, newName string
+	selected         bool
+}
+
+// review is the state of -tui: the plan in a scrollable list, of which files
+// can be left out and new names edited before it is applied.
+type review struct {
+	items []reviewItem
+	root  string
+	// matches returns the spans of the matched text in a name.
+	matches func(name string) [][]int
+	cursor  int
+	offset  int
+	// page is the number of rows of the list, as last rendered.
+	page    int
+	editing bool
+	input   []rune
+	status  string
+}
+
+func newReview(pairs map[string]string, root string, matches func(name string) [][]int) *review {
+	r := &review{root: root, matches: matches, page: 1}
+	for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+		r.items = append(r.items, reviewItem{oldName: oldName, newName: pairs[oldName], selected: true})
+	}
+	return r
+}
+
+// matchSpans returns the matches func of review highlighting matches of
+// pattern, or of str if pattern is nil.
+func matchSpans(pattern *regexp.Regexp, str string) func(name string) [][]int {
+	return func(name string) [][]int {
+		if pattern != nil {
+			return pattern.FindAllStringIndex(name, -1)
+		}
+		var spans [][]int
+		for i := 0; str != "" && i <= len(name); {
+			j := strings.Index(name[i:], str)
+			if j < 0 {
+				break
+			}
+			spans = append(spans, []int{i + j, i + j + len(str)})
+			i += j + len(str)
+		}
+		return spans
+	}
+}
+
+// selectedPairs returns the pairs of the selected files, with their edited
+// names.
+func (r *review) selectedPairs() map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range r.items {
+		if item.selected {
+			pairs[item.oldName] = item.newName
+		}
+	}
+	return pairs
+}
+
+// handle applies key to r, and reports whether the review is over, and if
+// so whether the plan is applied.
+func (r *review) handle(key string) (done, apply bool) {
+	if r.editing {
+		r.handleEdit(key)
+		return false, false
+	}
+	r.status = ""
+	switch key {
+	case KEY_UP, "k":
+		r.cursor--
+	case KEY_DOWN, "j":
+		r.cursor++
+	case KEY_PAGE_UP:
+		r.cursor -= r.page
+	case KEY_PAGE_DOWN:
+		r.cursor += r.page
+	case KEY_HOME, "g":
+		r.cursor = 0
+	case KEY_END, "G":
+		r.cursor = len(r.items) - 1
+	case " ":
+		r.items[r.cursor].selected = !r.items[r.cursor].selected
+	case "a":
+		all := !slices.ContainsFunc(r.items, func(item reviewItem) bool { return !item.selected })
+		for i := range r.items {
+			r.items[i].selected = !all
+		}
+	case "e":
+		r.editing = true
+		r.input = []rune(filepath.Base(r.items[r.cursor].newName))
+	case KEY_ENTER:
+		if err := checkOverwrites(r.selectedPairs()); err != nil {
+			r.status = err.Error()
+			return false, false
+		}
+		return true, true
+	case "q", KEY_ESC, KEY_CTRL_C:
+		return true, false
+	}
+	r.cursor = max(0, min(r.cursor, len(r.items)-1))
+	return false, false
+}
+
+func (r *review) handleEdit(key string) {
+	switch key {
+	case KEY_ENTER:
+		name := string(r.input)
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			r.status = fmt.Sprintf("invalid name: %q", name)
+			return
+		}
+		item := &r.items[r.cursor]
+		item.newName = filepath.Join(filepath.Dir(item.newName), name)
+		r.editing, r.status = false, ""
+	case KEY_ESC, KEY_CTRL_C:
+		r.editing, r.status = false, ""
+	case KEY_BACKSPACE:
+		if len(r.input) > 0 {
+			r.input = r.input[:len(r.input)-1]
+		}
+	default:
+		if runes := []rune(key); len(runes) == 1 {
+			r.input = append(r.input, runes[0])
+		}
+	}
+}
+
+// render draws r on a screen of width columns and height rows.
+func (r *review) render(w io.Writer, width, height int) {
+	r.page = max(1, height-2)
+	if r.cursor < r.offset {
+		r.offset = r.cursor
+	}
+	if r.cursor >= r.offset+r.page {
+		r.offset = r.cursor - r.page + 1
+	}
+
+	selected := len(r.selectedPairs())
+	fmt.Fprint(w, ansiClear)
+	fmt.Fprint(w, clip(fmt.Sprintf("%d of %d file(s) selected", selected, len(r.items)), width), "\r\n")
+	for i := r.offset; i < min(r.offset+r.page, len(r.items)); i++ {
+		fmt.Fprint(w, r.row(i, width), "\r\n")
+	}
+	switch {
+	case r.editing:
+		fmt.Fprint(w, clip("New name: "+string(r.input), width))
+	case r.status != "":
+		fmt.Fprint(w, clip(r.status, width))
+	default:
+		fmt.Fprint(w, clip(reviewHelp, width))
+	}
+}
+
+// row returns the i-th item as a line of at most width columns, with the
+// matches in its old name highlighted.
+func (r *review) row(i, width int) string {
+	item := r.items[i]
+	marker, box := "  ", "[ ]"
+	if i == r.cursor {
+		marker = "> "
+	}
+	if item.selected {
+		box = "[x]"
+	}
+	oldRel := r.rel(item.oldName)
+	newRel := r.rel(item.newName)
+	if filepath.Dir(item.newName) == filepath.Dir(item.oldName) {
+		newRel = filepath.Base(item.newName)
+	}
+	prefix := marker + box + " "
+	line := prefix + oldRel + " -> " + newRel
+
+	// Only the base name is matched, so spans are shifted past its dir.
+	shift := len(prefix) + len(oldRel) - len(filepath.Base(item.oldName))
+	var b strings.Builder
+	if i == r.cursor {
+		b.WriteString(ansiInverse)
+	}
+	line = clip(line, width)
+	last := 0
+	for _, span := range r.matches(filepath.Base(item.oldName)) {
+		start, end := span[0]+shift, min(span[1]+shift, len(line))
+		if start >= end {
+			continue
+		}
+		b.WriteString(line[last:start])
+		b.WriteString(ansiHighlight + line[start:end] + ansiReset)
+		if i == r.cursor {
+			b.WriteString(ansiInverse)
+		}
+		last = end
+	}
+	b.WriteString(line[last:])
+	if i == r.cursor {
+		b.WriteString(ansiReset)
+	}
+	return b.String()
+}
+
+func (r *review) rel(path string) string {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// clip cuts s to at most width runes.
+func clip(s string, width int) string {
+	n := 0
+	for i := range s {
+		if n == width {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
+
+// readKey reads a key press of a terminal in raw mode.
+func readKey(in *bufio.Reader) (string, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case '\r', '\n':
+		return KEY_ENTER, nil
+	case 0x7f, '\b':
+		return KEY_BACKSPACE, nil
+	case 0x03:
+		return KEY_CTRL_C, nil
+	case 0x1b:
+		// A lone escape is the key itself, others start a sequence.
+		if in.Buffered() == 0 {
+			return KEY_ESC, nil
+		}
+		seq := []byte{}
+		for {
+			c, err := in.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if len(seq) > 1 && c >= 0x40 && c <= 0x7e {
+				break
+			}
+		}
+		switch string(seq) {
+		case "[A", "OA":
+			return KEY_UP, nil
+		case "[B", "OB":
+			return KEY_DOWN, nil
+		case "[5~":
+			return KEY_PAGE_UP, nil
+		case "[6~":
+			return KEY_PAGE_DOWN, nil
+		case "[H", "OH", "[1~":
+			return KEY_HOME, nil
+		case "[F", "OF", "[4~":
+			return KEY_END, nil
+		}
+		return "", nil
+	}
+	if err = in.UnreadByte(); err != nil {
+		return "", err
+	}
+	c, _, err := in.ReadRune()
+	return string(c), err
+}
+
+// errNoTerminal is returned by runReview when stdin or stdout is not a
+// terminal.
+var errNoTerminal = errors.New("tui needs a terminal")
+
+// runReview shows pairs in the terminal for review, and returns the pairs
+// to carry out, with their edited names, and whether the review was
+// confirmed.
+func runReview(pairs map[string]string, root string, matches func(name string) [][]int) (map[string]string, bool, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return nil, false, errNoTerminal
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, false, fmt.Errorf("enter raw mode: %w", err)
+	}
+	defer term.Restore(in, state)
+	fmt.Print(ansiAltScreen)
+	defer fmt.Print(ansiMainScreen)
+
+	r := newReview(pairs, root, matches)
+	keys := bufio.NewReader(os.Stdin)
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		var screen strings.Builder
+		r.render(&screen, width, height)
+		fmt.Print(screen.String())
+
+		key, err := readKey(keys)
+		if err != nil {
+			return nil, false, fmt.Errorf("read key: %w", err)
+		}
+		if done, apply := r.handle(key); done {
+			return r.selectedPairs(), apply, nil
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestReview verifies that files are left out and renamed by keys, and that
+// a review with conflicting names can not be applied.
+func TestReview(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := createTempFile(t, dir, "a_draft.txt", "")
+	b := createTempFile(t, dir, "b_draft.txt", "")
+	c := createTempFile(t, dir, "c_draft.txt", "")
+	pairs := map[string]string{
+		a: filepath.Join(dir, "a.txt"),
+		b: filepath.Join(dir, "b.txt"),
+		c: filepath.Join(dir, "c.txt"),
+	}
+	r := newReview(pairs, dir, matchSpans(nil, "_draft"))
+
+	// Leave out b, then rename c onto a.txt, which is refused.
+	keys := []string{KEY_DOWN, " ", KEY_DOWN, "e", KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, "a", ".", "t", "x", "t", KEY_ENTER}
+	for _, key := range keys {
+		if done, _ := r.handle(key); done {
+			t.Fatalf("review is over early at %q", key)
+		}
+	}
+	if done, _ := r.handle(KEY_ENTER); done {
+		t.Fatal("expected a conflicting review not to be applied")
+	}
+	if r.status == "" {
+		t.Error("expected the conflict to be reported")
+	}
+
+	for _, key := range []string{"e", KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, KEY_BACKSPACE, "d", ".", "t", "x", "t", KEY_ENTER} {
+		r.handle(key)
+	}
+	done, apply := r.handle(KEY_ENTER)
+	if !done || !apply {
+		t.Fatal("expected the review to be applied")
+	}
+	got := r.selectedPairs()
+	want := map[string]string{a: filepath.Join(dir, "a.txt"), c: filepath.Join(dir, "d.txt")}
+	if len(got) != len(want) || got[a] != want[a] || got[c] != want[c] {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	r = newReview(pairs, dir, matchSpans(nil, "_draft"))
+	if done, apply := r.handle("q"); !done || apply {
+		t.Error("expected q to abort the review")
+	}
+}
+
+// TestReviewRender verifies that the list scrolls with the cursor, and that
+// matches are highlighted.
+func TestReviewRender(t *testing.T) {
+	pairs := make(map[string]string)
+	for _, name := range []string{"a1", "a2", "a3", "a4", "a5"} {
+		pairs["/root/"+name+".txt"] = "/root/" + name + "_new.txt"
+	}
+	r := newReview(pairs, "/root", matchSpans(regexp.MustCompile(`\d`), ""))
+	var screen strings.Builder
+	r.render(&screen, 80, 4)
+	for range 3 {
+		r.handle(KEY_DOWN)
+	}
+	screen.Reset()
+	r.render(&screen, 80, 4)
+	lines := strings.Split(screen.String(), "\r\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", lines)
+	}
+	if !strings.Contains(lines[0], "5 of 5 file(s) selected") {
+		t.Errorf("expected a header, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "a"+ansiHighlight+"3"+ansiReset) {
+		t.Errorf("expected a highlighted match on the first row, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], ansiInverse+"> [x] a") {
+		t.Errorf("expected the cursor on the second row, got %q", lines[2])
+	}
+	if got := clip("abcdef", 3); got != "abc" {
+		t.Errorf("expected abc, got %q", got)
+	}
+}
+
+// TestReadKey verifies that escape sequences are read as single keys.
+func TestReadKey(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("\x1b[A\x1b[6~ é\r\x7f"))
+	for _, want := range []string{KEY_UP, KEY_PAGE_DOWN, " ", "é", KEY_ENTER, KEY_BACKSPACE} {
+		got, err := readKey(in)
+		if err != nil {
+			t.Fatalf("read key error: %v", err)
+		}
+		if got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// Statuses of files in verification reports.
+const (
+	STATUS_VERIFIED string = "verified"
+)
+
+// verifyReport is the outcome of verify, which may be signed to be filed as
+// the evidence of a change.
+type verifyReport struct {
+	Plan string `json:"plan"`
+	// PlanHash is the SHA-256 of the plan file, which ties the report to
+	// the reviewed plan.
+	PlanHash   string         `json:"plan_sha256"`
+	Root       string         `json:"root"`
+	Action     string         `json:"action"`
+	VerifiedAt time.Time      `json:"verified_at"`
+	Verified   int            `json:"verified"`
+	Failed     int            `json:"failed"`
+	Files      []verifiedFile `json:"files"`
+}
+
+type verifiedFile struct {
+	Old      string   `json:"old"`
+	New      string   `json:"new"`
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// verify checks, once a JSON plan of -plan-out was carried out, that every
+// new path exists with the size and hash its file had when the plan was
+// written, and that the old paths are gone unless the files were copied. It
+// exits with 2 if any file fails.
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	planPath := flags.String("plan", "", "JSON plan written by -plan-out before the run")
+	root := flags.String("p", "", "dir the paths of the plan are resolved against. default is the path dir the plan was written for")
+	reportPath := flags.String("report", "", "write the verification report to this JSON file")
+	signKey := flags.String("sign-key", "", "sign the report with this Ed25519 private key, a PKCS #8 PEM file, and write the signature next to it with .sig appended")
+	withVerbose := flags.Bool("v", false, "list the verified files as well, not only the failed ones")
+	flags.Parse(args)
+	if *planPath == "" || flags.NArg() != 0 || !isJSONPlan(*planPath) {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if *signKey != "" && *reportPath == "" {
+		fmt.Println("sign-key can only be used together with -report")
+		os.Exit(1)
+	}
+	var key ed25519.PrivateKey
+	if *signKey != "" {
+		var err error
+		if key, err = loadSigningKey(*signKey); err != nil {
+			fmt.Println("load sign key:", err)
+			os.Exit(1)
+		}
+	}
+
+	r, err := verifyPlan(*planPath, *root, time.Now())
+	if err != nil {
+		fmt.Println("verify plan:", err)
+		os.Exit(1)
+	}
+	for _, f := range r.Files {
+		switch {
+		case f.Status != STATUS_VERIFIED:
+			fmt.Printf("FAIL %s -> %s:\n", f.Old, f.New)
+			for _, problem := range f.Problems {
+				fmt.Printf("  %s\n", problem)
+			}
+		case *withVerbose:
+			fmt.Printf("ok   %s -> %s\n", f.Old, f.New)
+		}
+	}
+	fmt.Printf("%d of %d file(s) verified.\n", r.Verified, len(r.Files))
+	if *reportPath != "" {
+		if err = writeVerifyReport(*reportPath, r, key); err != nil {
+			fmt.Println("write report:", err)
+			os.Exit(2)
+		}
+	}
+	if r.Failed > 0 {
+		os.Exit(2)
+	}
+}
+
+// verifyPlan checks the files of the JSON plan at path, with its paths
+// resolved against root, or the root of the plan if empty.
+func verifyPlan(path, root string, now time.Time) (verifyReport, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return verifyReport{}, err
+	}
+	var p jsonPlan
+	if err = json.Unmarshal(b, &p); err != nil {
+		return verifyReport{}, fmt.Errorf("parse plan(%q): %w", path, err)
+	}
+	if root == "" {
+		root = p.Root
+	}
+	sum := sha256.Sum256(b)
+	r := verifyReport{
+		Plan: path, PlanHash: hex.EncodeToString(sum[:]), Root: root, Action: p.Action,
+		VerifiedAt: now, Files: []verifiedFile{},
+	}
+	// Old paths which are the new path of another file, as in swaps, are
+	// not gone.
+	refilled := make(map[string]bool, len(p.Files))
+	for _, entry := range p.Files {
+		refilled[resolvePlanPath(root, entry.New)] = true
+	}
+	for _, entry := range p.Files {
+		oldPath, newPath := resolvePlanPath(root, entry.Old), resolvePlanPath(root, entry.New)
+		f := verifiedFile{Old: oldPath, New: newPath, Status: STATUS_VERIFIED}
+		f.Problems = checkDestination(newPath, entry)
+		if p.Action != omitter.COPY && !refilled[oldPath] {
+			if _, err := os.Lstat(oldPath); err == nil {
+				f.Problems = append(f.Problems, "old path still exists")
+			} else if !errors.Is(err, os.ErrNotExist) {
+				f.Problems = append(f.Problems, err.Error())
+			}
+		}
+		if len(f.Problems) > 0 {
+			f.Status = STATUS_FAILED
+			r.Failed++
+		} else {
+			r.Verified++
+		}
+		r.Files = append(r.Files, f)
+	}
+	return r, nil
+}
+
+// checkDestination returns what is wrong with the file at path, which
+// should have the size and hash of entry. Files are only hashed if their
+// size is right.
+func checkDestination(path string, entry jsonPlanEntry) []string {
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return []string{"new path is missing"}
+	case err != nil:
+		return []string{err.Error()}
+	case !info.Mode().IsRegular():
+		return []string{"new path is not a regular file"}
+	case info.Size() != entry.Size:
+		return []string{fmt.Sprintf("size is %d, expected %d", info.Size(), entry.Size)}
+	case entry.Hash == "":
+		return nil
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if hash != entry.Hash {
+		return []string{fmt.Sprintf("sha256 is %s, expected %s", hash, entry.Hash)}
+	}
+	return nil
+}
+
+// loadSigningKey reads an Ed25519 private key from a PKCS #8 PEM file, as
+// written by openssl genpkey -algorithm ed25519.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %q", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// writeVerifyReport writes r to path, and if key is set, its raw Ed25519
+// signature to path with .sig appended.
+func writeVerifyReport(path string, r verifyReport, key ed25519.PrivateKey) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	return os.WriteFile(path+".sig", ed25519.Sign(key, b), 0o644)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// TestVerifyPlan verifies that a JSON plan is read back by -plan-in, and
+// that once it was carried out, missing, altered and leftover files fail
+// verification, and that signed reports can be checked with the public key.
+func TestVerifyPlan(t *testing.T) {
+	dir := t.TempDir()
+	a := createTempFile(t, dir, "a_x.txt", "one")
+	b := createTempFile(t, dir, "b_x.txt", "two")
+	c := createTempFile(t, dir, "c_x.txt", "three")
+	pairs := map[string]string{
+		a: filepath.Join(dir, "a.txt"),
+		b: filepath.Join(dir, "b.txt"),
+		c: filepath.Join(dir, "c.txt"),
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := writeJSONPlan(planPath, dir, omitter.RENAME, pairs); err != nil {
+		t.Fatalf("write plan error: %v", err)
+	}
+	got, err := readPlan(planPath, dir, planFilter{})
+	if err != nil {
+		t.Fatalf("read plan error: %v", err)
+	}
+	if len(got) != len(pairs) || got[a] != pairs[a] {
+		t.Errorf("expected %v, got %v", pairs, got)
+	}
+
+	for _, old := range []string{a, b} {
+		if err = os.Rename(old, pairs[old]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.WriteFile(pairs[b], []byte("owt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := verifyPlan(planPath, "", time.Now())
+	if err != nil {
+		t.Fatalf("verify error: %v", err)
+	}
+	want := map[string]int{a: 0, b: 1, c: 2}
+	if r.Verified != 1 || r.Failed != 2 || len(r.Files) != 3 {
+		t.Fatalf("expected 1 verified and 2 failed files, got %+v", r)
+	}
+	for _, f := range r.Files {
+		if len(f.Problems) != want[f.Old] {
+			t.Errorf("expected %d problem(s) for %s, got %v", want[f.Old], f.Old, f.Problems)
+		}
+	}
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err = loadSigningKey(keyPath); err != nil {
+		t.Fatalf("load key error: %v", err)
+	}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	if err = writeVerifyReport(reportPath, r, key); err != nil {
+		t.Fatalf("write report error: %v", err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile(reportPath + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, report, sig) {
+		t.Error("expected the signature of the report to verify")
+	}
+}
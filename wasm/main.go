@@ -0,0 +1,56 @@
+//go:build js && wasm
+
+// Command wasm is the naming engine of omitter built to WebAssembly, so
+// rules can be previewed in browsers with the same outcome as the command.
+// It registers omitterPropose, which omitter.js wraps.
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// response is what omitterPropose returns, as JSON.
+type response struct {
+	Proposals []omitter.Proposal `json:"proposals,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+func main() {
+	js.Global().Set("omitterPropose", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) != 2 {
+			return encode(response{Error: "omitterPropose takes the names and the rules, as JSON"})
+		}
+		proposals, err := propose(args[0].String(), args[1].String())
+		if err != nil {
+			return encode(response{Error: err.Error()})
+		}
+		return encode(response{Proposals: proposals})
+	}))
+	// The functions are gone once main returns.
+	select {}
+}
+
+// propose returns the proposals of omitter.ProposeNames for the JSON array
+// of names, under the rules of omitter.ParseRules.
+func propose(names, rules string) ([]omitter.Proposal, error) {
+	var list []string
+	if err := json.Unmarshal([]byte(names), &list); err != nil {
+		return nil, err
+	}
+	opts, err := omitter.ParseRules([]byte(rules))
+	if err != nil {
+		return nil, err
+	}
+	return omitter.ProposeNames(list, opts)
+}
+
+func encode(r response) string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return `{"error":"encode response"}`
+	}
+	return string(b)
+}
@@ -0,0 +1,26 @@
+// omitter.js previews omitter rules in the browser, with the naming engine
+// built to omitter.wasm. It needs wasm_exec.js of the Go toolchain loaded
+// first, which defines Go.
+//
+//   const omitter = await loadOmitter("omitter.wasm");
+//   omitter.propose(["IMG_8842.jpg"], { s: "IMG_", replace: "holiday_" });
+//   // [{ name: "IMG_8842.jpg", new: "holiday_8842.jpg" }]
+
+export async function loadOmitter(url = "omitter.wasm") {
+  const go = new Go();
+  const { instance } = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+  go.run(instance);
+
+  return {
+    // propose returns the proposed new name of every name, a slash separated
+    // path, under rules keyed by the flags of omitter. Skipped names have a
+    // reason instead of a new name.
+    propose(names, rules = {}) {
+      const res = JSON.parse(globalThis.omitterPropose(JSON.stringify(names), JSON.stringify(rules)));
+      if (res.error) {
+        throw new Error(res.error);
+      }
+      return res.proposals ?? [];
+    },
+  };
+}
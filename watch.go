@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hossein1376/omitter/pkg/omitter"
+)
+
+// pendingFile is a file which was created or written under watch, and is
+// renamed once it has settled.
+type pendingFile struct {
+	seen time.Time
+	size int64
+	// open is set once the file was found open for writing, so it is only
+	// reported once.
+	open bool
+}
+
+// watcher renames the files created under a tree as they appear.
+type watcher struct {
+	cfg     config
+	pattern *regexp.Regexp
+	fsw     *fsnotify.Watcher
+	// delay is how long files must go without a change before they are
+	// renamed.
+	delay   time.Duration
+	pending map[string]pendingFile
+	// written are the paths the watcher itself wrote, and when, so their
+	// events are not taken for new files.
+	written map[string]time.Time
+	total   uint
+	// ctx is done once the watcher is interrupted, which stops a run in
+	// progress as well.
+	ctx context.Context
+	// digest, if set, collects the runs to be summarized.
+	digest *digest
+	// events, if set, records the events and what was done with them.
+	events *eventLog
+}
+
+// watchFlags returns the flags of cfg which prompt, need the whole tree or
+// describe a single run, and so can not be used with -watch.
+func watchFlags(cfg config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"i":                       cfg.withInteractive,
+		"confirm-each":            cfg.withConfirmEach,
+		"tui":                     cfg.withTUI,
+		"stream":                  cfg.withStream,
+		"staging":                 cfg.options.staging != "",
+		"plan-in":                 cfg.planIn != "",
+		"plan-out":                cfg.planOut != "",
+		"changed-since":           cfg.changedSince != "",
+		"conform-cache":           cfg.withConformCache,
+		"remap-capture":           cfg.remapCapture != 0,
+		"group-by-capture":        cfg.groupByCapture != 0,
+		"expect-per-dir":          cfg.options.expectPerDir != "",
+		"check-hardlinks":         cfg.options.checkHardlinks != "",
+		"fix-symlinks":            cfg.options.fixSymlinks != "",
+		"scan-summary":            cfg.withScanSummary,
+		"estimate":                cfg.withEstimate,
+		"summary-dirs":            cfg.withSummaryDirs,
+		"skip-report":             cfg.skipReport != "",
+		"strict":                  cfg.withStrict,
+		"control-socket":          cfg.controlSocket != "",
+		"number":                  cfg.options.withNumber,
+		"format json":             cfg.format == FORMAT_JSON,
+		"on-conflict prompt":      cfg.options.onConflict == omitter.CONFLICT_PROMPT,
+		"on-conflict ask-per-dir": cfg.options.onConflict == omitter.CONFLICT_ASK_PER_DIR,
+	} {
+		if set {
+			flags = append(flags, "-"+name)
+		}
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+// watch keeps renaming the files created under the path of cfg, once they
+// have settled, until it is interrupted. Files which exist already are left
+// alone.
+func watch(cfg config, pattern *regexp.Regexp) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("start watcher:", err)
+		os.Exit(2)
+	}
+	defer fsw.Close()
+	w := &watcher{
+		cfg: cfg, pattern: pattern, fsw: fsw, delay: cfg.watchDelay,
+		pending: make(map[string]pendingFile), written: make(map[string]time.Time),
+	}
+	if err = w.add(cfg.options.path, false); err != nil {
+		fmt.Println("watch dir:", err)
+		os.Exit(2)
+	}
+	if cfg.watchEvents != "" {
+		if w.events, err = openEventLog(cfg.watchEvents); err != nil {
+			fmt.Println("open watch events:", err)
+			os.Exit(2)
+		}
+		defer w.events.Close()
+	}
+
+	ctx, stop := interruptible(cfg.deadline)
+	defer stop()
+	w.ctx = ctx
+	ticker := time.NewTicker(max(w.delay/4, 100*time.Millisecond))
+	defer ticker.Stop()
+	// A nil channel never delivers, so there are no digests without a
+	// target.
+	var digests <-chan time.Time
+	if cfg.digestTarget != nil {
+		w.digest = newDigest(cfg.digestTarget, cfg.options.path, cfg.tags, time.Now())
+		digestTicker := time.NewTicker(cfg.digestEvery)
+		defer digestTicker.Stop()
+		digests = digestTicker.C
+	}
+	actionName := getActionName(cfg.options.output, cfg.options.transmissionType)
+	fmt.Printf("Watching %s, press Ctrl+C to stop.\n", cfg.options.path)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Stopped watching, %d file(s) were %s.\n", w.total, pastTense[actionName])
+			w.sendDigest(actionName, time.Now())
+			return
+		case now := <-digests:
+			w.sendDigest(actionName, now)
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(event, time.Now())
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			fmt.Println("watch:", err)
+		case now := <-ticker.C:
+			if ready := w.settled(now); len(ready) > 0 {
+				w.apply(ready, actionName)
+			}
+		}
+	}
+}
+
+// sendDigest sends the digest of the runs since the last one, if there were
+// any.
+func (w *watcher) sendDigest(actionName string, now time.Time) {
+	if w.digest == nil || w.digest.empty() {
+		return
+	}
+	if err := w.digest.send(actionName, now); err != nil {
+		fmt.Println("send digest:", err)
+	}
+}
+
+// add watches the dir at path and the dirs under it, and with files set,
+// marks the files under it as pending, as they appeared along with it. Dirs
+// which the filters skip are watched as well, and their files left alone by
+// planning.
+func (w *watcher) add(path string, files bool) error {
+	now := time.Now()
+	return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			return w.fsw.Add(path)
+		case files && d.Type().IsRegular():
+			if info, err := d.Info(); err == nil {
+				w.pending[path] = pendingFile{seen: now, size: info.Size()}
+				w.events.write(now, path, "", EVENT_PENDING, "in a new dir")
+			}
+		}
+		return nil
+	})
+}
+
+// handle records the file of event as pending, unless the watcher wrote it
+// itself, and starts watching new dirs. Events of the -watch-events file are
+// left out.
+func (w *watcher) handle(event fsnotify.Event, now time.Time) {
+	if w.events.owns(event.Name) {
+		return
+	}
+	op := event.Op.String()
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		delete(w.pending, event.Name)
+		w.events.write(now, event.Name, op, EVENT_REMOVED, "")
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		w.events.write(now, event.Name, op, EVENT_IGNORED, "neither created nor written")
+		return
+	}
+	if at, ok := w.written[event.Name]; ok && now.Sub(at) < 2*w.delay {
+		w.events.write(now, event.Name, op, EVENT_OWN_WRITE, "")
+		return
+	}
+	delete(w.written, event.Name)
+	info, err := os.Lstat(event.Name)
+	switch {
+	case err != nil:
+		w.events.write(now, event.Name, op, EVENT_GONE, err.Error())
+	case info.IsDir() && event.Has(fsnotify.Create):
+		w.events.write(now, event.Name, op, EVENT_WATCH_DIR, "")
+		if err = w.add(event.Name, true); err != nil {
+			fmt.Println("watch dir:", err)
+		}
+	case info.Mode().IsRegular() && !isJournal(event.Name):
+		w.pending[event.Name] = pendingFile{seen: now, size: info.Size()}
+		w.events.write(now, event.Name, op, EVENT_PENDING, "")
+	case isJournal(event.Name):
+		w.events.write(now, event.Name, op, EVENT_IGNORED, "journal")
+	default:
+		w.events.write(now, event.Name, op, EVENT_IGNORED, "not a regular file")
+	}
+}
+
+// settled returns the pending files which have not changed for the delay,
+// and are not open for writing by any process where that can be detected.
+func (w *watcher) settled(now time.Time) []string {
+	var ready []string
+	for path, p := range w.pending {
+		if now.Sub(p.seen) < w.delay {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			w.events.write(now, path, "", EVENT_GONE, err.Error())
+			continue
+		}
+		// Writes without events, as over some network file systems, still
+		// change the size.
+		if info.Size() != p.size {
+			w.pending[path] = pendingFile{seen: now, size: info.Size()}
+			w.events.write(now, path, "", EVENT_CHANGED, fmt.Sprintf("%d bytes", info.Size()))
+			continue
+		}
+		ready = append(ready, path)
+	}
+	// Where open files can not be detected, settling has to do.
+	open, _ := openFiles(ready)
+	ready = slices.DeleteFunc(ready, func(path string) bool {
+		if open[path] && !w.pending[path].open {
+			p := w.pending[path]
+			p.open = true
+			w.pending[path] = p
+			w.events.write(now, path, "", EVENT_OPEN, "open for writing")
+		}
+		return open[path]
+	})
+	for _, path := range ready {
+		delete(w.pending, path)
+	}
+	maps.DeleteFunc(w.written, func(_ string, at time.Time) bool {
+		return now.Sub(at) >= 2*w.delay
+	})
+	slices.Sort(ready)
+	return ready
+}
+
+// apply plans the files of ready, with the other files of the tree left
+// where they are, and carries out the plan.
+func (w *watcher) apply(ready []string, actionName string) {
+	p, err := omitter.PlanFiles(w.cfg.planOptions(w.pattern), ready, ignoredNames...)
+	if err != nil {
+		fmt.Println("plan:", err)
+		w.failed(ready, fmt.Errorf("plan: %w", err))
+		if w.digest != nil && !w.cfg.withDryRun {
+			w.digest.record(0, fmt.Errorf("plan: %w", err))
+		}
+		return
+	}
+	pairs := p.Pairs
+	for _, path := range ready {
+		if _, ok := pairs[path]; ok {
+			continue
+		} else if i := slices.IndexFunc(p.Skipped, func(s omitter.SkippedFile) bool { return s.Path == path }); i >= 0 {
+			w.events.write(time.Now(), path, "", EVENT_SKIPPED, p.Skipped[i].Reason)
+		} else {
+			w.events.write(time.Now(), path, "", EVENT_UNMATCHED, "")
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	if w.cfg.withDryRun {
+		for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+			fmt.Printf("%s -> %s\n", oldName, pairs[oldName])
+			w.events.write(time.Now(), oldName, "", EVENT_PLANNED, pairs[oldName])
+		}
+		return
+	}
+
+	if err = backupOverwritten(w.cfg, pairs, actionName); err != nil {
+		fmt.Println("back up:", err)
+		w.failed(slices.Collect(maps.Keys(pairs)), fmt.Errorf("back up: %w", err))
+		if w.digest != nil {
+			w.digest.record(0, fmt.Errorf("back up: %w", err))
+		}
+		return
+	}
+	if _, err = trashOverwritten(w.cfg, pairs, actionName); err != nil {
+		fmt.Println("move to trash:", err)
+		w.failed(slices.Collect(maps.Keys(pairs)), fmt.Errorf("move to trash: %w", err))
+		if w.digest != nil {
+			w.digest.record(0, fmt.Errorf("move to trash: %w", err))
+		}
+		return
+	}
+	opts, _, rec, _ := execOptions(w.cfg, actionName, len(pairs))
+	opts.HideProgress = true
+	opts.Context = w.ctx
+	now := time.Now()
+	for _, newPath := range pairs {
+		w.written[newPath] = now
+	}
+	res, err := omitter.Plan{Pairs: pairs}.Apply(actionName, opts)
+	if err := rec.save(); err != nil {
+		fmt.Println("save journal:", err)
+	}
+	w.total += res.Count
+	if w.events != nil {
+		at := time.Now()
+		for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+			if carriedOut(oldName, pairs[oldName], actionName) {
+				w.events.write(at, oldName, "", pastTense[actionName], pairs[oldName])
+			} else if err != nil {
+				w.events.write(at, oldName, "", EVENT_FAILED, err.Error())
+			} else {
+				w.events.write(at, oldName, "", EVENT_FAILED, "not carried out")
+			}
+		}
+	}
+	if w.digest != nil {
+		w.digest.record(res.Count, err)
+	}
+	if err != nil {
+		printRunError(actionName, err)
+	}
+	if w.cfg.withVerbose {
+		for _, oldName := range slices.Sorted(maps.Keys(pairs)) {
+			fmt.Printf("%s -> %s\n", oldName, pairs[oldName])
+		}
+	}
+}
+
+// failed records paths as failed with err.
+func (w *watcher) failed(paths []string, err error) {
+	at := time.Now()
+	for _, path := range slices.Sorted(slices.Values(paths)) {
+		w.events.write(at, path, "", EVENT_FAILED, err.Error())
+	}
+}
+
+// carriedOut reports whether actionName was carried out from oldPath to
+// newPath: whether newPath exists, and oldPath is gone unless it was copied.
+func carriedOut(oldPath, newPath, actionName string) bool {
+	if _, err := os.Lstat(newPath); err != nil {
+		return false
+	}
+	_, err := os.Lstat(oldPath)
+	return actionName == omitter.COPY || os.IsNotExist(err)
+}
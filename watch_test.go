@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// TestWatcherSettled verifies that new files are only ready once they went
+// without a change for the delay, and that files the watcher wrote itself
+// are not taken for new ones.
+func TestWatcherSettled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &watcher{
+		delay: time.Second, pending: make(map[string]pendingFile), written: make(map[string]time.Time),
+	}
+	start := time.Now()
+	done := createTempFile(t, dir, "done.txt", "complete")
+	growing := createTempFile(t, dir, "growing.txt", "part")
+	renamed := createTempFile(t, dir, "renamed.txt", "")
+	w.written[renamed] = start
+	for _, path := range []string{done, growing, renamed} {
+		w.handle(fsnotify.Event{Name: path, Op: fsnotify.Create}, start)
+	}
+	w.handle(fsnotify.Event{Name: growing, Op: fsnotify.Write}, start.Add(500*time.Millisecond))
+
+	if ready := w.settled(start.Add(900 * time.Millisecond)); len(ready) > 0 {
+		t.Errorf("expected no file to be ready yet, got %v", ready)
+	}
+	if ready := w.settled(start.Add(1200 * time.Millisecond)); !slices.Equal(ready, []string{done}) {
+		t.Errorf("expected %v, got %v", []string{done}, ready)
+	}
+
+	// A file growing without events is ready a delay after its last change.
+	if err = os.WriteFile(growing, []byte("part, and more"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ready := w.settled(start.Add(1600 * time.Millisecond)); len(ready) > 0 {
+		t.Errorf("expected the growing file not to be ready, got %v", ready)
+	}
+	if ready := w.settled(start.Add(2700 * time.Millisecond)); !slices.Equal(ready, []string{growing}) {
+		t.Errorf("expected %v, got %v", []string{growing}, ready)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("expected nothing pending, got %v", w.pending)
+	}
+}
+
+// TestWatchEvents verifies that events are recorded with what was done with
+// them, that the events of the log itself are left out, and that reopened
+// logs are appended to.
+func TestWatchEvents(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.csv")
+	events, err := openEventLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watcher{
+		delay: time.Second, pending: make(map[string]pendingFile), written: make(map[string]time.Time),
+		events: events,
+	}
+	start := time.Now()
+	file := createTempFile(t, dir, "new.txt", "data")
+	w.handle(fsnotify.Event{Name: file, Op: fsnotify.Create}, start)
+	w.handle(fsnotify.Event{Name: file, Op: fsnotify.Chmod}, start)
+	w.handle(fsnotify.Event{Name: logPath, Op: fsnotify.Write}, start)
+	if err = os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	w.settled(start.Add(2 * time.Second))
+	if err = events.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = openEventLog(logPath); err != nil {
+		t.Fatal(err)
+	}
+	events.write(start, file, "", EVENT_PLANNED, "")
+	events.Close()
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read events: %v", err)
+	}
+	var outcomes []string
+	for _, row := range rows[1:] {
+		if row[1] != file {
+			t.Errorf("expected only events of %s, got %v", file, row)
+		}
+		outcomes = append(outcomes, row[2]+" "+row[3])
+	}
+	want := []string{"CREATE pending", "CHMOD ignored", " gone", " planned"}
+	if !slices.Equal(rows[0], eventHeader) || !slices.Equal(outcomes, want) {
+		t.Errorf("expected a header and %q, got %v", want, rows)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Outcomes of the rows of -watch-events, besides the past tense of the
+// action for the files which were carried out.
+const (
+	EVENT_PENDING   string = "pending"
+	EVENT_IGNORED   string = "ignored"
+	EVENT_OWN_WRITE string = "own write"
+	EVENT_REMOVED   string = "removed"
+	EVENT_WATCH_DIR string = "watching dir"
+	EVENT_GONE      string = "gone"
+	EVENT_CHANGED   string = "changed"
+	EVENT_OPEN      string = "open"
+	EVENT_UNMATCHED string = "not matched"
+	EVENT_SKIPPED   string = "skipped"
+	EVENT_PLANNED   string = "planned"
+	EVENT_FAILED    string = "failed"
+)
+
+// eventHeader is the first row of -watch-events files.
+var eventHeader = []string{"time", "path", "event", "outcome", "detail"}
+
+// eventLog appends the file system events seen by -watch, and what was done
+// with their files, to a CSV file, so it can be told afterwards why a file
+// was or was not renamed. Rows of events have the operations of the event,
+// such as CREATE|WRITE, and those of the later steps have none.
+type eventLog struct {
+	// path is absolute, to tell the events of the log itself.
+	path string
+	f    *os.File
+	w    *csv.Writer
+	err  error
+}
+
+// openEventLog opens the CSV file at path for appending, and writes its
+// header if it is new.
+func openEventLog(path string) (*eventLog, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(abs, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l := &eventLog{path: abs, f: f, w: csv.NewWriter(f)}
+	if info.Size() == 0 {
+		if err = l.w.Write(eventHeader); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// write appends a row, and flushes it so the file is complete however the
+// watcher stops. Nothing is written without a log, and the first error is
+// reported once.
+func (l *eventLog) write(at time.Time, path, event, outcome, detail string) {
+	if l == nil || l.err != nil {
+		return
+	}
+	l.w.Write([]string{at.Format(time.RFC3339Nano), path, event, outcome, detail})
+	l.w.Flush()
+	if l.err = l.w.Error(); l.err != nil {
+		fmt.Println("write watch events:", l.err)
+	}
+}
+
+// owns reports whether path is the file of the log, whose writes are not
+// events to record, when it is under the watched dir.
+func (l *eventLog) owns(path string) bool {
+	if l == nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == l.path
+}
+
+func (l *eventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+func removeXattr(path, name string) error {
+	return errXattrUnsupported
+}
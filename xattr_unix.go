@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func setXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil {
+		return fmt.Errorf("set xattr %q: %w", name, err)
+	}
+	return nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get xattr %q: %w", name, err)
+	}
+	buf := make([]byte, size)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, fmt.Errorf("get xattr %q: %w", name, err)
+	}
+	return buf[:n], nil
+}
+
+func removeXattr(path, name string) error {
+	if err := unix.Removexattr(path, name); err != nil {
+		return fmt.Errorf("remove xattr %q: %w", name, err)
+	}
+	return nil
+}